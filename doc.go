@@ -36,6 +36,7 @@
 //   - ErrInvalidMode
 //   - ErrInvalidMergeStrategy
 //   - ErrInvalidIndent
+//   - ErrInvalidDepth
 //   - ErrCheckMismatch
 //
 // Use errors.Is() to check for specific errors:
@@ -54,5 +55,15 @@
 //		}
 //	}
 //
+// Failures with details callers may need as data are reported as typed
+// errors: *ParseError (file, line and column), *IncludeError (file, target and
+// include chain) and *StructureError (file and key path). Use errors.As() to
+// retrieve them:
+//
+//	var parseErr *fyaml.ParseError
+//	if errors.As(err, &parseErr) {
+//		// Report parseErr.File, parseErr.Line and parseErr.Column
+//	}
+//
 // For more examples, see the examples in the test files.
 package fyaml
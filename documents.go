@@ -0,0 +1,106 @@
+package fyaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// documents.go contains multi-document output (PackOptions.Documents).
+
+// splitDocuments returns the documents of doc: the values of the map, or the
+// items of the sequence, at the dot-separated key path, or at the root if
+// path is empty. Map values keep the order of their keys, which is sorted in
+// ModeCanonical and authored in ModePreserve.
+func splitDocuments(doc interface{}, path string) ([]*yaml.Node, error) {
+	n, err := yamlNode(doc)
+	if err != nil || n == nil {
+		return nil, err
+	}
+
+	if path != "" {
+		var walked []string
+		for _, key := range strings.Split(path, ".") {
+			walked = append(walked, key)
+			if n.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%w: %s is not a map", ErrDocumentsPath, strings.Join(walked[:len(walked)-1], "."))
+			}
+			value := mappingValue(n, key)
+			if value == nil {
+				return nil, fmt.Errorf("%w: no key %s", ErrDocumentsPath, strings.Join(walked, "."))
+			}
+			n = value
+		}
+	}
+
+	var docs []*yaml.Node
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			docs = append(docs, n.Content[i])
+		}
+	case yaml.SequenceNode:
+		docs = n.Content
+	default:
+		where := "the root"
+		if path != "" {
+			where = path
+		}
+		return nil, fmt.Errorf("%w: %s is not a map or sequence", ErrDocumentsPath, where)
+	}
+	return docs, nil
+}
+
+// mappingValue returns the value of key in the mapping node n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			value := n.Content[i+1]
+			if value.Kind == yaml.AliasNode {
+				value = value.Alias
+			}
+			return value
+		}
+	}
+	return nil
+}
+
+// marshalDocuments encodes docs as a stream: YAML documents separated by
+// "---", or JSON Lines with one compact JSON value per line.
+func marshalDocuments(docs []*yaml.Node, format Format, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSON:
+		for _, doc := range docs {
+			value, err := jsonValue(doc)
+			if err != nil {
+				return nil, err
+			}
+			line, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	case FormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(indent)
+		for _, doc := range docs {
+			if err := enc.Encode(doc); err != nil {
+				_ = enc.Close() // Close on error, ignore close error
+				return nil, err
+			}
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		// Should never happen due to early validation, but be safe
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, format)
+	}
+	return buf.Bytes(), nil
+}
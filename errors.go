@@ -1,6 +1,10 @@
 package fyaml
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/jksmth/fyaml/internal/packerr"
+)
 
 // Sentinel errors for programmatic error handling.
 // Use errors.Is() to check for specific errors:
@@ -12,22 +16,86 @@ import "errors"
 //		}
 //	}
 var (
-	// ErrDirectoryRequired is returned when Dir is empty or not provided.
+	// ErrDirectoryRequired is returned when neither Dir nor FS is provided.
 	ErrDirectoryRequired = errors.New("directory is required")
 
-	// ErrInvalidFormat is returned when Format is not FormatYAML or FormatJSON.
+	// ErrInvalidFormat is returned when Format is not FormatYAML, FormatJSON,
+	// FormatTOML, FormatProperties, FormatDotenv or FormatEnvFile.
 	ErrInvalidFormat = errors.New("invalid format")
 
 	// ErrInvalidMode is returned when Mode is not ModeCanonical or ModePreserve.
 	ErrInvalidMode = errors.New("invalid mode")
 
-	// ErrInvalidMergeStrategy is returned when MergeStrategy is not MergeShallow or MergeDeep.
+	// ErrInvalidMergeStrategy is returned when MergeStrategy is not MergeShallow, MergeDeep or MergeStrict.
 	ErrInvalidMergeStrategy = errors.New("invalid merge strategy")
 
+	// ErrInvalidSequenceMerge is returned when SequenceMerge is not SequenceReplace,
+	// SequenceAppend or SequenceAppendUnique.
+	ErrInvalidSequenceMerge = errors.New("invalid sequence merge")
+
+	// ErrInvalidSymlinkPolicy is returned when SymlinksOutsideRoot is not
+	// SymlinkError, SymlinkSkip or SymlinkAllow.
+	ErrInvalidSymlinkPolicy = errors.New("invalid symlink policy")
+
+	// ErrInvalidMultiDocument is returned when MultiDocument is not
+	// MultiDocumentFail, MultiDocumentMerge or MultiDocumentSequence.
+	ErrInvalidMultiDocument = errors.New("invalid multi-document policy")
+
+	// ErrDocumentsPath is returned when PackOptions.DocumentsPath does not
+	// lead to a map or sequence in the packed document.
+	ErrDocumentsPath = errors.New("cannot split documents")
+
+	// ErrUnrepresentable is returned when the packed document cannot be
+	// written in the requested Format, such as a null value in FormatTOML or
+	// FormatProperties.
+	ErrUnrepresentable = errors.New("cannot represent document")
+
 	// ErrInvalidIndent is returned when Indent is less than 1.
 	ErrInvalidIndent = errors.New("invalid indent")
 
+	// ErrInvalidDepth is returned when UnpackOptions.Depth is less than 1.
+	ErrInvalidDepth = errors.New("invalid depth")
+
 	// ErrCheckMismatch is returned when Check() finds differences between
 	// generated output and expected content.
 	ErrCheckMismatch = errors.New("output mismatch")
 )
+
+// Typed errors carry the details of a failure as data. Use errors.As() to
+// retrieve them:
+//
+//	var parseErr *fyaml.ParseError
+//	if errors.As(err, &parseErr) {
+//		fmt.Printf("%s:%d:%d: %s\n", parseErr.File, parseErr.Line, parseErr.Column, parseErr.Msg)
+//	}
+type (
+	// ParseError is a YAML/JSON, TOML or JSON5 syntax or type error in a
+	// source file. File is the path of the file as shown in messages; Line and
+	// Column are 1-based, or 0 if unknown. Language names the parser for files
+	// not read as YAML: "TOML", "JSON5", "JSONC", or "JSON" with RelaxedJSON.
+	// A file with several type errors reports one ParseError per value, and
+	// errors.As returns the first.
+	ParseError = packerr.ParseError
+
+	// IncludeError is an include directive that could not be processed.
+	// File is the pack file whose includes were being processed, Target the
+	// include path that failed as written, and Chain the include paths
+	// followed from File to reach Target, outermost first.
+	IncludeError = packerr.IncludeError
+
+	// StructureError is a file or directory whose content cannot be placed in
+	// the document, such as a list in a file that must hold a map. KeyPath is
+	// the key path the content would be merged into, and GotKind is
+	// "sequence" or "scalar".
+	StructureError = packerr.StructureError
+
+	// ConflictError is a key defined by two files under MergeStrict. KeyPath
+	// is the key defined twice, and First and Second are the locations of the
+	// two definitions, as "file" or "file:line:column" relative to the pack root.
+	ConflictError = packerr.ConflictError
+
+	// MultiDocumentError is a file holding more than one YAML document that
+	// PackOptions.MultiDocument cannot pack. Line is the line of the document
+	// that could not be packed, and Reason says why.
+	MultiDocumentError = packerr.MultiDocumentError
+)
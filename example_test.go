@@ -1,11 +1,13 @@
 package fyaml_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"testing/fstest"
 
 	"github.com/jksmth/fyaml"
 )
@@ -52,6 +54,26 @@ func ExamplePack_withLogger() {
 	fmt.Println(string(result))
 }
 
+func ExamplePack_fs() {
+	// Pack from an fs.FS instead of a directory on disk (e.g. embed.FS)
+	fsys := fstest.MapFS{
+		"config/entities/item1.yml": {Data: []byte("id: example1\n")},
+	}
+
+	result, err := fyaml.Pack(context.Background(), fyaml.PackOptions{
+		FS:  fsys,
+		Dir: "config",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(result))
+	// Output:
+	// entities:
+	//   item1:
+	//     id: example1
+}
+
 func ExamplePack_minimal() {
 	// Minimal usage - only directory required, all other options use defaults
 	result, err := fyaml.Pack(context.Background(), fyaml.PackOptions{
@@ -63,6 +85,23 @@ func ExamplePack_minimal() {
 	fmt.Println(string(result))
 }
 
+func ExampleUnpack() {
+	// Split a single document back into a directory tree
+	data, err := os.ReadFile("config.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = fyaml.Unpack(context.Background(), data, fyaml.UnpackOptions{
+		Dir:        "./config",
+		Depth:      2,
+		SplitPaths: []string{"components.schemas"},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func ExampleFormat() {
 	// Use FormatYAML for YAML output (default)
 	_ = fyaml.FormatYAML
@@ -159,3 +198,67 @@ func ExampleCheck_emptyJSON() {
 	}
 	// Empty expected is normalized, so it matches
 }
+
+func ExamplePackTo() {
+	fsys := fstest.MapFS{
+		"config/@defaults.yml": {Data: []byte("timeout: 30\n")},
+		"config/overrides.yml": {Data: []byte("timeout: 60\n")},
+		"config/README.md":     {Data: []byte("# Config\n")},
+	}
+
+	var buf bytes.Buffer
+	result, err := fyaml.PackTo(context.Background(), &buf, fyaml.PackOptions{
+		FS:  fsys,
+		Dir: "config",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("files:", result.Files)
+	for _, s := range result.Skipped {
+		fmt.Println("skipped:", s.Path, s.Reason)
+	}
+	for _, w := range result.Warnings {
+		fmt.Println("warning:", w.Message)
+	}
+	// Output:
+	// files: [@defaults.yml overrides.yml]
+	// skipped: README.md unsupported
+	// warning: key timeout from @defaults.yml:1:1 overridden by overrides.yml:1:1
+}
+
+func ExampleBuild() {
+	fsys := fstest.MapFS{
+		"config/services/api.yml": {Data: []byte("replicas: 3\n")},
+	}
+
+	// Build the merged document, inspect it, then encode it
+	doc, err := fyaml.Build(context.Background(), fyaml.PackOptions{
+		FS:  fsys,
+		Dir: "config",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	services := doc.(map[interface{}]interface{})["services"].(map[interface{}]interface{})
+	for name := range services {
+		fmt.Println("service:", name)
+	}
+
+	result, err := fyaml.Encode(doc, fyaml.FormatJSON, 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(result))
+	// Output:
+	// service: api
+	// {
+	//   "services": {
+	//     "api": {
+	//       "replicas": 3
+	//     }
+	//   }
+	// }
+}
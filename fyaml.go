@@ -5,13 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.yaml.in/yaml/v4"
 
 	"github.com/jksmth/fyaml/internal/filetree"
+	"github.com/jksmth/fyaml/internal/flat"
 	"github.com/jksmth/fyaml/internal/logger"
+	"github.com/jksmth/fyaml/internal/toml"
 )
 
 // Pack compiles a directory of YAML/JSON files into a single document.
@@ -24,7 +32,8 @@ import (
 // The context can be used to cancel the operation. If the context is canceled,
 // Pack will return an error wrapping context.Canceled or context.DeadlineExceeded.
 //
-// PackOptions.Dir is required. All other options have sensible defaults:
+// PackOptions.Dir is required unless PackOptions.FS is set, in which case the
+// root of FS is packed by default. All other options have sensible defaults:
 //   - Format defaults to FormatYAML
 //   - Mode defaults to ModeCanonical
 //   - MergeStrategy defaults to MergeShallow
@@ -33,13 +42,126 @@ import (
 //
 // Returns the packed document as bytes, or an error if packing fails.
 func Pack(ctx context.Context, opts PackOptions) ([]byte, error) {
+	result, _, err := pack(ctx, opts)
+	return result, err
+}
+
+// PackTo compiles a directory like Pack and writes the document to w.
+//
+// It returns a PackResult listing the files used and skipped, warnings such
+// as overridden keys, and the digest of the output, so callers can act on
+// them without parsing log output. Every warning is also reported to the
+// Logger as it occurs.
+//
+// Nothing is written to w if packing fails.
+func PackTo(ctx context.Context, w io.Writer, opts PackOptions) (*PackResult, error) {
+	output, result, err := pack(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(output); err != nil {
+		return nil, fmt.Errorf("failed to write output: %w", err)
+	}
+	return result, nil
+}
+
+// Build compiles a directory into a merged document without encoding it.
+//
+// In ModePreserve the document is a *yaml.Node carrying authored key order and
+// comments. In ModeCanonical it is a generic value as decoded by yaml: maps are
+// map[interface{}]interface{} (or map[string]interface{} for a single file
+// with string keys), sequences are []interface{}, and scalars are Go values.
+// Build returns nil if the directory has no content.
+//
+// Build accepts the same options as Pack; Format and Indent are validated but
+// only apply to Encode, and Documents and DocumentsPath are ignored. Unless
+// they are set, Encode(doc, opts.Format, opts.Indent) produces the same bytes
+// Pack would.
+func Build(ctx context.Context, opts PackOptions) (interface{}, error) {
+	b, err := build(ctx, &opts)
+	if err != nil {
+		return nil, err
+	}
+	return b.doc, nil
+}
+
+// Encode serializes a document returned by Build in the given format.
+// format defaults to FormatYAML if empty, and indent to 2 if zero.
+// An empty document encodes as Pack's empty output: nothing for YAML, and
+// null for JSON.
+func Encode(doc interface{}, format Format, indent int) ([]byte, error) {
+	if format == "" {
+		format = FormatYAML
+	}
+	if _, err := ParseFormat(string(format)); err != nil {
+		return nil, err
+	}
+	if indent == 0 {
+		indent = 2
+	}
+	if indent < 1 {
+		return nil, fmt.Errorf("%w: %d (must be positive)", ErrInvalidIndent, indent)
+	}
+
+	output, err := marshalToFormat(doc, format, indent)
+	if err != nil {
+		return nil, err
+	}
+	if isEmptyOutput(output) {
+		return emptyOutput(format), nil
+	}
+	return output, nil
+}
+
+// pack implements Pack and PackTo.
+func pack(ctx context.Context, opts PackOptions) ([]byte, *PackResult, error) {
+	b, err := build(ctx, &opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	packResult := newPackResult(b.tree, b.report)
+
+	// Marshal based on format
+	var result []byte
+	if opts.Documents || opts.DocumentsPath != "" {
+		var docs []*yaml.Node
+		docs, err = splitDocuments(b.doc, opts.DocumentsPath)
+		if err == nil {
+			result, err = marshalDocuments(docs, opts.Format, opts.Indent)
+		}
+	} else {
+		result, err = marshalToFormat(b.doc, opts.Format, opts.Indent)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Check if result is effectively empty and handle accordingly
+	if isEmptyOutput(result) {
+		return handleEmptyOutput(packDir(opts), opts.Format, opts.Logger, packResult)
+	}
+
+	packResult.setDigest(result)
+	return result, packResult, nil
+}
+
+// built is a merged document together with what went into it.
+type built struct {
+	doc    interface{}
+	tree   *filetree.Node   // nil if the directory has no content
+	report *filetree.Report // files used and keys overridden
+}
+
+// build applies defaults to opts, validates them and merges the directory.
+func build(ctx context.Context, opts *PackOptions) (*built, error) {
 	// Check for context cancellation
 	if err := ctx.Err(); err != nil {
 		return nil, fmt.Errorf("context canceled: %w", err)
 	}
 
 	// Validate directory first
-	if opts.Dir == "" {
+	if opts.Dir == "" && opts.FS == nil {
 		return nil, fmt.Errorf("%w", ErrDirectoryRequired)
 	}
 
@@ -53,6 +175,15 @@ func Pack(ctx context.Context, opts PackOptions) ([]byte, error) {
 	if opts.MergeStrategy == "" {
 		opts.MergeStrategy = MergeShallow
 	}
+	if opts.SequenceMerge == "" {
+		opts.SequenceMerge = SequenceReplace
+	}
+	if opts.MultiDocument == "" {
+		opts.MultiDocument = MultiDocumentFail
+	}
+	if opts.SymlinksOutsideRoot == "" {
+		opts.SymlinksOutsideRoot = SymlinkError
+	}
 	if opts.Indent == 0 {
 		opts.Indent = 2
 	}
@@ -63,14 +194,17 @@ func Pack(ctx context.Context, opts PackOptions) ([]byte, error) {
 	}
 
 	// Use no-op logger if not provided
-	log := opts.Logger
-	if log == nil {
-		log = logger.Nop()
+	if opts.Logger == nil {
+		opts.Logger = logger.Nop()
 	}
 
 	// Validate format
-	if opts.Format != FormatYAML && opts.Format != FormatJSON {
-		return nil, fmt.Errorf("%w: %s (must be 'yaml' or 'json')", ErrInvalidFormat, opts.Format)
+	if _, err := ParseFormat(string(opts.Format)); err != nil {
+		return nil, err
+	}
+	if opts.Format != FormatYAML && opts.Format != FormatJSON && (opts.Documents || opts.DocumentsPath != "") {
+		// TOML and flat files have no document streams
+		return nil, fmt.Errorf("%w: %s (documents are written as 'yaml' or 'json')", ErrInvalidFormat, opts.Format)
 	}
 
 	// Validate mode
@@ -79,30 +213,28 @@ func Pack(ctx context.Context, opts PackOptions) ([]byte, error) {
 	}
 
 	// Validate merge strategy
-	if opts.MergeStrategy != MergeShallow && opts.MergeStrategy != MergeDeep {
-		return nil, fmt.Errorf("%w: %s (must be 'shallow' or 'deep')", ErrInvalidMergeStrategy, opts.MergeStrategy)
+	if opts.MergeStrategy != MergeShallow && opts.MergeStrategy != MergeDeep && opts.MergeStrategy != MergeStrict {
+		return nil, fmt.Errorf("%w: %s (must be 'shallow', 'deep' or 'strict')", ErrInvalidMergeStrategy, opts.MergeStrategy)
 	}
 
-	// Check for context cancellation before I/O operations
-	if err := ctx.Err(); err != nil {
-		return nil, fmt.Errorf("context canceled: %w", err)
+	// Validate sequence merge
+	if _, err := ParseSequenceMerge(string(opts.SequenceMerge)); err != nil {
+		return nil, err
 	}
 
-	// Resolve dir to absolute path to use as pack root
-	absDir, err := filepath.Abs(opts.Dir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve directory path: %w", err)
+	// Validate multi-document policy
+	if _, err := ParseMultiDocument(string(opts.MultiDocument)); err != nil {
+		return nil, err
 	}
 
-	// Build the filetree
-	tree, err := filetree.NewTree(opts.Dir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build filetree: %w", err)
+	// Validate symlink policy
+	if _, err := ParseSymlinkPolicy(string(opts.SymlinksOutsideRoot)); err != nil {
+		return nil, err
 	}
 
-	// Handle empty directory
-	if tree == nil {
-		return handleEmptyOutput(opts.Dir, opts.Format, log)
+	// Check for context cancellation before I/O operations
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context canceled: %w", err)
 	}
 
 	// Convert public types to internal types
@@ -112,18 +244,44 @@ func Pack(ctx context.Context, opts PackOptions) ([]byte, error) {
 	}
 
 	mergeStrategy := filetree.MergeShallow
-	if opts.MergeStrategy == MergeDeep {
+	switch opts.MergeStrategy {
+	case MergeDeep:
 		mergeStrategy = filetree.MergeDeep
+	case MergeStrict:
+		mergeStrategy = filetree.MergeStrict
 	}
 
 	// Create processing options
 	procOpts := &filetree.Options{
-		EnableIncludes:  opts.EnableIncludes,
-		PackRoot:        absDir,
-		ConvertBooleans: opts.ConvertBooleans,
-		Mode:            mode,
-		MergeStrategy:   mergeStrategy,
-		Logger:          log,
+		EnableIncludes:      opts.EnableIncludes,
+		ConvertBooleans:     opts.ConvertBooleans,
+		RelaxedJSON:         opts.RelaxedJSON,
+		Mode:                mode,
+		MergeStrategy:       mergeStrategy,
+		AllowIdentical:      opts.AllowIdenticalDuplicates,
+		SequenceMerge:       filetree.SequenceMerge(opts.SequenceMerge),
+		ListMergeKeys:       opts.ListMergeKeys,
+		ListMergeKeysByPath: opts.ListMergeKeysByPath,
+		AllowNonMapFiles:    opts.AllowNonMapFiles,
+		MultiDocument:       filetree.MultiDocument(opts.MultiDocument),
+		CollectErrors:       opts.CollectErrors,
+		Logger:              opts.Logger,
+		Report:              &filetree.Report{},
+	}
+	if opts.SourceMap != nil {
+		opts.SourceMap.Entries = nil
+		procOpts.SourceMap = &filetree.SourceMap{}
+	}
+
+	// Build the filetree
+	tree, err := newTree(*opts, procOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle empty directory
+	if tree == nil {
+		return &built{report: procOpts.Report}, nil
 	}
 
 	// Check for context cancellation before marshaling
@@ -132,32 +290,101 @@ func Pack(ctx context.Context, opts PackOptions) ([]byte, error) {
 	}
 
 	// Get the marshaled data structure (avoids circular references)
-	marshaledData, err := tree.Marshal(procOpts)
+	doc, err := tree.Marshal(procOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal tree: %w", err)
 	}
+	if node, ok := doc.(*yaml.Node); ok && node == nil {
+		doc = nil // an empty tree in preserve mode
+	}
+	if opts.SourceMap != nil {
+		opts.SourceMap.Entries = newSourceMapEntries(procOpts.SourceMap)
+	}
 
-	// Marshal based on format
-	result, err := marshalToFormat(marshaledData, opts.Format, opts.Indent)
+	return &built{doc: doc, tree: tree, report: procOpts.Report}, nil
+}
+
+// newTree builds the filetree for opts.Dir, either on the OS filesystem or
+// within opts.FS, and sets the include confinement boundary on procOpts.
+func newTree(opts PackOptions, procOpts *filetree.Options) (*filetree.Node, error) {
+	if opts.FS != nil {
+		fsys := opts.FS
+		if dir := path.Clean(packDir(opts)); dir != "." {
+			sub, err := fs.Sub(opts.FS, dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve directory path: %w", err)
+			}
+			fsys = sub
+		}
+		procOpts.FS = fsys
+
+		tree, err := filetree.NewTreeFSWithOptions(fsys, treeOpts(opts))
+		if err != nil {
+			return nil, fmt.Errorf("failed to build filetree: %w", err)
+		}
+		return tree, nil
+	}
+
+	// Resolve dir to absolute path to use as pack root
+	absDir, err := filepath.Abs(opts.Dir)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to resolve directory path: %w", err)
 	}
+	procOpts.PackRoot = absDir
 
-	// Check if result is effectively empty and handle accordingly
-	if strings.TrimSpace(string(result)) == "null" {
-		return handleEmptyOutput(opts.Dir, opts.Format, log)
+	tree, err := filetree.NewTreeWithOptions(opts.Dir, treeOpts(opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build filetree: %w", err)
 	}
+	return tree, nil
+}
 
-	return result, nil
+// treeOpts returns the options for building the filetree of opts.
+func treeOpts(opts PackOptions) filetree.TreeOptions {
+	return filetree.TreeOptions{
+		Include:         opts.Include,
+		Exclude:         opts.Exclude,
+		OrderPrefixes:   opts.OrderPrefixes,
+		FollowSymlinks:  opts.FollowSymlinks,
+		OutsideSymlinks: filetree.SymlinkPolicy(opts.SymlinksOutsideRoot),
+		TextExtensions:  opts.TextExtensions,
+		Logger:          opts.Logger,
+	}
 }
 
-// handleEmptyOutput returns the appropriate empty output for the given format.
-func handleEmptyOutput(dir string, format Format, log Logger) ([]byte, error) {
-	log.Warnf("no YAML/JSON files found in directory: %s", dir)
+// packDir returns the directory being packed, for use in messages.
+// An empty Dir with FS set refers to the root of FS.
+func packDir(opts PackOptions) string {
+	if opts.FS != nil && opts.Dir == "" {
+		return "."
+	}
+	return opts.Dir
+}
+
+// handleEmptyOutput returns the appropriate empty output for the given format,
+// recording the warning in result.
+func handleEmptyOutput(dir string, format Format, log Logger, result *PackResult) ([]byte, *PackResult, error) {
+	msg := fmt.Sprintf("no YAML/JSON files found in directory: %s", dir)
+	log.Warnf("%s", msg)
+	result.Warnings = append(result.Warnings, Warning{Kind: WarningEmptyOutput, Message: msg})
+
+	output := emptyOutput(format)
+	result.setDigest(output)
+	return output, result, nil
+}
+
+// emptyOutput returns the output for a document without content.
+func emptyOutput(format Format) []byte {
 	if format == FormatJSON {
-		return []byte("null\n"), nil
+		return []byte("null\n")
 	}
-	return []byte{}, nil
+	return []byte{}
+}
+
+// isEmptyOutput reports whether encoded output holds no content.
+func isEmptyOutput(output []byte) bool {
+	s := strings.TrimSpace(string(output))
+	return s == "null" || s == ""
 }
 
 // marshalToFormat marshals data to the specified format with the given indent.
@@ -165,20 +392,39 @@ func handleEmptyOutput(dir string, format Format, log Logger) ([]byte, error) {
 func marshalToFormat(data interface{}, format Format, indent int) ([]byte, error) {
 	switch format {
 	case FormatJSON:
-		// JSON doesn't support comments - if we got a yaml.Node, decode it first
-		jsonData := data
-		if node, ok := data.(*yaml.Node); ok {
-			// Handle nil node (can happen in preserve mode with empty trees)
-			if node == nil {
-				jsonData = nil
-			} else if err := node.Decode(&jsonData); err != nil {
-				return nil, fmt.Errorf("failed to decode node for JSON: %w", err)
-			}
+		jsonData, err := jsonValue(data)
+		if err != nil {
+			return nil, err
 		}
-		// JSON only supports string keys, so normalize any non-string keys
-		normalizedData := filetree.NormalizeKeys(jsonData)
 		indentStr := strings.Repeat(" ", indent)
-		return json.MarshalIndent(normalizedData, "", indentStr)
+		return json.MarshalIndent(jsonData, "", indentStr)
+	case FormatTOML:
+		node, err := yamlNode(tomlValues(data))
+		if err != nil {
+			return nil, err
+		}
+		output, err := toml.Encode(node)
+		if err != nil {
+			return nil, fmt.Errorf("%w in TOML: %v", ErrUnrepresentable, err)
+		}
+		return output, nil
+	case FormatProperties, FormatDotenv, FormatEnvFile:
+		node, err := yamlNode(data)
+		if err != nil {
+			return nil, err
+		}
+		write := flat.Properties
+		switch format {
+		case FormatDotenv:
+			write = flat.Dotenv
+		case FormatEnvFile:
+			write = flat.EnvFile
+		}
+		output, err := write(node)
+		if err != nil {
+			return nil, fmt.Errorf("%w as %s: %v", ErrUnrepresentable, format, err)
+		}
+		return output, nil
 	case FormatYAML:
 		var buf bytes.Buffer
 		enc := yaml.NewEncoder(&buf)
@@ -197,6 +443,70 @@ func marshalToFormat(data interface{}, format Format, indent int) ([]byte, error
 	}
 }
 
+// jsonValue returns data in a form encoding/json can marshal.
+// data can be *yaml.Node (preserve mode) or interface{} (canonical mode).
+func jsonValue(data interface{}) (interface{}, error) {
+	// JSON doesn't support comments - if we got a yaml.Node, decode it first
+	jsonData := data
+	if node, ok := data.(*yaml.Node); ok {
+		// Handle nil node (can happen in preserve mode with empty trees)
+		if node == nil {
+			jsonData = nil
+		} else if err := node.Decode(&jsonData); err != nil {
+			return nil, fmt.Errorf("failed to decode node for JSON: %w", err)
+		}
+	}
+	// JSON only supports string keys, so normalize any non-string keys
+	return filetree.NormalizeKeys(jsonData), nil
+}
+
+// yamlNode returns data as a *yaml.Node, or nil for an empty document.
+// Canonical data is encoded, which sorts its keys as YAML output would.
+func yamlNode(data interface{}) (*yaml.Node, error) {
+	if node, ok := data.(*yaml.Node); ok || data == nil {
+		return node, nil
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+	return node, nil
+}
+
+// tomlValues returns data with whole float64 values and times replaced by
+// scalar nodes that keep their TOML type. Encoding writes whole floats as
+// integers (1.0 as 1), and every time with a zone, while TOML tells these
+// apart.
+func tomlValues(data interface{}) interface{} {
+	switch v := data.(type) {
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(v, 'f', 1, 64)}
+		}
+	case time.Time:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: toml.Timestamp(v)}
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, val := range v {
+			m[k] = tomlValues(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = tomlValues(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = tomlValues(val)
+		}
+		return s
+	}
+	return data
+}
+
 // Check compares generated output with expected content using exact byte comparison.
 // Returns ErrCheckMismatch if contents don't match.
 // Whitespace differences will be detected as mismatches.
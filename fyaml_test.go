@@ -1,12 +1,20 @@
 package fyaml
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
+
+	"go.yaml.in/yaml/v4"
 )
 
 // Helper to create PackOptions for tests.
@@ -149,6 +157,17 @@ func TestPack_InvalidMergeStrategy(t *testing.T) {
 	}
 }
 
+func TestPack_InvalidSequenceMerge(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeShallow)
+	opts.SequenceMerge = SequenceMerge("invalid")
+
+	_, err := Pack(context.Background(), opts)
+	if !errors.Is(err, ErrInvalidSequenceMerge) {
+		t.Errorf("error should be ErrInvalidSequenceMerge, got: %v", err)
+	}
+}
+
 func TestPack_InvalidIndent(t *testing.T) {
 	dir := t.TempDir()
 	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeShallow)
@@ -239,6 +258,26 @@ func TestPack_WithLogger(t *testing.T) {
 	}
 }
 
+func TestPack_OverrideWarnings(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/@a.yml": "build:\n  image: node\n",
+		"jobs/@b.yml": "build:\n  image: golang\n",
+	})
+
+	var logOutput strings.Builder
+	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeDeep)
+	opts.Logger = NewLogger(&logOutput, false)
+
+	if _, err := Pack(context.Background(), opts); err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	want := "[WARN] key jobs.build.image from jobs/@a.yml:2:3 overridden by jobs/@b.yml:2:3\n"
+	if logOutput.String() != want {
+		t.Errorf("log output = %q, want %q", logOutput.String(), want)
+	}
+}
+
 func TestPack_NilLogger(t *testing.T) {
 	dir := createTestDir(t, map[string]string{
 		"test.yml": `key: value`,
@@ -316,223 +355,1310 @@ func TestPack_MergeDeep(t *testing.T) {
 	}
 }
 
-func TestPack_EnableIncludes(t *testing.T) {
+func TestPack_MergeStrict(t *testing.T) {
 	dir := createTestDir(t, map[string]string{
-		"shared/defaults.yml": `timeout: 30
-retries: 3`,
-		"entities/item1.yml": `entity:
-  id: example1
-  config: !include ../shared/defaults.yml`,
+		"jobs/@a.yml": "build:\n  image: node\n",
+		"jobs/@b.yml": "build:\n  image: golang\n  steps: [test]\n",
 	})
 
-	result, err := Pack(context.Background(), testOpts(dir, FormatYAML, true, false, ModeCanonical, MergeShallow))
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			_, err := Pack(context.Background(), testOpts(dir, FormatYAML, false, false, mode, MergeStrict))
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("Pack() error = %v, want *ConflictError", err)
+			}
+			want := &ConflictError{
+				KeyPath: []string{"jobs", "build", "image"},
+				First:   "jobs/@a.yml:2:3",
+				Second:  "jobs/@b.yml:2:3",
+			}
+			if !reflect.DeepEqual(conflict, want) {
+				t.Errorf("ConflictError = %+v, want %+v", conflict, want)
+			}
+		})
+	}
+}
+
+func TestPack_MergeStrict_AllowIdenticalDuplicates(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/@a.yml": "build:\n  image: node\n",
+		"jobs/@b.yml": "build:\n  image: node\n  steps: [test]\n",
+	})
+
+	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeStrict)
+	opts.AllowIdenticalDuplicates = true
+	result, err := Pack(context.Background(), opts)
 	if err != nil {
 		t.Fatalf("Pack() error = %v", err)
 	}
+	want := "jobs:\n  build:\n    image: node\n    steps:\n      - test\n"
+	if string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
+	}
+}
 
-	resultStr := string(result)
-	// Include should be processed
-	if strings.Contains(resultStr, "!include") {
-		t.Error("Include directive should be processed, not left as literal")
+func TestPack_SequenceMerge(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/build/@base.yml":  "steps: [checkout]\n",
+		"jobs/build/@tests.yml": "steps: [checkout, test]\n",
+	})
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			opts := testOpts(dir, FormatJSON, false, false, mode, MergeDeep)
+			opts.SequenceMerge = SequenceAppendUnique
+			result, err := Pack(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			want := "{\n  \"jobs\": {\n    \"build\": {\n      \"steps\": [\n        \"checkout\",\n        \"test\"\n      ]\n    }\n  }\n}"
+			if string(result) != want {
+				t.Errorf("Pack() = %q, want %q", result, want)
+			}
+		})
 	}
-	if !strings.Contains(resultStr, "timeout:") || !strings.Contains(resultStr, "retries:") {
-		t.Error("Included content should be present in output")
+}
+
+func TestPack_SequenceDirectory(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"servers[]/01-prod.yml":    "url: https://api.example.com\n",
+		"servers[]/02-staging.yml": "url: https://staging.example.com\n",
+	})
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			result, err := Pack(context.Background(), testOpts(dir, FormatJSON, false, false, mode, MergeShallow))
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			want := "{\n  \"servers\": [\n    {\n      \"url\": \"https://api.example.com\"\n    },\n    {\n      \"url\": \"https://staging.example.com\"\n    }\n  ]\n}"
+			if string(result) != want {
+				t.Errorf("Pack() = %q, want %q", result, want)
+			}
+		})
 	}
 }
 
-func TestPack_ConvertBooleans(t *testing.T) {
+func TestPack_AllowNonMapFiles(t *testing.T) {
 	dir := createTestDir(t, map[string]string{
-		"config.yml": `enabled: on
-active: yes`,
+		"service/timeout.yml": "30\n",
+		"service/tags.yml":    "[web, api]\n",
 	})
 
-	result, err := Pack(context.Background(), testOpts(dir, FormatYAML, false, true, ModeCanonical, MergeShallow))
+	opts := testOpts(dir, FormatJSON, false, false, ModeCanonical, MergeShallow)
+	opts.AllowNonMapFiles = true
+	result, err := Pack(context.Background(), opts)
 	if err != nil {
 		t.Fatalf("Pack() error = %v", err)
 	}
+	want := "{\n  \"service\": {\n    \"tags\": [\n      \"web\",\n      \"api\"\n    ],\n    \"timeout\": 30\n  }\n}"
+	if string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
+	}
 
-	resultStr := string(result)
-	// Boolean conversion should convert on/yes to true
-	if strings.Contains(resultStr, "enabled: on") {
-		t.Error("Boolean conversion should convert 'on' to 'true'")
+	// A root file still has to hold a map
+	opts.Dir = "testdata/scalar-file/input"
+	_, err = Pack(context.Background(), opts)
+	var structErr *StructureError
+	if !errors.As(err, &structErr) || !structErr.MergesIntoParent {
+		t.Errorf("Pack() error = %v, want a *StructureError for a root file", err)
 	}
-	if strings.Contains(resultStr, "active: yes") {
-		t.Error("Boolean conversion should convert 'yes' to 'true'")
+}
+
+func TestPack_Ordering(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"workflow/.order":            "name\non\n",
+		"workflow/name.yml":          "value: ci\n",
+		"workflow/on.yml":            "push: {}\n",
+		"workflow/jobs/20-test.yml":  "runs-on: ubuntu\n",
+		"workflow/jobs/10-build.yml": "runs-on: ubuntu\n",
+	})
+
+	opts := testOpts(dir, FormatYAML, false, false, ModePreserve, MergeShallow)
+	opts.OrderPrefixes = true
+	result, err := Pack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
 	}
-	if !strings.Contains(resultStr, "enabled: true") {
-		t.Error("Result should contain 'enabled: true'")
+	want := "workflow:\n" +
+		"  name:\n    value: ci\n" +
+		"  on:\n    push: {}\n" +
+		"  jobs:\n" +
+		"    build:\n      runs-on: ubuntu\n" +
+		"    test:\n      runs-on: ubuntu\n"
+	if string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
 	}
-	if !strings.Contains(resultStr, "active: true") {
-		t.Error("Result should contain 'active: true'")
+}
+
+func TestPack_FollowSymlinks(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"shared/labels.yml": "team: platform\n",
+		"app/name.yml":      "value: api\n",
+	})
+	if err := os.Symlink(filepath.Join("..", "shared"), filepath.Join(dir, "app", "shared")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeShallow)
+	result, err := Pack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if strings.Contains(string(result), "app:\n  shared:") {
+		t.Errorf("Pack() = %q, want the symlinked directory left out", result)
+	}
+
+	opts.FollowSymlinks = true
+	result, err = Pack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	want := "app:\n  name:\n    value: api\n  shared:\n    labels:\n      team: platform\n" +
+		"shared:\n  labels:\n    team: platform\n"
+	if string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
+	}
+
+	opts.SymlinksOutsideRoot = "follow"
+	if _, err := Pack(context.Background(), opts); !errors.Is(err, ErrInvalidSymlinkPolicy) {
+		t.Errorf("Pack() error = %v, want ErrInvalidSymlinkPolicy", err)
 	}
 }
 
-func TestPack_CustomIndent(t *testing.T) {
+func TestPackTo_SymlinkCycleWarning(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/name.yml": {Data: []byte("value: api\n")},
+		"app/loop":     {Data: []byte(".."), Mode: fs.ModeSymlink},
+	}
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{FS: fsys, FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("PackTo() error = %v", err)
+	}
+	if want := "app:\n  name:\n    value: api\n"; buf.String() != want {
+		t.Errorf("PackTo() wrote %q, want %q", buf.String(), want)
+	}
+	if want := []SkippedFile{{Path: "app/loop", Reason: SkipSymlinkCycle}}; !reflect.DeepEqual(result.Skipped, want) {
+		t.Errorf("Skipped = %v, want %v", result.Skipped, want)
+	}
+	warnings := []Warning{{
+		Kind:    WarningSymlinkCycle,
+		Message: "Not following symlink app/loop: it points to ., which contains it",
+		Sources: []SourceLocation{{File: "app/loop"}},
+	}}
+	if !reflect.DeepEqual(result.Warnings, warnings) {
+		t.Errorf("Warnings = %+v, want %+v", result.Warnings, warnings)
+	}
+}
+
+func TestPack_MultiDocument(t *testing.T) {
 	dir := createTestDir(t, map[string]string{
-		"test.yml": `key:
-  nested: value`,
+		"app/config.yml": "port: 80\nname: web\n---\nport: 443\n",
 	})
 
 	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeShallow)
-	opts.Indent = 4
+	_, err := Pack(context.Background(), opts)
+	var docErr *MultiDocumentError
+	if !errors.As(err, &docErr) || docErr.Line != 4 {
+		t.Fatalf("Pack() error = %v, want a *MultiDocumentError at line 4", err)
+	}
 
+	opts.MultiDocument = MultiDocumentMerge
 	result, err := Pack(context.Background(), opts)
 	if err != nil {
 		t.Fatalf("Pack() error = %v", err)
 	}
-
-	// Verify indentation (4 spaces instead of 2)
-	resultStr := string(result)
-	lines := strings.Split(resultStr, "\n")
-	found4SpaceIndent := false
-	for _, line := range lines {
-		if strings.HasPrefix(line, "    nested:") {
-			found4SpaceIndent = true
-			break
-		}
+	if want := "app:\n  config:\n    name: web\n    port: 443\n"; string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
 	}
-	if !found4SpaceIndent {
-		t.Error("Custom indent of 4 should be used")
+
+	opts.MultiDocument = "split"
+	if _, err := Pack(context.Background(), opts); !errors.Is(err, ErrInvalidMultiDocument) {
+		t.Errorf("Pack() error = %v, want ErrInvalidMultiDocument", err)
 	}
 }
 
-func TestParseFormat(t *testing.T) {
+func TestPack_TOML(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"app/server.yml": "port: 8080\nhost: localhost\ntls:\n  enabled: true\n",
+		"app/@meta.yml":  "name: web\nweights: [1.0, 0.5]\nratio: 2.0\n",
+	})
+
 	tests := []struct {
-		name    string
-		input   string
-		want    Format
-		wantErr bool
-		errType error
+		mode Mode
+		want string
 	}{
-		{"yaml", "yaml", FormatYAML, false, nil},
-		{"json", "json", FormatJSON, false, nil},
-		{"invalid", "invalid", "", true, ErrInvalidFormat},
-		{"empty", "", "", true, ErrInvalidFormat},
+		{ModeCanonical, "[app]\nname = \"web\"\nratio = 2.0\nweights = [1.0, 0.5]\n\n[app.server]\nhost = \"localhost\"\nport = 8080\n\n[app.server.tls]\nenabled = true\n"},
+		{ModePreserve, "[app]\nname = \"web\"\nweights = [1.0, 0.5]\nratio = 2.0\n\n[app.server]\nport = 8080\nhost = \"localhost\"\n\n[app.server.tls]\nenabled = true\n"},
 	}
-
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := ParseFormat(tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ParseFormat() error = %v, wantErr %v", err, tt.wantErr)
-				return
+		t.Run(string(tt.mode), func(t *testing.T) {
+			opts := testOpts(dir, FormatTOML, false, false, tt.mode, MergeShallow)
+			result, err := Pack(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
 			}
-			if got != tt.want {
-				t.Errorf("ParseFormat() = %v, want %v", got, tt.want)
+			if string(result) != tt.want {
+				t.Errorf("Pack() = %q, want %q", result, tt.want)
 			}
-			if tt.wantErr && !errors.Is(err, tt.errType) {
-				t.Errorf("ParseFormat() error = %v, want %v", err, tt.errType)
+		})
+	}
+}
+
+func TestPack_TOMLDateTimes(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"app.yml": "base: &base\n  start: 2024-01-02 03:04:05\n  day: 2024-01-02\nsite:\n  <<: *base\n  day: 2024-01-03T00:00:00Z\nruns: [2024-01-02 03:04:05, 2024-01-02T03:04:05+02:00]\n",
+		"db.toml": "backup = 2024-01-02T03:04:05\n",
+	})
+
+	// Timestamps and dates without a zone stay local, however they were merged
+	tests := []struct {
+		mode Mode
+		want string
+	}{
+		{ModeCanonical, "backup = 2024-01-02T03:04:05\nruns = [2024-01-02T03:04:05, 2024-01-02T03:04:05+02:00]\n\n[base]\nday = 2024-01-02\nstart = 2024-01-02T03:04:05\n\n[site]\nday = 2024-01-03T00:00:00Z\nstart = 2024-01-02T03:04:05\n"},
+		{ModePreserve, "runs = [2024-01-02T03:04:05, 2024-01-02T03:04:05+02:00]\nbackup = 2024-01-02T03:04:05\n\n[base]\nstart = 2024-01-02T03:04:05\nday = 2024-01-02\n\n[site]\nstart = 2024-01-02T03:04:05\nday = 2024-01-03T00:00:00Z\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			result, err := Pack(context.Background(), testOpts(dir, FormatTOML, false, false, tt.mode, MergeShallow))
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Pack() = %q, want %q", result, tt.want)
 			}
 		})
 	}
 }
 
-func TestParseMode(t *testing.T) {
+func TestPack_TOMLErrors(t *testing.T) {
 	tests := []struct {
 		name    string
-		input   string
-		want    Mode
-		wantErr bool
-		errType error
+		files   map[string]string
+		docs    bool
+		wantErr error
+		want    string
 	}{
-		{"canonical", "canonical", ModeCanonical, false, nil},
-		{"preserve", "preserve", ModePreserve, false, nil},
-		{"invalid", "invalid", "", true, ErrInvalidMode},
-		{"empty", "", "", true, ErrInvalidMode},
+		{"null", map[string]string{"app.yml": "port: ~\n"}, false, ErrUnrepresentable, "null value at port"},
+		{"mixed array", map[string]string{"app.yml": "ports: [80, http]\n"}, false, ErrUnrepresentable, "array mixes integer and string values at ports"},
+		{"integers and floats", map[string]string{"app.yml": "weights: [1, 2.5]\n"}, false, ErrUnrepresentable, "array mixes integer and float values at weights"},
+		{"documents", map[string]string{"app.yml": "port: 80\n"}, true, ErrInvalidFormat, "documents are written as 'yaml' or 'json'"},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ParseMode(tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			opts := testOpts(createTestDir(t, tt.files), FormatTOML, false, false, ModeCanonical, MergeShallow)
+			opts.Documents = tt.docs
+			_, err := Pack(context.Background(), opts)
+			if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Pack() error = %v, want %v containing %q", err, tt.wantErr, tt.want)
 			}
-			if got != tt.want {
-				t.Errorf("ParseMode() = %v, want %v", got, tt.want)
+		})
+	}
+}
+
+func TestPack_FlatFormats(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"app/server.yml": "port: 8080\nhost: localhost\n",
+		"app/@meta.yml":  "name: my app\nhosts: [a, b]\n",
+	})
+
+	tests := []struct {
+		format Format
+		mode   Mode
+		want   string
+	}{
+		{FormatProperties, ModeCanonical, "app.hosts[0]=a\napp.hosts[1]=b\napp.name=my app\napp.server.host=localhost\napp.server.port=8080\n"},
+		{FormatProperties, ModePreserve, "app.name=my app\napp.hosts[0]=a\napp.hosts[1]=b\napp.server.port=8080\napp.server.host=localhost\n"},
+		{FormatDotenv, ModeCanonical, "APP_HOSTS_0=a\nAPP_HOSTS_1=b\nAPP_NAME=\"my app\"\nAPP_SERVER_HOST=localhost\nAPP_SERVER_PORT=8080\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format)+"/"+string(tt.mode), func(t *testing.T) {
+			opts := testOpts(dir, tt.format, false, false, tt.mode, MergeShallow)
+			result, err := Pack(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
 			}
-			if tt.wantErr && !errors.Is(err, tt.errType) {
-				t.Errorf("ParseMode() error = %v, want %v", err, tt.errType)
+			if string(result) != tt.want {
+				t.Errorf("Pack() = %q, want %q", result, tt.want)
 			}
 		})
 	}
 }
 
-func TestParseMergeStrategy(t *testing.T) {
+func TestPack_FlatFormatErrors(t *testing.T) {
 	tests := []struct {
 		name    string
-		input   string
-		want    MergeStrategy
-		wantErr bool
-		errType error
+		format  Format
+		files   map[string]string
+		docs    bool
+		wantErr error
+		want    string
 	}{
-		{"shallow", "shallow", MergeShallow, false, nil},
-		{"deep", "deep", MergeDeep, false, nil},
-		{"invalid", "invalid", "", true, ErrInvalidMergeStrategy},
-		{"empty", "", "", true, ErrInvalidMergeStrategy},
+		{"null", FormatProperties, map[string]string{"app.yml": "port: ~\n"}, false, ErrUnrepresentable, "cannot represent document as properties: null value at port"},
+		{"empty list", FormatDotenv, map[string]string{"app.yml": "hosts: []\n"}, false, ErrUnrepresentable, "empty sequence at hosts"},
+		{"collision", FormatDotenv, map[string]string{"app.yml": "a_b: 1\na:\n  b: 2\n"}, false, ErrUnrepresentable, "key A_B is already written"},
+		{"documents", FormatDotenv, map[string]string{"app.yml": "port: 80\n"}, true, ErrInvalidFormat, "documents are written as 'yaml' or 'json'"},
+		{"env-file quotes", FormatEnvFile, map[string]string{"app.yml": "name: my app\n"}, false, ErrUnrepresentable, `cannot represent document as env-file: value "my app" needs quotes`},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ParseMergeStrategy(tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ParseMergeStrategy() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.want {
-				t.Errorf("ParseMergeStrategy() = %v, want %v", got, tt.want)
-			}
-			if tt.wantErr && !errors.Is(err, tt.errType) {
-				t.Errorf("ParseMergeStrategy() error = %v, want %v", err, tt.errType)
+			opts := testOpts(createTestDir(t, tt.files), tt.format, false, false, ModeCanonical, MergeShallow)
+			opts.Documents = tt.docs
+			_, err := Pack(context.Background(), opts)
+			if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Pack() error = %v, want %v containing %q", err, tt.wantErr, tt.want)
 			}
 		})
 	}
 }
 
-func TestCheck_Matching(t *testing.T) {
-	generated := []byte("key: value\n")
-	expected := []byte("key: value\n")
+func TestPack_TextExtensions(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"job/config.yml": "image: alpine\n",
+		"job/run.sh":     "set -e\nmake test\n",
+	})
 
-	err := Check(generated, expected, CheckOptions{Format: FormatYAML})
+	opts := testOpts(dir, FormatYAML, false, false, ModePreserve, MergeShallow)
+	result, err := Pack(context.Background(), opts)
 	if err != nil {
-		t.Errorf("Check() with matching content should not return error, got: %v", err)
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if want := "job:\n  config:\n    image: alpine\n"; string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
 	}
-}
-
-func TestCheck_Mismatch(t *testing.T) {
-	generated := []byte("key: value\n")
-	expected := []byte("key: different\n")
 
-	err := Check(generated, expected, CheckOptions{Format: FormatYAML})
-	if err == nil {
-		t.Error("Check() with mismatched content should return error")
+	opts.TextExtensions = []string{"sh"}
+	result, err = Pack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
 	}
-	if !errors.Is(err, ErrCheckMismatch) {
-		t.Errorf("Check() should return ErrCheckMismatch, got: %v", err)
+	if want := "job:\n  config:\n    image: alpine\n  run: |\n    set -e\n    make test\n"; string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
 	}
-}
-
-func TestCheck_EmptyYAML(t *testing.T) {
-	// Empty YAML output is empty bytes
-	generated := []byte{}
-	expected := []byte{}
 
-	err := Check(generated, expected, CheckOptions{Format: FormatYAML})
+	opts.Format = FormatJSON
+	result, err = Pack(context.Background(), opts)
 	if err != nil {
-		t.Errorf("Check() with empty YAML should not return error, got: %v", err)
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if !strings.Contains(string(result), `"run": "set -e\nmake test\n"`) {
+		t.Errorf("Pack() = %s, want run as a JSON string", result)
 	}
 }
 
-func TestCheck_EmptyJSON(t *testing.T) {
-	// Empty JSON output is normalized to "null\n"
-	generated := []byte("null\n")
-	expected := []byte{} // Empty
+func TestPack_RelaxedJSON(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"app/server.jsonc": "{\n  // Listen port\n  \"port\": 8080,\n}\n",
+		"app/legacy.json":  "{\n  // Still here\n  \"debug\": true,\n}\n",
+	})
 
-	err := Check(generated, expected, CheckOptions{Format: FormatJSON})
-	if err != nil {
-		t.Errorf("Check() with empty JSON (normalized) should not return error, got: %v", err)
+	opts := testOpts(dir, FormatYAML, false, false, ModePreserve, MergeShallow)
+	_, err := Pack(context.Background(), opts)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !strings.HasSuffix(parseErr.File, "legacy.json") {
+		t.Fatalf("Pack() error = %v, want a ParseError for legacy.json", err)
 	}
-}
+
+	opts.RelaxedJSON = true
+	result, err := Pack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if want := "app:\n  legacy:\n    # Still here\n    \"debug\": true\n  server:\n    # Listen port\n    \"port\": 8080\n"; string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
+	}
+}
+
+func TestPack_Documents(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"resources/service.yml":    "kind: Service\nmetadata:\n  name: web\n",
+		"resources/deployment.yml": "kind: Deployment\nmetadata:\n  name: web\n",
+		"list/items[]/a.yml":       "name: a\n",
+		"list/items[]/b.yml":       "name: b\n",
+	})
+
+	tests := []struct {
+		name    string
+		mode    Mode
+		format  Format
+		path    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "canonical",
+			mode: ModeCanonical, format: FormatYAML, path: "resources",
+			want: "kind: Deployment\nmetadata:\n  name: web\n---\nkind: Service\nmetadata:\n  name: web\n",
+		},
+		{
+			name: "preserve",
+			mode: ModePreserve, format: FormatYAML, path: "resources",
+			want: "kind: Deployment\nmetadata:\n  name: web\n---\nkind: Service\nmetadata:\n  name: web\n",
+		},
+		{
+			name: "sequence items",
+			mode: ModeCanonical, format: FormatYAML, path: "list.items",
+			want: "name: a\n---\nname: b\n",
+		},
+		{
+			name: "json lines",
+			mode: ModeCanonical, format: FormatJSON, path: "resources",
+			want: "{\"kind\":\"Deployment\",\"metadata\":{\"name\":\"web\"}}\n{\"kind\":\"Service\",\"metadata\":{\"name\":\"web\"}}\n",
+		},
+		{
+			name: "root",
+			mode: ModeCanonical, format: FormatJSON,
+			want: "{\"items\":[{\"name\":\"a\"},{\"name\":\"b\"}]}\n{\"deployment\":{\"kind\":\"Deployment\",\"metadata\":{\"name\":\"web\"}},\"service\":{\"kind\":\"Service\",\"metadata\":{\"name\":\"web\"}}}\n",
+		},
+		{name: "missing key", mode: ModeCanonical, format: FormatYAML, path: "resources.ingress", wantErr: ErrDocumentsPath},
+		{name: "scalar", mode: ModePreserve, format: FormatYAML, path: "resources.service.kind", wantErr: ErrDocumentsPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOpts(dir, tt.format, false, false, tt.mode, MergeShallow)
+			opts.Documents = true
+			opts.DocumentsPath = tt.path
+			result, err := Pack(context.Background(), opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Pack() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Pack() = %q, want %q", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestPack_ListMergeKeys(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"pod/@base.yml":  "containers:\n  - name: app\n    ports:\n      - containerPort: 80\n",
+		"pod/@patch.yml": "containers:\n  - name: app\n    image: app:2\n    ports:\n      - containerPort: 80\n        protocol: TCP\n",
+	})
+
+	// Strict merging still allows items to share their identity key
+	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeStrict)
+	opts.ListMergeKeys = []string{"name"}
+	opts.ListMergeKeysByPath = map[string][]string{"pod.containers.*.ports": {"containerPort"}}
+	result, err := Pack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	want := `pod:
+  containers:
+    - image: app:2
+      name: app
+      ports:
+        - containerPort: 80
+          protocol: TCP
+`
+	if string(result) != want {
+		t.Errorf("Pack() =\n%s\nwant:\n%s", result, want)
+	}
+}
+
+func TestPack_EnableIncludes(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"shared/defaults.yml": `timeout: 30
+retries: 3`,
+		"entities/item1.yml": `entity:
+  id: example1
+  config: !include ../shared/defaults.yml`,
+	})
+
+	result, err := Pack(context.Background(), testOpts(dir, FormatYAML, true, false, ModeCanonical, MergeShallow))
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	resultStr := string(result)
+	// Include should be processed
+	if strings.Contains(resultStr, "!include") {
+		t.Error("Include directive should be processed, not left as literal")
+	}
+	if !strings.Contains(resultStr, "timeout:") || !strings.Contains(resultStr, "retries:") {
+		t.Error("Included content should be present in output")
+	}
+}
+
+func TestPack_FS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config/entities/item1.yml": {Data: []byte("id: example1\n")},
+		"config/entities/item2.yml": {Data: []byte("id: example2\n")},
+		"config/.hidden.yml":        {Data: []byte("hidden: true\n")},
+		"other/ignored.yml":         {Data: []byte("ignored: true\n")},
+	}
+
+	result, err := Pack(context.Background(), PackOptions{FS: fsys, Dir: "config"})
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	expected := `entities:
+  item1:
+    id: example1
+  item2:
+    id: example2
+`
+	if string(result) != expected {
+		t.Errorf("Pack() = %q, want %q", string(result), expected)
+	}
+}
+
+func TestPack_FS_DirSpellings(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config/item.yml": {Data: []byte("key: value\n")},
+	}
+
+	for _, dir := range []string{"./config", "config/", "./config/", "config/./", "./"} {
+		t.Run(dir, func(t *testing.T) {
+			result, err := Pack(context.Background(), PackOptions{FS: fsys, Dir: dir})
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			want := "key: value\n"
+			if dir == "./" {
+				want = "config:\n  item:\n    key: value\n"
+			}
+			if string(result) != want {
+				t.Errorf("Pack() = %q, want %q", string(result), want)
+			}
+		})
+	}
+}
+
+func TestPack_FS_DefaultsToRoot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"item.yml": {Data: []byte("key: value\n")},
+	}
+
+	result, err := Pack(context.Background(), PackOptions{FS: fsys})
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if string(result) != "key: value\n" {
+		t.Errorf("Pack() = %q", string(result))
+	}
+}
+
+func TestPack_FS_EnableIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pack/shared/defaults.yml": {Data: []byte("timeout: 30\n")},
+		"pack/shared/script.sh":    {Data: []byte("echo hi")},
+		"pack/entities/item1.yml": {Data: []byte(`config: !include ../shared/defaults.yml
+script: !include-text ../shared/script.sh
+`)},
+	}
+
+	result, err := Pack(context.Background(), PackOptions{FS: fsys, Dir: "pack", EnableIncludes: true})
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	resultStr := string(result)
+	if !strings.Contains(resultStr, "timeout: 30") {
+		t.Errorf("included YAML should be present, got: %s", resultStr)
+	}
+	if !strings.Contains(resultStr, "script: echo hi") {
+		t.Errorf("included text should be present, got: %s", resultStr)
+	}
+}
+
+func TestPack_FS_IncludeEscapesPackRoot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"secret.yml":          {Data: []byte("password: hunter2\n")},
+		"pack/entities/a.yml": {Data: []byte("data: !include ../../secret.yml\n")},
+	}
+
+	_, err := Pack(context.Background(), PackOptions{FS: fsys, Dir: "pack", EnableIncludes: true})
+	if err == nil {
+		t.Fatal("Pack() should return error for include escaping pack root")
+	}
+	if !strings.Contains(err.Error(), "escapes pack root") {
+		t.Errorf("error should mention 'escapes pack root', got: %v", err)
+	}
+}
+
+func TestPack_SourceMap(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"entities/@base.yml": "item:\n  id: base\n",
+		"entities/item.yml":  "id: example\n",
+	})
+
+	sourceMap := &SourceMap{}
+	_, err := Pack(context.Background(), PackOptions{Dir: dir, SourceMap: sourceMap})
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	want := []SourceMapEntry{
+		{Path: []string{"entities"}, Sources: []SourceLocation{{File: "entities"}}},
+		{Path: []string{"entities", "item"}, Sources: []SourceLocation{
+			{File: "entities/@base.yml", Line: 1, Column: 1},
+			{File: "entities/item.yml"},
+		}},
+		{Path: []string{"entities", "item", "id"}, Sources: []SourceLocation{
+			{File: "entities/@base.yml", Line: 2, Column: 3},
+			{File: "entities/item.yml", Line: 1, Column: 1},
+		}},
+	}
+	if !reflect.DeepEqual(sourceMap.Entries, want) {
+		t.Errorf("SourceMap.Entries = %+v, want %+v", sourceMap.Entries, want)
+	}
+}
+
+func TestPack_SourceMap_EmptyDirectory(t *testing.T) {
+	sourceMap := &SourceMap{Entries: []SourceMapEntry{{Path: []string{"stale"}}}}
+	_, err := Pack(context.Background(), PackOptions{Dir: t.TempDir(), SourceMap: sourceMap})
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if len(sourceMap.Entries) != 0 {
+		t.Errorf("SourceMap.Entries = %+v, want none", sourceMap.Entries)
+	}
+}
+
+func TestPackTo(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"entities/@base.yml": "item:\n  id: base\n",
+		"entities/item.yml":  "id: example\n",
+		"entities/notes.txt": "not yaml",
+		".hidden.yml":        "hidden: true\n",
+	})
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("PackTo() error = %v", err)
+	}
+
+	want, err := Pack(context.Background(), PackOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	if buf.String() != string(want) {
+		t.Errorf("PackTo() wrote %q, want %q", buf.String(), want)
+	}
+
+	if files := []string{"entities/@base.yml", "entities/item.yml"}; !reflect.DeepEqual(result.Files, files) {
+		t.Errorf("Files = %v, want %v", result.Files, files)
+	}
+	skipped := []SkippedFile{
+		{Path: ".hidden.yml", Reason: SkipHidden},
+		{Path: "entities/notes.txt", Reason: SkipUnsupported},
+	}
+	if !reflect.DeepEqual(result.Skipped, skipped) {
+		t.Errorf("Skipped = %v, want %v", result.Skipped, skipped)
+	}
+
+	warnings := []Warning{{
+		Kind:    WarningOverride,
+		Message: "key entities.item.id from entities/@base.yml:2:3 overridden by entities/item.yml:1:1",
+		Path:    []string{"entities", "item", "id"},
+		Sources: []SourceLocation{
+			{File: "entities/@base.yml", Line: 2, Column: 3},
+			{File: "entities/item.yml", Line: 1, Column: 1},
+		},
+	}}
+	if !reflect.DeepEqual(result.Warnings, warnings) {
+		t.Errorf("Warnings = %+v, want %+v", result.Warnings, warnings)
+	}
+
+	sum := sha256.Sum256(want)
+	if digest := "sha256:" + hex.EncodeToString(sum[:]); result.Digest != digest {
+		t.Errorf("Digest = %s, want %s", result.Digest, digest)
+	}
+}
+
+func TestPackTo_IgnoreFile(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		".fyamlignore":      "*.local.yml\n",
+		"app.yml":           "name: app\n",
+		"app.local.yml":     "name: local\n",
+		"env/.fyamlignore":  "!dev.local.yml\n",
+		"env/dev.local.yml": "debug: true\n",
+	})
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("PackTo() error = %v", err)
+	}
+	if want := "env:\n  dev.local:\n    debug: true\nname: app\n"; buf.String() != want {
+		t.Errorf("PackTo() wrote %q, want %q", buf.String(), want)
+	}
+	skipped := []SkippedFile{
+		{Path: ".fyamlignore", Reason: SkipHidden},
+		{Path: "app.local.yml", Reason: SkipIgnored},
+		{Path: "env/.fyamlignore", Reason: SkipHidden},
+	}
+	if !reflect.DeepEqual(result.Skipped, skipped) {
+		t.Errorf("Skipped = %v, want %v", result.Skipped, skipped)
+	}
+}
+
+func TestPackTo_IncludeExclude(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"global.yml":           "name: app\n",
+		"services/api.yml":     "port: 80\n",
+		"experimental/new.yml": "port: 81\n",
+	})
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{
+		Dir:     dir,
+		Include: []string{"services/**", "experimental/**"},
+		Exclude: []string{"experimental/**"},
+	})
+	if err != nil {
+		t.Fatalf("PackTo() error = %v", err)
+	}
+	if want := "services:\n  api:\n    port: 80\n"; buf.String() != want {
+		t.Errorf("PackTo() wrote %q, want %q", buf.String(), want)
+	}
+	skipped := []SkippedFile{
+		{Path: "experimental", Reason: SkipExcluded},
+		{Path: "global.yml", Reason: SkipExcluded},
+	}
+	if !reflect.DeepEqual(result.Skipped, skipped) {
+		t.Errorf("Skipped = %v, want %v", result.Skipped, skipped)
+	}
+
+	_, err = Pack(context.Background(), PackOptions{Dir: dir, Exclude: []string{"[unclosed"}})
+	if err == nil || !strings.Contains(err.Error(), `invalid exclude pattern "[unclosed"`) {
+		t.Errorf("Pack() error = %v, want invalid exclude pattern", err)
+	}
+}
+
+func TestPackTo_OrderFileWarning(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"steps/.order":    "test\nbuild\nmissing\n",
+		"steps/build.yml": "run: make\n",
+		"steps/test.yml":  "run: make test\n",
+	})
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{Dir: dir, Mode: ModePreserve, OrderPrefixes: true})
+	if err != nil {
+		t.Fatalf("PackTo() error = %v", err)
+	}
+	if want := "steps:\n  test:\n    run: make test\n  build:\n    run: make\n"; buf.String() != want {
+		t.Errorf("PackTo() wrote %q, want %q", buf.String(), want)
+	}
+	warnings := []Warning{{
+		Kind:    WarningOrderEntry,
+		Message: filepath.Join(dir, "steps", ".order") + ` lists "missing", which matches no packed file or directory`,
+		Sources: []SourceLocation{{File: "steps/.order"}},
+	}}
+	if !reflect.DeepEqual(result.Warnings, warnings) {
+		t.Errorf("Warnings = %+v, want %+v", result.Warnings, warnings)
+	}
+}
+
+func TestPackTo_IncludedFiles(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"app/config.yml":    "db: !include ../shared/db.yml.inc\nbanner: !include-text ../shared/banner.txt\n",
+		"app/other.yml":     "db: !include ../shared/db.yml.inc\n",
+		"shared/db.yml.inc": "host: localhost\n",
+		"shared/banner.txt": "hello\n",
+	})
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{Dir: dir, EnableIncludes: true})
+	if err != nil {
+		t.Fatalf("PackTo() error = %v", err)
+	}
+	files := []string{"app/config.yml", "shared/db.yml.inc", "shared/banner.txt", "app/other.yml"}
+	if !reflect.DeepEqual(result.Files, files) {
+		t.Errorf("Files = %v, want %v", result.Files, files)
+	}
+}
+
+func TestPackTo_EmptyOutput(t *testing.T) {
+	dir := createTestDir(t, map[string]string{"empty.yml": ""})
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{Dir: dir, Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("PackTo() error = %v", err)
+	}
+	if buf.String() != "null\n" {
+		t.Errorf("PackTo() wrote %q, want %q", buf.String(), "null\n")
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Kind != WarningEmptyOutput {
+		t.Errorf("Warnings = %+v, want one %s warning", result.Warnings, WarningEmptyOutput)
+	}
+	if want := []SkippedFile{{Path: "empty.yml", Reason: SkipEmpty}}; !reflect.DeepEqual(result.Skipped, want) {
+		t.Errorf("Skipped = %v, want %v", result.Skipped, want)
+	}
+	if !strings.HasPrefix(result.Digest, "sha256:") {
+		t.Errorf("Digest = %q, want sha256 digest", result.Digest)
+	}
+}
+
+func TestPackTo_Error(t *testing.T) {
+	dir := createTestDir(t, map[string]string{"bad.yml": "key: [unclosed"})
+
+	var buf bytes.Buffer
+	result, err := PackTo(context.Background(), &buf, PackOptions{Dir: dir})
+	if err == nil {
+		t.Fatal("PackTo() expected error for invalid YAML")
+	}
+	if result != nil || buf.Len() != 0 {
+		t.Errorf("PackTo() = %v and wrote %q on error, want nothing", result, buf.String())
+	}
+}
+
+func TestPack_ParseError(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"config.yml": "key: [unclosed",
+	})
+
+	_, err := Pack(context.Background(), testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeShallow))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Pack() error = %v, want *ParseError", err)
+	}
+	if parseErr.File != filepath.Join(dir, "config.yml") || parseErr.Line != 1 {
+		t.Errorf("ParseError = %+v, want config.yml at line 1", parseErr)
+	}
+}
+
+func TestPack_IncludeError(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"shared/defaults.yml": "timeout: !include missing.yml",
+		"config.yml":          "defaults: !include shared/defaults.yml",
+	})
+
+	_, err := Pack(context.Background(), testOpts(dir, FormatYAML, true, false, ModeCanonical, MergeShallow))
+	var includeErr *IncludeError
+	if !errors.As(err, &includeErr) {
+		t.Fatalf("Pack() error = %v, want *IncludeError", err)
+	}
+	if includeErr.File != filepath.Join(dir, "config.yml") {
+		t.Errorf("File = %q, want the including file", includeErr.File)
+	}
+	if includeErr.Target != "missing.yml" || !reflect.DeepEqual(includeErr.Chain, []string{"shared/defaults.yml"}) {
+		t.Errorf("IncludeError = %+v, want missing.yml via shared/defaults.yml", includeErr)
+	}
+}
+
+func TestPack_StructureError(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/list.yml": "- one\n- two",
+	})
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			_, err := Pack(context.Background(), testOpts(dir, FormatYAML, false, false, mode, MergeShallow))
+			var structErr *StructureError
+			if !errors.As(err, &structErr) {
+				t.Fatalf("Pack() error = %v, want *StructureError", err)
+			}
+			if structErr.GotKind != "sequence" || !reflect.DeepEqual(structErr.KeyPath, []string{"jobs", "list"}) {
+				t.Errorf("StructureError = %+v, want sequence at [jobs list]", structErr)
+			}
+		})
+	}
+}
+
+func TestPack_CollectErrors(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/broken.yml": "key: [unclosed",
+		"jobs/list.yml":   "- one",
+		"jobs/good.yml":   "key: value",
+	})
+
+	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeShallow)
+	opts.CollectErrors = true
+	result, err := Pack(context.Background(), opts)
+	if err == nil {
+		t.Fatalf("Pack() = %q, want an error", result)
+	}
+
+	var parseErr *ParseError
+	var structErr *StructureError
+	if !errors.As(err, &parseErr) || !errors.As(err, &structErr) {
+		t.Errorf("Pack() error = %v, want both a *ParseError and a *StructureError", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"entities/item1.yml": "# the first item\nid: example1\nname: one\n",
+		"entities/item2.yml": "id: example2\n",
+	})
+
+	t.Run("canonical", func(t *testing.T) {
+		doc, err := Build(context.Background(), PackOptions{Dir: dir})
+		if err != nil {
+			t.Fatalf("Build() error = %v", err)
+		}
+		root, ok := doc.(map[interface{}]interface{})
+		if !ok {
+			t.Fatalf("Build() = %T, want map[interface{}]interface{}", doc)
+		}
+		entities, ok := root["entities"].(map[interface{}]interface{})
+		if !ok {
+			t.Fatalf("entities = %T, want map[interface{}]interface{}", root["entities"])
+		}
+		item1, ok := entities["item1"].(map[interface{}]interface{})
+		if !ok || item1["id"] != "example1" {
+			t.Errorf("entities.item1 = %v, want id example1", entities["item1"])
+		}
+	})
+
+	t.Run("preserve", func(t *testing.T) {
+		doc, err := Build(context.Background(), PackOptions{Dir: dir, Mode: ModePreserve})
+		if err != nil {
+			t.Fatalf("Build() error = %v", err)
+		}
+		node, ok := doc.(*yaml.Node)
+		if !ok {
+			t.Fatalf("Build() = %T, want *yaml.Node", doc)
+		}
+		if node.Kind != yaml.MappingNode || node.Content[0].Value != "entities" {
+			t.Fatalf("Build() = %v, want a mapping with key entities", node.Kind)
+		}
+		item1 := node.Content[1].Content[1]
+		if item1.Content[0].HeadComment != "# the first item" {
+			t.Errorf("item1 head comment = %q, want it preserved", item1.Content[0].HeadComment)
+		}
+	})
+}
+
+func TestBuild_EmptyDirectory(t *testing.T) {
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		doc, err := Build(context.Background(), PackOptions{Dir: t.TempDir(), Mode: mode})
+		if err != nil {
+			t.Fatalf("Build() error = %v", err)
+		}
+		if doc != nil {
+			t.Errorf("Build() in %s mode = %#v, want nil", mode, doc)
+		}
+	}
+}
+
+func TestBuild_InvalidOptions(t *testing.T) {
+	_, err := Build(context.Background(), PackOptions{})
+	if !errors.Is(err, ErrDirectoryRequired) {
+		t.Errorf("Build() error = %v, want ErrDirectoryRequired", err)
+	}
+	_, err = Build(context.Background(), PackOptions{Dir: t.TempDir(), Mode: "invalid"})
+	if !errors.Is(err, ErrInvalidMode) {
+		t.Errorf("Build() error = %v, want ErrInvalidMode", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"entities/item1.yml": "# the first item\nid: example1\nname: one\n",
+		"@root.yml":          "version: 2\n",
+	})
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		for _, format := range []Format{FormatYAML, FormatJSON} {
+			t.Run(string(mode)+"/"+string(format), func(t *testing.T) {
+				opts := PackOptions{Dir: dir, Mode: mode, Format: format, Indent: 4}
+				doc, err := Build(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("Build() error = %v", err)
+				}
+				got, err := Encode(doc, format, 4)
+				if err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+				want, err := Pack(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("Pack() error = %v", err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("Encode() = %q, want Pack() output %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestEncode_Defaults(t *testing.T) {
+	got, err := Encode(map[string]interface{}{"a": map[string]interface{}{"b": 1}}, "", 0)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if string(got) != "a:\n  b: 1\n" {
+		t.Errorf("Encode() = %q, want 2-space YAML", got)
+	}
+}
+
+func TestEncode_Empty(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatYAML, ""},
+		{FormatJSON, "null\n"},
+	}
+	for _, tt := range tests {
+		got, err := Encode(nil, tt.format, 2)
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Encode(nil, %s) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestEncode_InvalidOptions(t *testing.T) {
+	_, err := Encode(nil, "xml", 2)
+	if !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Encode() error = %v, want ErrInvalidFormat", err)
+	}
+	_, err = Encode(nil, FormatYAML, -1)
+	if !errors.Is(err, ErrInvalidIndent) {
+		t.Errorf("Encode() error = %v, want ErrInvalidIndent", err)
+	}
+}
+
+func TestPack_ConvertBooleans(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"config.yml": `enabled: on
+active: yes`,
+	})
+
+	result, err := Pack(context.Background(), testOpts(dir, FormatYAML, false, true, ModeCanonical, MergeShallow))
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	resultStr := string(result)
+	// Boolean conversion should convert on/yes to true
+	if strings.Contains(resultStr, "enabled: on") {
+		t.Error("Boolean conversion should convert 'on' to 'true'")
+	}
+	if strings.Contains(resultStr, "active: yes") {
+		t.Error("Boolean conversion should convert 'yes' to 'true'")
+	}
+	if !strings.Contains(resultStr, "enabled: true") {
+		t.Error("Result should contain 'enabled: true'")
+	}
+	if !strings.Contains(resultStr, "active: true") {
+		t.Error("Result should contain 'active: true'")
+	}
+}
+
+func TestPack_CustomIndent(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"test.yml": `key:
+  nested: value`,
+	})
+
+	opts := testOpts(dir, FormatYAML, false, false, ModeCanonical, MergeShallow)
+	opts.Indent = 4
+
+	result, err := Pack(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+
+	// Verify indentation (4 spaces instead of 2)
+	resultStr := string(result)
+	lines := strings.Split(resultStr, "\n")
+	found4SpaceIndent := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "    nested:") {
+			found4SpaceIndent = true
+			break
+		}
+	}
+	if !found4SpaceIndent {
+		t.Error("Custom indent of 4 should be used")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Format
+		wantErr bool
+		errType error
+	}{
+		{"yaml", "yaml", FormatYAML, false, nil},
+		{"json", "json", FormatJSON, false, nil},
+		{"toml", "toml", FormatTOML, false, nil},
+		{"properties", "properties", FormatProperties, false, nil},
+		{"dotenv", "dotenv", FormatDotenv, false, nil},
+		{"env-file", "env-file", FormatEnvFile, false, nil},
+		{"invalid", "invalid", "", true, ErrInvalidFormat},
+		{"empty", "", "", true, ErrInvalidFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormat(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseFormat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat() = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr && !errors.Is(err, tt.errType) {
+				t.Errorf("ParseFormat() error = %v, want %v", err, tt.errType)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Mode
+		wantErr bool
+		errType error
+	}{
+		{"canonical", "canonical", ModeCanonical, false, nil},
+		{"preserve", "preserve", ModePreserve, false, nil},
+		{"invalid", "invalid", "", true, ErrInvalidMode},
+		{"empty", "", "", true, ErrInvalidMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode() = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr && !errors.Is(err, tt.errType) {
+				t.Errorf("ParseMode() error = %v, want %v", err, tt.errType)
+			}
+		})
+	}
+}
+
+func TestParseMergeStrategy(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    MergeStrategy
+		wantErr bool
+		errType error
+	}{
+		{"shallow", "shallow", MergeShallow, false, nil},
+		{"deep", "deep", MergeDeep, false, nil},
+		{"strict", "strict", MergeStrict, false, nil},
+		{"invalid", "invalid", "", true, ErrInvalidMergeStrategy},
+		{"empty", "", "", true, ErrInvalidMergeStrategy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMergeStrategy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMergeStrategy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseMergeStrategy() = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr && !errors.Is(err, tt.errType) {
+				t.Errorf("ParseMergeStrategy() error = %v, want %v", err, tt.errType)
+			}
+		})
+	}
+}
+
+func TestParseSequenceMerge(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    SequenceMerge
+		wantErr bool
+	}{
+		{"replace", SequenceReplace, false},
+		{"append", SequenceAppend, false},
+		{"append-unique", SequenceAppendUnique, false},
+		{"invalid", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSequenceMerge(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSequenceMerge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseSequenceMerge() = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidSequenceMerge) {
+				t.Errorf("ParseSequenceMerge() error = %v, want %v", err, ErrInvalidSequenceMerge)
+			}
+		})
+	}
+}
+
+func TestCheck_Matching(t *testing.T) {
+	generated := []byte("key: value\n")
+	expected := []byte("key: value\n")
+
+	err := Check(generated, expected, CheckOptions{Format: FormatYAML})
+	if err != nil {
+		t.Errorf("Check() with matching content should not return error, got: %v", err)
+	}
+}
+
+func TestCheck_Mismatch(t *testing.T) {
+	generated := []byte("key: value\n")
+	expected := []byte("key: different\n")
+
+	err := Check(generated, expected, CheckOptions{Format: FormatYAML})
+	if err == nil {
+		t.Error("Check() with mismatched content should return error")
+	}
+	if !errors.Is(err, ErrCheckMismatch) {
+		t.Errorf("Check() should return ErrCheckMismatch, got: %v", err)
+	}
+}
+
+func TestCheck_EmptyYAML(t *testing.T) {
+	// Empty YAML output is empty bytes
+	generated := []byte{}
+	expected := []byte{}
+
+	err := Check(generated, expected, CheckOptions{Format: FormatYAML})
+	if err != nil {
+		t.Errorf("Check() with empty YAML should not return error, got: %v", err)
+	}
+}
+
+func TestCheck_EmptyJSON(t *testing.T) {
+	// Empty JSON output is normalized to "null\n"
+	generated := []byte("null\n")
+	expected := []byte{} // Empty
+
+	err := Check(generated, expected, CheckOptions{Format: FormatJSON})
+	if err != nil {
+		t.Errorf("Check() with empty JSON (normalized) should not return error, got: %v", err)
+	}
+}
 
 func TestCheck_EmptyJSONMismatch(t *testing.T) {
 	// If generated is not "null\n" but expected is empty, should mismatch
@@ -557,3 +1683,66 @@ func TestCheck_JSONFormat(t *testing.T) {
 		t.Errorf("Check() with matching JSON should not return error, got: %v", err)
 	}
 }
+
+func TestUnpack_RoundTrip(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/build.yml": "steps: [checkout, make]\n",
+		"jobs/test.yml":  "steps: [checkout, make test]\n",
+		"@version.yml":   "version: 2\n",
+	})
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			packed, err := Pack(context.Background(), PackOptions{Dir: dir, Mode: mode})
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+
+			out := filepath.Join(t.TempDir(), "out")
+			if err := Unpack(context.Background(), packed, UnpackOptions{Dir: out, Mode: mode, Depth: 2}); err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+
+			repacked, err := Pack(context.Background(), PackOptions{Dir: out, Mode: mode})
+			if err != nil {
+				t.Fatalf("Pack() error = %v", err)
+			}
+			if string(repacked) != string(packed) {
+				t.Errorf("repacked output = %q, want %q", string(repacked), string(packed))
+			}
+			if _, err := os.Stat(filepath.Join(out, "jobs", "build.yml")); err != nil {
+				t.Errorf("expected jobs/build.yml to be written: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnpack_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    UnpackOptions
+		wantErr error
+	}{
+		{"missing dir", UnpackOptions{}, ErrDirectoryRequired},
+		{"invalid mode", UnpackOptions{Dir: "out", Mode: "invalid"}, ErrInvalidMode},
+		{"invalid depth", UnpackOptions{Dir: "out", Depth: -1}, ErrInvalidDepth},
+		{"invalid indent", UnpackOptions{Dir: "out", Indent: -1}, ErrInvalidIndent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unpack(context.Background(), []byte("a: 1"), tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Unpack() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnpack_MultipleDocuments(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	err := Unpack(context.Background(), []byte("a: 1\n---\nb: 2\n"), UnpackOptions{Dir: out})
+	if err == nil || !strings.Contains(err.Error(), "multiple documents") {
+		t.Errorf("Unpack() error = %v, want multiple documents error", err)
+	}
+}
@@ -1,10 +1,12 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -21,7 +23,8 @@ DIR defaults to the current working directory if not specified.
 The output is deterministic - identical directory structures always produce
 identical output, with keys sorted alphabetically.
 
-By default, output is YAML. Use --format json to output JSON instead.
+By default, output is YAML. Use --format json or --format toml to output JSON or TOML instead,
+or --format properties, dotenv or env-file for flat key/value files.
 
 Use --enable-includes to process <<include(file)>> directives.
 
@@ -38,6 +41,47 @@ func init() {
 	// available to packCmd. No need to define them here.
 }
 
+// parseListMergeKeysByPath parses --list-merge-key-at values of the form
+// PATH=KEY[,KEY...]. An empty key list turns keyed merging off at PATH.
+func parseListMergeKeysByPath(values []string) (map[string][]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	byPath := make(map[string][]string, len(values))
+	for _, v := range values {
+		p, keys, ok := strings.Cut(v, "=")
+		if !ok || p == "" {
+			return nil, fmt.Errorf("invalid --list-merge-key-at %q (must be PATH=KEY[,KEY...])", v)
+		}
+		byPath[p] = []string{}
+		for _, k := range strings.Split(keys, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				byPath[p] = append(byPath[p], k)
+			}
+		}
+	}
+	return byPath, nil
+}
+
+// writeOverrideReport writes a summary of the keys overridden while packing.
+func writeOverrideReport(w io.Writer, result *fyaml.PackResult) {
+	var overrides []fyaml.Warning
+	for _, warning := range result.Warnings {
+		if warning.Kind == fyaml.WarningOverride {
+			overrides = append(overrides, warning)
+		}
+	}
+
+	if len(overrides) == 0 {
+		_, _ = fmt.Fprintln(w, "No keys overridden")
+		return
+	}
+	_, _ = fmt.Fprintf(w, "Overridden keys (%d):\n", len(overrides))
+	for _, o := range overrides {
+		_, _ = fmt.Fprintf(w, "  %s: %s -> %s\n", strings.Join(o.Path, "."), o.Sources[0], o.Sources[1])
+	}
+}
+
 // handleCheck compares the generated output with an existing file or stdin.
 // Returns an error if the file cannot be read (except if it doesn't exist).
 // Returns ErrCheckMismatch if the contents don't match.
@@ -84,6 +128,18 @@ func handleCheck(output string, result []byte, format string) error {
 	})
 }
 
+// writeSourceMap writes m as indented JSON to path (atomically).
+func writeSourceMap(path string, m *fyaml.SourceMap) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode source map: %w", err)
+	}
+	if err := writeOutput(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write source map: %w", err)
+	}
+	return nil
+}
+
 // writeOutput writes the result to a file (atomically) or stdout.
 func writeOutput(output string, result []byte) error {
 	if output == "" {
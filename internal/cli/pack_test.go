@@ -7,6 +7,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -158,6 +159,24 @@ func TestPack_ArrayFile(t *testing.T) {
 	assertErrorContains(t, err, "expected a map")
 }
 
+func TestPack_ArrayFile_AllowNonMapFiles(t *testing.T) {
+	// A root file merges into the document, so it must hold a map even when
+	// named files may hold other values
+	opts := testOpts("../../testdata/array-file/input", "yaml", false, false)
+	opts.AllowNonMapFiles = true
+	_, err := fyaml.Pack(context.Background(), opts)
+	assertErrorContains(t, err, "which merges into its parent map")
+
+	dir := createTestDir(t, map[string]string{"config/items.yml": "- item1\n- item2\n"}, nil)
+	opts = testOpts(dir, "yaml", false, false)
+	opts.AllowNonMapFiles = true
+	result, err := fyaml.Pack(context.Background(), opts)
+	assertNoError(t, err)
+	if want := "config:\n  items:\n    - item1\n    - item2\n"; string(result) != want {
+		t.Errorf("Pack() = %q, want %q", result, want)
+	}
+}
+
 func TestPack_Golden_Canonical(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1128,6 +1147,18 @@ func TestPack_DeepMerge_Preserve(t *testing.T) {
 	}
 }
 
+func TestPack_StrictMerge_Conflict(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"jobs/build.yml":   "image: node\n",
+		"jobs/@shared.yml": "build:\n  image: golang\n",
+	}, nil)
+
+	opts := testOpts(tmpDir, "yaml", false, false)
+	opts.MergeStrategy = fyaml.MergeStrict
+	_, err := fyaml.Pack(context.Background(), opts)
+	assertErrorContains(t, err, "conflicting values for key jobs.build.image in jobs/@shared.yml:2:3 and jobs/build.yml:1:1")
+}
+
 func TestPack_ShallowMerge_Default(t *testing.T) {
 	// Test that default (shallow) merge replaces entire nested maps
 	tmpDir := createTestDir(t, map[string]string{
@@ -1232,3 +1263,21 @@ string_key: string value`,
 		t.Errorf("String key should be quoted in JSON. Got:\n%s", resultStr)
 	}
 }
+
+func TestParseListMergeKeysByPath(t *testing.T) {
+	got, err := parseListMergeKeysByPath([]string{"spec.containers=name", "spec.ports=containerPort, port", "spec.volumes="})
+	assertNoError(t, err)
+	want := map[string][]string{
+		"spec.containers": {"name"},
+		"spec.ports":      {"containerPort", "port"},
+		"spec.volumes":    {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseListMergeKeysByPath() = %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"spec.containers", "=name"} {
+		_, err := parseListMergeKeysByPath([]string{invalid})
+		assertErrorContains(t, err, "must be PATH=KEY[,KEY...]")
+	}
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -29,6 +30,24 @@ var (
 	indent          int
 	mode            string
 	mergeStrategy   string
+	sourceMapFile   string
+	keepGoing       bool
+	allowIdentical  bool
+	reportOverrides bool
+	mergeSequences  string
+	listMergeKeys   []string
+	listMergeKeysAt []string
+	includePaths    []string
+	excludePaths    []string
+	allowNonMap     bool
+	multiDocument   string
+	documents       bool
+	documentsAt     string
+	orderPrefixes   bool
+	followSymlinks  bool
+	outsideLinks    string
+	textExtensions  []string
+	relaxedJSON     bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -46,6 +65,8 @@ Examples:
   fyaml                             # Pack current directory to stdout (YAML)
   fyaml -o out.yml                  # Pack current directory to file
   fyaml --format json               # Output as JSON
+  fyaml --format toml               # Output as TOML
+  fyaml --format dotenv -o app.env  # Output as flat KEY=value lines
   fyaml -o out.yml --check          # Verify output matches file
   fyaml --check < expected.yml      # Verify output matches stdin
   fyaml --check --output - < expected.yml  # Same as above (explicit)
@@ -80,6 +101,26 @@ Examples:
 			return err
 		}
 
+		parsedSequenceMerge, err := fyaml.ParseSequenceMerge(mergeSequences)
+		if err != nil {
+			return err
+		}
+
+		parsedMultiDocument, err := fyaml.ParseMultiDocument(multiDocument)
+		if err != nil {
+			return err
+		}
+
+		parsedOutsideLinks, err := fyaml.ParseSymlinkPolicy(outsideLinks)
+		if err != nil {
+			return err
+		}
+
+		listMergeKeysByPath, err := parseListMergeKeysByPath(listMergeKeysAt)
+		if err != nil {
+			return err
+		}
+
 		if indent < 1 {
 			return fmt.Errorf("invalid indent: %d (must be at least 1)", indent)
 		}
@@ -96,21 +137,52 @@ Examples:
 
 		// Build PackOptions from flags
 		opts := fyaml.PackOptions{
-			Dir:             targetDir,
-			Format:          parsedFormat,
-			Mode:            parsedMode,
-			MergeStrategy:   parsedMergeStrategy,
-			EnableIncludes:  enableIncludes,
-			ConvertBooleans: convertBooleans,
-			Indent:          indent,
-			Logger:          log,
+			Dir:                      targetDir,
+			Include:                  includePaths,
+			Exclude:                  excludePaths,
+			OrderPrefixes:            orderPrefixes,
+			FollowSymlinks:           followSymlinks,
+			SymlinksOutsideRoot:      parsedOutsideLinks,
+			TextExtensions:           textExtensions,
+			Format:                   parsedFormat,
+			Mode:                     parsedMode,
+			MergeStrategy:            parsedMergeStrategy,
+			EnableIncludes:           enableIncludes,
+			SequenceMerge:            parsedSequenceMerge,
+			AllowIdenticalDuplicates: allowIdentical,
+			ListMergeKeys:            listMergeKeys,
+			ListMergeKeysByPath:      listMergeKeysByPath,
+			AllowNonMapFiles:         allowNonMap,
+			MultiDocument:            parsedMultiDocument,
+			Documents:                documents,
+			DocumentsPath:            documentsAt,
+			ConvertBooleans:          convertBooleans,
+			RelaxedJSON:              relaxedJSON,
+			Indent:                   indent,
+			CollectErrors:            keepGoing,
+			Logger:                   log,
+		}
+		if sourceMapFile != "" {
+			opts.SourceMap = &fyaml.SourceMap{}
 		}
 
 		// Call the public API
-		result, err := fyaml.Pack(context.Background(), opts)
+		var buf bytes.Buffer
+		packResult, err := fyaml.PackTo(context.Background(), &buf, opts)
 		if err != nil {
 			return fmt.Errorf("pack error: %w", err)
 		}
+		result := buf.Bytes()
+
+		if reportOverrides {
+			writeOverrideReport(cmd.ErrOrStderr(), packResult)
+		}
+
+		if sourceMapFile != "" {
+			if err := writeSourceMap(sourceMapFile, opts.SourceMap); err != nil {
+				return err
+			}
+		}
 
 		if check {
 			return handleCheck(output, result, format)
@@ -138,23 +210,60 @@ func init() {
 		"Write output to file, or '-' for stdin when used with --check (default: stdout)")
 	rootCmd.PersistentFlags().BoolVarP(&check, "check", "c", false,
 		"Compare generated output to --output file or stdin (if --output omitted or set to '-'), exit non-zero if different")
+	rootCmd.PersistentFlags().StringArrayVar(&includePaths, "include-path", nil,
+		"Only pack files matching this glob, relative to the pack directory ('**' matches across directories); repeatable")
+	rootCmd.PersistentFlags().StringArrayVar(&excludePaths, "exclude-path", nil,
+		"Leave out files and directories matching this glob, relative to the pack directory; repeatable")
+	rootCmd.PersistentFlags().BoolVar(&orderPrefixes, "order-prefixes", false,
+		"Strip numeric ordering prefixes such as 010- from file and directory keys, read prefixed files first in prefix order, and apply .order files")
+	rootCmd.PersistentFlags().BoolVar(&followSymlinks, "follow-symlinks", false,
+		"Walk symlinked directories as if they were in place, skipping links to a directory that contains them")
+	rootCmd.PersistentFlags().StringVar(&outsideLinks, "symlinks-outside-root", "error",
+		"What to do with followed symlinks pointing outside the pack directory: error, skip or allow")
+	rootCmd.PersistentFlags().StringSliceVar(&textExtensions, "text-extension", nil,
+		"Pack files with this extension (e.g. .sh, .sql) as string values under their file name key; repeatable")
 	rootCmd.PersistentFlags().StringVarP(&format, "format", "f", "yaml",
-		"Output format: yaml or json (default: yaml)")
+		"Output format: yaml, json, toml, properties, dotenv or env-file (default: yaml)")
+	rootCmd.PersistentFlags().BoolVar(&documents, "documents", false,
+		"Write each top-level value as a separate document: YAML separated by ---, or JSON Lines")
+	rootCmd.PersistentFlags().StringVar(&documentsAt, "documents-at", "",
+		"Like --documents, but for the values or items at this dot-separated key path")
 	rootCmd.PersistentFlags().BoolVar(&enableIncludes, "enable-includes", false,
 		"Process <<include(file)>> directives (extension)")
 	rootCmd.PersistentFlags().BoolVar(&convertBooleans, "convert-booleans", false,
 		"Convert unquoted YAML 1.1 boolean values (on/off, yes/no) to true/false")
+	rootCmd.PersistentFlags().BoolVar(&relaxedJSON, "relaxed-json", false,
+		"Read .json files like .jsonc and .json5 files, allowing comments and trailing commas")
 	rootCmd.PersistentFlags().IntVar(&indent, "indent", 2,
 		"Number of spaces for indentation")
 	rootCmd.PersistentFlags().StringVarP(&mode, "mode", "m", "canonical",
 		"Output mode: 'canonical' (sorted keys, no comments) or 'preserve' (authored order and comments)")
 	rootCmd.PersistentFlags().StringVar(&mergeStrategy, "merge", "shallow",
-		"Merge strategy: 'shallow' (last wins) or 'deep' (recursive)")
+		"Merge strategy: 'shallow' (last wins), 'deep' (recursive) or 'strict' (recursive, error on conflicting keys)")
+	rootCmd.PersistentFlags().StringVar(&mergeSequences, "merge-sequences", "replace",
+		"Sequence merging: 'replace' (last wins), 'append' (concatenate in file order) or 'append-unique' (append, skipping duplicate items)")
+	rootCmd.PersistentFlags().StringSliceVar(&listMergeKeys, "list-merge-key", nil,
+		"With --merge deep or strict, merge list items that share this identity key (e.g. name); repeatable")
+	rootCmd.PersistentFlags().StringArrayVar(&listMergeKeysAt, "list-merge-key-at", nil,
+		"Identity keys for the lists at a key path, as PATH=KEY[,KEY...] ('*' matches any key); repeatable")
+	rootCmd.PersistentFlags().BoolVar(&allowIdentical, "allow-identical-duplicates", false,
+		"With --merge strict, allow files to repeat a key with the same value")
+	rootCmd.PersistentFlags().BoolVar(&allowNonMap, "allow-non-map-files", false,
+		"Let a file named by its key hold a scalar or sequence as the key's value (not @ or root files)")
+	rootCmd.PersistentFlags().StringVar(&multiDocument, "multi-document", "error",
+		"Files with several YAML documents: error, merge (in order) or sequence (one item per document)")
+	rootCmd.PersistentFlags().BoolVar(&reportOverrides, "report-overrides", false,
+		"Print a summary of every key overridden by a later file to stderr")
+	rootCmd.PersistentFlags().StringVar(&sourceMapFile, "source-map", "",
+		"Write the source file, line and column of every output key to this file as JSON")
+	rootCmd.PersistentFlags().BoolVar(&keepGoing, "keep-going", false,
+		"Report every broken file instead of stopping at the first")
 
 	// Version flag
 	rootCmd.Flags().BoolP("version", "V", false,
 		"Print version information and exit")
 
 	rootCmd.AddCommand(packCmd)
+	rootCmd.AddCommand(unpackCmd)
 	rootCmd.AddCommand(versionCmd)
 }
@@ -2,7 +2,10 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -188,6 +191,63 @@ func TestRootCmd_InvalidMergeStrategy(t *testing.T) {
 	}
 }
 
+func TestRootCmd_InvalidSequenceMerge(t *testing.T) {
+	// Save and restore original flag values
+	originalFormat := format
+	originalMode := mode
+	originalMergeStrategy := mergeStrategy
+	originalMergeSequences := mergeSequences
+	originalDir := dir
+	t.Cleanup(func() {
+		format = originalFormat
+		mode = originalMode
+		mergeStrategy = originalMergeStrategy
+		mergeSequences = originalMergeSequences
+		dir = originalDir
+	})
+
+	format = "yaml"
+	mode = "canonical"
+	mergeStrategy = "deep"
+	mergeSequences = "invalid"
+	dir = t.TempDir()
+
+	err := rootCmd.RunE(rootCmd, nil)
+	if !errors.Is(err, fyaml.ErrInvalidSequenceMerge) {
+		t.Errorf("expected ErrInvalidSequenceMerge, got: %v", err)
+	}
+}
+
+func TestRootCmd_InvalidSymlinkPolicy(t *testing.T) {
+	// Save and restore original flag values
+	originalFormat := format
+	originalMode := mode
+	originalMergeStrategy := mergeStrategy
+	originalMergeSequences := mergeSequences
+	originalOutsideLinks := outsideLinks
+	originalDir := dir
+	t.Cleanup(func() {
+		format = originalFormat
+		mode = originalMode
+		mergeStrategy = originalMergeStrategy
+		mergeSequences = originalMergeSequences
+		outsideLinks = originalOutsideLinks
+		dir = originalDir
+	})
+
+	format = "yaml"
+	mode = "canonical"
+	mergeStrategy = "shallow"
+	mergeSequences = "replace"
+	outsideLinks = "follow"
+	dir = t.TempDir()
+
+	err := rootCmd.RunE(rootCmd, nil)
+	if !errors.Is(err, fyaml.ErrInvalidSymlinkPolicy) {
+		t.Errorf("expected ErrInvalidSymlinkPolicy, got: %v", err)
+	}
+}
+
 func TestRootCmd_InvalidIndent(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -278,3 +338,287 @@ func TestRootCmd_ValidFlags(t *testing.T) {
 		}
 	}
 }
+
+func TestRootCmd_SourceMap(t *testing.T) {
+	// Save and restore original flag values
+	originalFormat := format
+	originalMode := mode
+	originalMergeStrategy := mergeStrategy
+	originalIndent := indent
+	originalDir := dir
+	originalOutput := output
+	originalSourceMapFile := sourceMapFile
+	t.Cleanup(func() {
+		format = originalFormat
+		mode = originalMode
+		mergeStrategy = originalMergeStrategy
+		indent = originalIndent
+		dir = originalDir
+		output = originalOutput
+		sourceMapFile = originalSourceMapFile
+	})
+
+	format = "yaml"
+	mode = "canonical"
+	mergeStrategy = "shallow"
+	indent = 2
+	dir = createTestDir(t, map[string]string{"jobs/build.yml": "image: x\n"}, nil)
+	output = filepath.Join(t.TempDir(), "out.yml")
+	sourceMapFile = filepath.Join(t.TempDir(), "out.map.json")
+
+	assertNoError(t, rootCmd.RunE(rootCmd, nil))
+
+	data, err := os.ReadFile(sourceMapFile)
+	assertNoError(t, err)
+	var got fyaml.SourceMap
+	assertNoError(t, json.Unmarshal(data, &got))
+
+	var paths []string
+	for _, e := range got.Entries {
+		paths = append(paths, strings.Join(e.Path, "."))
+	}
+	if strings.Join(paths, ",") != "jobs,jobs.build,jobs.build.image" {
+		t.Errorf("source map paths = %v", paths)
+	}
+	last := got.Entries[len(got.Entries)-1].Sources
+	if len(last) != 1 || last[0] != (fyaml.SourceLocation{File: "jobs/build.yml", Line: 1, Column: 1}) {
+		t.Errorf("jobs.build.image sources = %+v", last)
+	}
+}
+
+func TestRootCmd_KeepGoing(t *testing.T) {
+	// Save and restore original flag values
+	originalFormat := format
+	originalMode := mode
+	originalMergeStrategy := mergeStrategy
+	originalIndent := indent
+	originalDir := dir
+	originalOutput := output
+	originalKeepGoing := keepGoing
+	t.Cleanup(func() {
+		format = originalFormat
+		mode = originalMode
+		mergeStrategy = originalMergeStrategy
+		indent = originalIndent
+		dir = originalDir
+		output = originalOutput
+		keepGoing = originalKeepGoing
+	})
+
+	format = "yaml"
+	mode = "canonical"
+	mergeStrategy = "shallow"
+	indent = 2
+	dir = createTestDir(t, map[string]string{
+		"a/broken.yml": "key: [unclosed",
+		"b/broken.yml": "key: {unclosed",
+	}, nil)
+	output = filepath.Join(t.TempDir(), "out.yml")
+	keepGoing = true
+
+	err := rootCmd.RunE(rootCmd, nil)
+	assertErrorContains(t, err, filepath.Join("a", "broken.yml"))
+	assertErrorContains(t, err, filepath.Join("b", "broken.yml"))
+	if _, statErr := os.Stat(output); !os.IsNotExist(statErr) {
+		t.Errorf("output should not be written when errors occur, stat error = %v", statErr)
+	}
+}
+
+func TestRootCmd_ReportOverrides(t *testing.T) {
+	// Save and restore original flag values
+	originalFormat := format
+	originalMode := mode
+	originalMergeStrategy := mergeStrategy
+	originalIndent := indent
+	originalDir := dir
+	originalOutput := output
+	originalReportOverrides := reportOverrides
+	originalLog := log
+	t.Cleanup(func() {
+		format = originalFormat
+		mode = originalMode
+		mergeStrategy = originalMergeStrategy
+		indent = originalIndent
+		dir = originalDir
+		output = originalOutput
+		reportOverrides = originalReportOverrides
+		log = originalLog
+		rootCmd.SetErr(nil)
+	})
+
+	format = "yaml"
+	mode = "canonical"
+	mergeStrategy = "shallow"
+	indent = 2
+	output = filepath.Join(t.TempDir(), "out.yml")
+	reportOverrides = true
+	log = logger.Nop()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "overrides",
+			files: map[string]string{
+				"@a.yml": "name: a\nport: 80\n",
+				"@b.yml": "name: b\nport: 81\n",
+			},
+			want: "Overridden keys (2):\n" +
+				"  name: @a.yml:1:1 -> @b.yml:1:1\n" +
+				"  port: @a.yml:2:1 -> @b.yml:2:1\n",
+		},
+		{
+			name:  "no overrides",
+			files: map[string]string{"@a.yml": "name: a\n"},
+			want:  "No keys overridden\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			rootCmd.SetErr(&stderr)
+			dir = createTestDir(t, tt.files, nil)
+
+			assertNoError(t, rootCmd.RunE(rootCmd, nil))
+			if stderr.String() != tt.want {
+				t.Errorf("report = %q, want %q", stderr.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRootCmd_IncludeExcludePaths(t *testing.T) {
+	// Save and restore original flag values
+	originalFormat := format
+	originalMode := mode
+	originalMergeStrategy := mergeStrategy
+	originalIndent := indent
+	originalDir := dir
+	originalOutput := output
+	originalIncludePaths := includePaths
+	originalExcludePaths := excludePaths
+	originalLog := log
+	t.Cleanup(func() {
+		format = originalFormat
+		mode = originalMode
+		mergeStrategy = originalMergeStrategy
+		indent = originalIndent
+		dir = originalDir
+		output = originalOutput
+		includePaths = originalIncludePaths
+		excludePaths = originalExcludePaths
+		log = originalLog
+	})
+
+	format = "yaml"
+	mode = "canonical"
+	mergeStrategy = "shallow"
+	indent = 2
+	log = logger.Nop()
+	dir = createTestDir(t, map[string]string{
+		"services/api.yml":         "port: 80\n",
+		"services/beta/worker.yml": "port: 81\n",
+		"experimental/new.yml":     "port: 82\n",
+		"global.yml":               "name: app\n",
+	}, nil)
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    string
+	}{
+		{
+			name:    "exclude",
+			exclude: []string{"experimental/**"},
+			want:    "name: app\nservices:\n  api:\n    port: 80\n  beta:\n    worker:\n      port: 81\n",
+		},
+		{
+			name:    "include",
+			include: []string{"services/**"},
+			want:    "services:\n  api:\n    port: 80\n  beta:\n    worker:\n      port: 81\n",
+		},
+		{
+			name:    "include and exclude",
+			include: []string{"services"},
+			exclude: []string{"**/beta"},
+			want:    "services:\n  api:\n    port: 80\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			includePaths, excludePaths = tt.include, tt.exclude
+			output = filepath.Join(t.TempDir(), "out.yml")
+
+			assertNoError(t, rootCmd.RunE(rootCmd, nil))
+			got, err := os.ReadFile(output)
+			assertNoError(t, err)
+			if string(got) != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRootCmd_Documents(t *testing.T) {
+	// Save and restore original flag values
+	originalFormat := format
+	originalMode := mode
+	originalMergeStrategy := mergeStrategy
+	originalIndent := indent
+	originalDir := dir
+	originalOutput := output
+	originalDocuments := documents
+	originalDocumentsAt := documentsAt
+	originalLog := log
+	t.Cleanup(func() {
+		format = originalFormat
+		mode = originalMode
+		mergeStrategy = originalMergeStrategy
+		indent = originalIndent
+		dir = originalDir
+		output = originalOutput
+		documents = originalDocuments
+		documentsAt = originalDocumentsAt
+		log = originalLog
+	})
+
+	mode = "canonical"
+	mergeStrategy = "shallow"
+	indent = 2
+	log = logger.Nop()
+	dir = createTestDir(t, map[string]string{
+		"config/web.yml":    "kind: Service\n",
+		"config/worker.yml": "kind: Job\n",
+	}, nil)
+
+	tests := []struct {
+		name      string
+		format    string
+		documents bool
+		at        string
+		want      string
+	}{
+		{name: "yaml", format: "yaml", at: "config", want: "kind: Service\n---\nkind: Job\n"},
+		{name: "json lines", format: "json", at: "config", want: "{\"kind\":\"Service\"}\n{\"kind\":\"Job\"}\n"},
+		{name: "root", format: "yaml", documents: true, want: "web:\n  kind: Service\nworker:\n  kind: Job\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, documents, documentsAt = tt.format, tt.documents, tt.at
+			output = filepath.Join(t.TempDir(), "out")
+
+			assertNoError(t, rootCmd.RunE(rootCmd, nil))
+			got, err := os.ReadFile(output)
+			assertNoError(t, err)
+			if string(got) != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/jksmth/fyaml"
+)
+
+var (
+	// Unpack flags
+	depth      int
+	splitPaths []string
+)
+
+// unpackRootFlags are the root command's persistent flags that apply to
+// unpack; the others configure packing and are rejected.
+var unpackRootFlags = map[string]bool{
+	"output":  true,
+	"mode":    true,
+	"indent":  true,
+	"verbose": true,
+}
+
+var unpackCmd = &cobra.Command{
+	Use:   "unpack [FILE] -o DIR",
+	Short: "Split a single YAML/JSON document into a directory tree",
+	Long: `Unpack splits a single YAML/JSON document into an FYAML directory tree.
+
+This is the inverse of pack: map values become directories or files named after
+their keys, and values that cannot be written as their own file are kept in an
+@ file that merges into their parent. Packing the tree with the same --mode
+produces the same output as the original document.
+
+FILE defaults to stdin if not specified or set to '-'. --output names the
+directory to create, which must not exist or be empty.
+
+Use --depth to choose how many key levels are split, and --split to split
+specific key paths further. In preserve mode, comments and key order are kept;
+where the order is not alphabetical, a .order file records it, and the tree must
+be packed with --order-prefixes.
+
+Pack flags such as --merge or --include-path do not apply and are rejected.
+
+Examples:
+  fyaml unpack config.yml -o config/                 # One file per top-level key
+  fyaml unpack config.yml -o config/ --depth 2       # Top-level maps become directories
+  fyaml unpack openapi.yml -o api/ --split components.schemas
+  fyaml unpack -m preserve ci.yml -o ci/ --split jobs`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := rejectPackFlags(cmd); err != nil {
+			return err
+		}
+
+		parsedMode, err := fyaml.ParseMode(mode)
+		if err != nil {
+			return err
+		}
+
+		if output == "" || output == "-" {
+			return fmt.Errorf("unpack requires --output DIR")
+		}
+
+		if indent < 1 {
+			return fmt.Errorf("invalid indent: %d (must be at least 1)", indent)
+		}
+
+		input := "-"
+		if len(args) > 0 {
+			input = args[0]
+		}
+
+		data, err := readInput(input)
+		if err != nil {
+			return err
+		}
+
+		err = fyaml.Unpack(context.Background(), data, fyaml.UnpackOptions{
+			Dir:        output,
+			Mode:       parsedMode,
+			Depth:      depth,
+			SplitPaths: splitPaths,
+			Indent:     indent,
+			Logger:     log,
+		})
+		if err != nil {
+			return fmt.Errorf("unpack error: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	unpackCmd.Flags().IntVar(&depth, "depth", 1,
+		"Number of key levels to split into separate files and directories")
+	unpackCmd.Flags().StringArrayVar(&splitPaths, "split", nil,
+		"Dot-separated key path to split into a directory regardless of --depth (repeatable)")
+}
+
+// rejectPackFlags returns an error for the first pack flag set on cmd.
+func rejectPackFlags(cmd *cobra.Command) error {
+	var err error
+	cmd.InheritedFlags().VisitAll(func(f *pflag.Flag) {
+		if err == nil && f.Changed && !unpackRootFlags[f.Name] {
+			err = fmt.Errorf("--%s is a pack flag and does not apply to unpack", f.Name)
+		}
+	})
+	return err
+}
+
+// readInput reads the named file, or stdin if name is '-'.
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from stdin: %w", err)
+		}
+		return data, nil
+	}
+
+	// #nosec G304 - user-controlled paths are expected for CLI tools
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input file: %w", err)
+	}
+	return data, nil
+}
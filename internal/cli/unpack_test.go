@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	"github.com/jksmth/fyaml"
+)
+
+func TestUnpackCmd_RoundTrip(t *testing.T) {
+	originalOutput := output
+	originalMode := mode
+	originalIndent := indent
+	originalDepth := depth
+	originalSplitPaths := splitPaths
+	t.Cleanup(func() {
+		output = originalOutput
+		mode = originalMode
+		indent = originalIndent
+		depth = originalDepth
+		splitPaths = originalSplitPaths
+	})
+
+	for _, m := range []string{"canonical", "preserve"} {
+		t.Run(m, func(t *testing.T) {
+			input := "../../testdata/simple/expected-" + m + ".yml"
+			expected, err := os.ReadFile(input)
+			assertNoError(t, err)
+
+			output = filepath.Join(t.TempDir(), "out")
+			mode = m
+			indent = 2
+			depth = 2
+			splitPaths = nil
+
+			assertNoError(t, unpackCmd.RunE(unpackCmd, []string{input}))
+
+			result, err := fyaml.Pack(context.Background(), testOpts(output, "yaml", false, false, m))
+			assertNoError(t, err)
+			assertOutputEqual(t, result, expected)
+
+			if _, err := os.Stat(filepath.Join(output, "entities", "item1.yml")); err != nil {
+				t.Errorf("expected entities/item1.yml to be written: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnpackCmd_RequiresOutput(t *testing.T) {
+	originalOutput := output
+	originalMode := mode
+	t.Cleanup(func() {
+		output = originalOutput
+		mode = originalMode
+	})
+
+	output = ""
+	mode = "canonical"
+
+	err := unpackCmd.RunE(unpackCmd, []string{"../../testdata/simple/expected-canonical.yml"})
+	assertErrorContains(t, err, "unpack requires --output DIR")
+}
+
+func TestUnpackCmd_MissingInput(t *testing.T) {
+	originalOutput := output
+	originalMode := mode
+	t.Cleanup(func() {
+		output = originalOutput
+		mode = originalMode
+	})
+
+	output = filepath.Join(t.TempDir(), "out")
+	mode = "canonical"
+
+	err := unpackCmd.RunE(unpackCmd, []string{"nonexistent.yml"})
+	assertErrorContains(t, err, "failed to read input file")
+}
+
+func TestUnpackCmd_RejectsPackFlags(t *testing.T) {
+	originalOutput := output
+	originalMode := mode
+	t.Cleanup(func() {
+		output = originalOutput
+		mode = originalMode
+	})
+
+	output = filepath.Join(t.TempDir(), "out")
+	mode = "canonical"
+
+	for name, value := range map[string]string{"merge": "deep", "include-path": "*.yml", "format": "json"} {
+		t.Run(name, func(t *testing.T) {
+			f := rootCmd.PersistentFlags().Lookup(name)
+			original := f.Value.String()
+			t.Cleanup(func() {
+				if sv, ok := f.Value.(pflag.SliceValue); ok {
+					_ = sv.Replace(nil)
+				} else {
+					_ = f.Value.Set(original)
+				}
+				f.Changed = false
+			})
+			assertNoError(t, rootCmd.PersistentFlags().Set(name, value))
+
+			err := unpackCmd.RunE(unpackCmd, []string{"../../testdata/simple/expected-canonical.yml"})
+			assertErrorContains(t, err, "--"+name+" is a pack flag and does not apply to unpack")
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jksmth/fyaml/internal/packerr"
+	"go.yaml.in/yaml/v4"
+)
+
+// documents.go contains the handling of files holding more than one YAML document.
+
+// decodeDocuments parses every document in buf. Documents without content,
+// such as the one after a trailing "---", are left out.
+func decodeDocuments(buf []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	for {
+		doc := &yaml.Node{}
+		err := dec.Decode(doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || emptyDocument(doc.Content[0]) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// emptyDocument reports whether n is the implicit null of a document without content.
+func emptyDocument(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null" && n.Value == "" && n.Style == 0
+}
+
+// joinDocuments returns the content of the file n from the roots of its
+// documents, as the multi-document policy of opts says.
+func (n *Node) joinDocuments(roots []*yaml.Node, opts *Options) (*yaml.Node, error) {
+	if len(roots) == 1 {
+		return roots[0], nil
+	}
+
+	policy := MultiDocumentFail
+	if opts != nil && opts.MultiDocument != "" {
+		policy = opts.MultiDocument
+	}
+	multiErr := func(i int, reason string) error {
+		return &packerr.MultiDocumentError{File: n.FullPath, Line: roots[i].Line, Documents: len(roots), Reason: reason}
+	}
+
+	switch policy {
+	case MultiDocumentMerge:
+		opts.log().Debugf("Merging %d documents: %s", len(roots), n.FullPath)
+		m := newMerger(opts)
+		merged := roots[0]
+		mergedOrigin := nodeOrigin(n.Path, merged, ModePreserve, n.included)
+		for i, root := range roots {
+			if root.Kind != yaml.MappingNode {
+				return nil, multiErr(i, fmt.Sprintf("document %d is a %s, and only maps can be merged", i+1, kindName(root)))
+			}
+			if i == 0 {
+				continue
+			}
+			if err := m.mergeMapping(merged, root, mergedOrigin, nodeOrigin(n.Path, root, ModePreserve, n.included), n.keyPath()); err != nil {
+				return nil, fmt.Errorf("failed to merge the documents of %s: %w", n.FullPath, err)
+			}
+		}
+		return merged, nil
+
+	case MultiDocumentSequence:
+		if n.mergesIntoParent() {
+			return nil, multiErr(1, "it merges into its parent map, so its documents cannot form a sequence")
+		}
+		opts.log().Debugf("Packing %d documents as a sequence: %s", len(roots), n.FullPath)
+		n.multiDocument = true
+		return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: roots}, nil
+
+	default:
+		return nil, multiErr(1, "set a multi-document policy to merge them or pack them as a sequence")
+	}
+}
+
+// kindName names the kind of n in messages.
+func kindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "map"
+	case yaml.SequenceNode:
+		return "sequence"
+	default:
+		return "scalar"
+	}
+}
@@ -0,0 +1,70 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// escape.go contains the percent-encoding of keys that cannot be written as
+// file or directory names, such as /users/{id} written as %2Fusers%2F{id}.yml.
+
+// unsafeNameChars are the characters that cannot appear in portable file names.
+const unsafeNameChars = `/\<>:"|?*`
+
+// unescapeName decodes percent-encoded bytes such as %2F in a key taken from
+// a file or directory name. A "%" that is not followed by two hex digits is
+// kept as it is.
+func unescapeName(name string) string {
+	if !strings.Contains(name, "%") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '%' && i+2 < len(name) && isHex(name[i+1]) && isHex(name[i+2]) {
+			b.WriteByte(unhex(name[i+1])<<4 | unhex(name[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// escapeName returns the file or directory name, without extension, for key.
+// It percent-encodes "%", control characters and characters that are not
+// portable in file names, as well as anything that would give the name a
+// meaning of its own: a leading "." or "@", a leading ordering prefix such as
+// "010-", a trailing "." or space, and a trailing "[]".
+// unescapeName(escapeName(key)) == key.
+func escapeName(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		last := i == len(key)-1
+		if c == '%' || c < 0x20 || c == 0x7f || strings.IndexByte(unsafeNameChars, c) >= 0 ||
+			(i == 0 && (c == '.' || c == '@' || orderPrefixRe.MatchString(key))) ||
+			(last && (c == '.' || c == ' ')) ||
+			(last && c == ']' && strings.HasSuffix(key, SequenceSuffix)) {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,54 @@
+package filetree
+
+import "testing"
+
+func TestUnescapeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"plain", "plain"},
+		{"%2Fusers%2F{id}", "/users/{id}"},
+		{"%2fusers", "/users"},
+		{"%40at", "@at"},
+		{"100%", "100%"},
+		{"50%off", "50%off"},
+		{"%2", "%2"},
+		{"a%25b", "a%b"},
+	}
+	for _, tt := range tests {
+		if got := unescapeName(tt.name); got != tt.want {
+			t.Errorf("unescapeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"plain", "plain"},
+		{"/users/{id}", "%2Fusers%2F{id}"},
+		{".hidden", "%2Ehidden"},
+		{"@at", "%40at"},
+		{"trailing.", "trailing%2E"},
+		{"trailing ", "trailing%20"},
+		{"steps[]", "steps[%5D"},
+		{"a%b", "a%25b"},
+		{"on:push", "on%3Apush"},
+		{"tab\there", "tab%09here"},
+		{"dotted.key", "dotted.key"},
+		{"010-build", "%3010-build"},
+		{"v1-build", "v1-build"},
+	}
+	for _, tt := range tests {
+		got := escapeName(tt.key)
+		if got != tt.want {
+			t.Errorf("escapeName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+		if back := unescapeName(got); back != tt.key {
+			t.Errorf("unescapeName(escapeName(%q)) = %q", tt.key, back)
+		}
+	}
+}
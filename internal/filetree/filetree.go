@@ -15,36 +15,218 @@
 package filetree
 
 import (
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/jksmth/fyaml/internal/include"
+	"github.com/jksmth/fyaml/internal/logger"
+	"github.com/jksmth/fyaml/internal/packerr"
 )
 
 // Node represents a node in the filetree
 type Node struct {
+	// FullPath identifies the node in messages: the native absolute path for
+	// trees built with NewTree, or the slash-separated Path for NewTreeFS.
 	FullPath string
+	// Path is the slash-separated path of the node within its filesystem.
+	Path     string
 	Info     os.FileInfo
 	Children []*Node
 	Parent   *Node
+	// Skipped lists the paths left out while building the tree, sorted by
+	// path. It is only set on the root node.
+	Skipped []Skipped
+	// Warnings lists the warnings logged while building the tree, in the
+	// order they were raised. It is only set on the root node.
+	Warnings []Warning
+
+	fsys          fs.FS // filesystem the node is read from
+	orderPrefixes bool  // ordering prefixes are stripped from the name and sort siblings
+	multiDocument bool  // the documents of the file were packed as a sequence
+	text          bool  // the file is not YAML, and its content is a string value
+
+	included include.Origins // files the nodes of the last parse were included from
+}
+
+// SkipReason explains why a path was left out of the pack.
+type SkipReason string
+
+const (
+	// SkipHidden marks dotfiles and dotfolders.
+	SkipHidden SkipReason = "hidden"
+	// SkipUnsupported marks files that are not .yml, .yaml, .json, .jsonc,
+	// .json5 or .toml, nor have one of the TextExtensions.
+	SkipUnsupported SkipReason = "unsupported"
+	// SkipEmpty marks files without any content.
+	SkipEmpty SkipReason = "empty"
+	// SkipIgnored marks paths matched by a .fyamlignore file.
+	SkipIgnored SkipReason = "ignored"
+	// SkipExcluded marks paths left out by the Include and Exclude patterns.
+	SkipExcluded SkipReason = "excluded"
+	// SkipSymlinkCycle marks followed symlinks to a directory that contains them.
+	SkipSymlinkCycle SkipReason = "symlink-cycle"
+	// SkipSymlinkOutside marks followed symlinks that point outside the pack
+	// root, with the SymlinkSkip policy.
+	SkipSymlinkOutside SkipReason = "symlink-outside-root"
+)
+
+// Skipped is a path left out of the pack.
+type Skipped struct {
+	Path   string // Slash-separated path relative to the pack root
+	Reason SkipReason
+}
+
+// WarningKind identifies the kind of a Warning.
+type WarningKind string
+
+const (
+	// WarnOrderEntry marks .order file entries that match no packed file or
+	// directory.
+	WarnOrderEntry WarningKind = "order-entry"
+	// WarnSymlinkCycle marks followed symlinks to a directory that contains
+	// them, which are also reported as Skipped.
+	WarnSymlinkCycle WarningKind = "symlink-cycle"
+)
+
+// Warning is a condition found while building a tree that did not stop it.
+type Warning struct {
+	Kind    WarningKind
+	File    string // Slash-separated path of the file the warning is about
+	Message string // The warning as logged
 }
 
 // PathNodes is a map of filepaths to tree nodes with ordered path keys.
 type PathNodes struct {
-	Map  map[string]*Node
-	Keys []string
+	Map      map[string]*Node
+	Keys     []string
+	Skipped  []Skipped // Paths left out of the tree
+	Warnings []Warning // Warnings raised while building the tree
+
+	orders map[string]*orderFile // order files by directory
+}
+
+// TreeOptions controls how a filetree is built.
+type TreeOptions struct {
+	// Path filters: doublestar patterns ("*" within a path segment, "**"
+	// across segments) matched against slash-separated paths relative to the
+	// pack root. Matching a directory matches everything inside it.
+	Include []string // If non-empty, only files matched by a pattern are collected
+	Exclude []string // Paths matched by a pattern are not collected
+
+	// Ordering: siblings sort by path. With OrderPrefixes, a numeric prefix
+	// such as "010-" is stripped from file and directory keys, prefixed
+	// siblings sort first by its value, and children listed in a directory's
+	// .order file come before all others, in the listed order.
+	OrderPrefixes bool
+
+	// Symlinks: by default, symlinked files are read through the link and
+	// symlinked directories are left out. With FollowSymlinks, symlinked
+	// directories are walked as if they were in place, except for links to a
+	// directory that contains them. OutsideSymlinks decides what happens to
+	// followed links whose target is outside the pack root; defaults to
+	// SymlinkError if empty.
+	FollowSymlinks  bool
+	OutsideSymlinks SymlinkPolicy
+
+	// Text files: files with one of these extensions, such as ".sh" or "sql",
+	// are kept, and their content becomes a string value under the key named
+	// by the file. Extensions match case-insensitively.
+	TextExtensions []string
+
+	// Logging
+	Logger logger.Logger // Logger for verbose output (nil-safe: defaults to Nop())
+}
+
+// log returns the logger, defaulting to Nop() if nil.
+func (o TreeOptions) log() logger.Logger {
+	if o.Logger == nil {
+		return logger.Nop()
+	}
+	return o.Logger
+}
+
+// isText reports whether info is a file read as a string value.
+func (o TreeOptions) isText(info os.FileInfo) bool {
+	ext := filepath.Ext(info.Name())
+	if ext == "" || ext == info.Name() {
+		return false
+	}
+	for _, e := range o.TextExtensions {
+		e = strings.TrimPrefix(e, ".")
+		if e != "" && strings.EqualFold(ext, "."+e) {
+			return true
+		}
+	}
+	return false
 }
 
 // NewTree creates a new filetree starting at the root.
-// It collects all YAML files and directories, skipping dotfiles and dotfolders.
+// It collects all YAML files and directories, skipping dotfiles, dotfolders
+// and paths matched by .fyamlignore files.
 func NewTree(rootPath string) (*Node, error) {
+	return NewTreeWithOptions(rootPath, TreeOptions{})
+}
+
+// NewTreeWithOptions is like NewTree, but built according to opts.
+func NewTreeWithOptions(rootPath string, opts TreeOptions) (*Node, error) {
 	absRootPath, err := filepath.Abs(rootPath)
 	if err != nil {
 		return nil, err
 	}
 
-	pathNodes, err := collectNodes(absRootPath)
+	info, err := os.Stat(absRootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the parent directory when the root is a single file, since
+	// os.DirFS can only be rooted at a directory.
+	fsysDir, root := absRootPath, "."
+	if !info.IsDir() {
+		fsysDir, root = filepath.Dir(absRootPath), filepath.Base(absRootPath)
+	}
+
+	fullPath := func(p string) string {
+		return filepath.Join(fsysDir, filepath.FromSlash(p))
+	}
+
+	// Absolute link targets are compared with the root with links resolved
+	realRoot, err := filepath.EvalSymlinks(fsysDir)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := newTree(os.DirFS(fsysDir), root, fullPath, realRoot, opts)
+	if tree != nil {
+		// os.DirFS reports the root directory as "."; keep its real name.
+		tree.Info = info
+	}
+	return tree, err
+}
+
+// NewTreeFS creates a new filetree starting at the root of fsys.
+// It applies the same rules as NewTree. Node paths are slash-separated and
+// relative to the root of fsys.
+func NewTreeFS(fsys fs.FS) (*Node, error) {
+	return NewTreeFSWithOptions(fsys, TreeOptions{})
+}
+
+// NewTreeFSWithOptions is like NewTreeFS, but built according to opts.
+func NewTreeFSWithOptions(fsys fs.FS, opts TreeOptions) (*Node, error) {
+	return newTree(fsys, ".", func(p string) string { return p }, "", opts)
+}
+
+// newTree collects and links the nodes under root in fsys. fullPath maps a
+// path within fsys to the FullPath recorded on its node. realRoot is the
+// native path of the root of fsys with links resolved, or "" if it has none.
+func newTree(fsys fs.FS, root string, fullPath func(string) string, realRoot string, opts TreeOptions) (*Node, error) {
+	pathNodes, err := collectNodes(fsys, root, fullPath, realRoot, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -52,89 +234,189 @@ func NewTree(rootPath string) (*Node, error) {
 	// Sort keys for deterministic ordering
 	sort.Strings(pathNodes.Keys)
 
-	rootNode := buildTree(absRootPath, pathNodes)
+	rootNode := buildTree(root, &pathNodes, opts)
+	if rootNode != nil && opts.OrderPrefixes {
+		if err := checkOrderPrefixes(rootNode); err != nil {
+			return nil, err
+		}
+	}
+	if rootNode != nil {
+		sort.Slice(pathNodes.Skipped, func(i, j int) bool {
+			return pathNodes.Skipped[i].Path < pathNodes.Skipped[j].Path
+		})
+		rootNode.Skipped = pathNodes.Skipped
+		rootNode.Warnings = pathNodes.Warnings
+	}
 
 	return rootNode, err
 }
 
-// collectNodes walks absRootPath and returns nodes keyed by a canonical path.
-// Canonical key = normalized absolute path (forward slashes for cross-platform consistency).
-func collectNodes(absRootPath string) (PathNodes, error) {
+// collectNodes walks root in fsys and returns nodes keyed by their
+// slash-separated path within fsys, which is consistent across platforms.
+// Paths matched by a .fyamlignore file in any directory above them, or left
+// out by the Include and Exclude patterns of opts, are skipped; a skipped
+// directory is not descended into. With FollowSymlinks, a symlinked directory
+// is walked under the path of the link.
+func collectNodes(fsys fs.FS, root string, fullPath func(string) string, realRoot string, opts TreeOptions) (PathNodes, error) {
 	pathNodes := PathNodes{
-		Map:  make(map[string]*Node),
-		Keys: []string{},
+		Map:    make(map[string]*Node),
+		Keys:   []string{},
+		orders: make(map[string]*orderFile),
 	}
+	ig := &ignorer{}
+	filter, err := newPathFilter(opts.Include, opts.Exclude)
+	if err != nil {
+		return pathNodes, err
+	}
+
+	links := &symlinks{
+		fsys:     fsys,
+		realRoot: realRoot,
+		outside:  opts.OutsideSymlinks,
+		fullPath: fullPath,
+		log:      opts.log(),
+		nodes:    &pathNodes,
+	}
+
+	var walk fs.WalkDirFunc
+	walk = func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-	err := filepath.Walk(absRootPath, func(path string, info os.FileInfo, err error) error {
+		info, err := d.Info()
 		if err != nil {
 			return err
 		}
 
+		// The target of a followed link is walked as a new root at p, where
+		// it is visited again as a directory
+		followDir := false
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if !opts.FollowSymlinks {
+				if target, err := fs.Stat(fsys, p); err == nil && target.IsDir() {
+					opts.log().Debugf("Not following symlinked directory: %s", fullPath(p))
+				}
+			} else {
+				target, reason, err := links.follow(p)
+				if err != nil {
+					return err
+				}
+				if target == nil {
+					pathNodes.Skipped = append(pathNodes.Skipped, Skipped{Path: p, Reason: reason})
+					return nil
+				}
+				info, followDir = target, target.IsDir()
+			}
+		}
+
 		// Skip dotfolders (but not the root itself)
-		if absRootPath != path && dotfolder(info) {
-			return filepath.SkipDir
+		if root != p && dotfolder(info) {
+			pathNodes.Skipped = append(pathNodes.Skipped, Skipped{Path: p, Reason: SkipHidden})
+			return fs.SkipDir
 		}
 
-		fp, err := filepath.Abs(path)
-		if err != nil {
-			return err
+		// Dotfiles are reported as hidden by buildTree, even when ignored
+		if root != p && !dotfile(info) {
+			if rule := ig.match(p, info.IsDir()); rule != nil {
+				opts.log().Debugf("Ignoring: %s (%s:%d: %s)", fullPath(p), fullPath(rule.file), rule.line, rule.pattern)
+				pathNodes.Skipped = append(pathNodes.Skipped, Skipped{Path: p, Reason: SkipIgnored})
+				if info.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if reason := filter.excluded(p, info.IsDir()); reason != "" {
+				opts.log().Debugf("Excluding: %s (%s)", fullPath(p), reason)
+				pathNodes.Skipped = append(pathNodes.Skipped, Skipped{Path: p, Reason: SkipExcluded})
+				if info.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
 		}
 
-		key := filepath.ToSlash(fp) // canonical key for cross-platform determinism
+		if followDir {
+			return fs.WalkDir(fsys, p, walk)
+		}
 
-		pathNodes.Keys = append(pathNodes.Keys, key)
-		pathNodes.Map[key] = &Node{
-			FullPath: fp, // keep native absolute path for I/O
-			Info:     info,
-			Children: make([]*Node, 0),
+		if info.IsDir() {
+			if err := ig.load(fsys, p); err != nil {
+				return err
+			}
+		}
+		if info.IsDir() && opts.OrderPrefixes {
+			order, err := readOrderFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			if order != nil {
+				order.path = fullPath(order.path)
+				pathNodes.orders[p] = order
+			}
+		}
+
+		pathNodes.Keys = append(pathNodes.Keys, p)
+		pathNodes.Map[p] = &Node{
+			FullPath:      fullPath(p),
+			Path:          p,
+			Info:          info,
+			Children:      make([]*Node, 0),
+			fsys:          fsys,
+			orderPrefixes: opts.OrderPrefixes,
 		}
 
 		return nil
-	})
+	}
 
+	err = fs.WalkDir(fsys, root, walk)
 	return pathNodes, err
 }
 
-func buildTree(absRootPath string, pathNodes PathNodes) *Node {
+func buildTree(rootKey string, pathNodes *PathNodes, opts TreeOptions) *Node {
 	var rootNode *Node
 
-	rootKey := filepath.ToSlash(absRootPath) // canonical root key
-
 	for _, key := range pathNodes.Keys {
 		node := pathNodes.Map[key]
 
-		// Skip dotfiles + non-YAML regular files, except at the root itself
-		if rootKey != key && node.Info.Mode().IsRegular() {
-			if dotfile(node.Info) || !isYaml(node.Info) {
+		if rootKey == key {
+			rootNode = node
+			continue
+		}
+
+		// Skip dotfiles + non-YAML regular files
+		if node.Info.Mode().IsRegular() {
+			if dotfile(node.Info) {
+				pathNodes.Skipped = append(pathNodes.Skipped, Skipped{Path: key, Reason: SkipHidden})
 				continue
 			}
+			if !isYaml(node.Info) {
+				if !opts.isText(node.Info) {
+					pathNodes.Skipped = append(pathNodes.Skipped, Skipped{Path: key, Reason: SkipUnsupported})
+					continue
+				}
+				node.text = true
+			}
 		}
 
-		parentKey := filepath.ToSlash(filepath.Dir(node.FullPath))
-		if parent, exists := pathNodes.Map[parentKey]; exists {
+		if parent, exists := pathNodes.Map[path.Dir(key)]; exists {
 			node.Parent = parent
 			parent.Children = append(parent.Children, node)
-		} else {
-			// Only true for the actual root directory node
-			rootNode = node
 		}
 	}
 
 	if rootNode != nil {
-		sortChildren(rootNode)
+		sortChildren(rootNode, pathNodes, opts.log())
 	}
 
 	return rootNode
 }
 
-func sortChildren(node *Node) {
-	// Deterministic across OS: compare canonical absolute paths
-	sort.Slice(node.Children, func(i, j int) bool {
-		return filepath.ToSlash(node.Children[i].FullPath) < filepath.ToSlash(node.Children[j].FullPath)
-	})
-	for _, child := range node.Children {
-		sortChildren(child)
-	}
+// warn logs a warning about file and records it.
+func (p *PathNodes) warn(log logger.Logger, kind WarningKind, file, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Warnf("%s", msg)
+	p.Warnings = append(p.Warnings, Warning{Kind: kind, File: file, Message: msg})
 }
 
 // --- Node helper methods ---
@@ -143,7 +425,22 @@ func (n *Node) basename() string {
 	return n.Info.Name()
 }
 
+// name returns the key named by n: its basename without extension, sequence
+// suffix or ordering prefix, with percent-encoded bytes decoded.
 func (n *Node) name() string {
+	name := n.prefixedName()
+	if n.orderPrefixes {
+		_, name, _ = orderPrefix(name)
+	}
+	return unescapeName(name)
+}
+
+// prefixedName returns the basename of n without extension or sequence
+// suffix, keeping any ordering prefix and percent-encoded bytes.
+func (n *Node) prefixedName() string {
+	if n.sequenceDirectory() {
+		return strings.TrimSuffix(n.basename(), SequenceSuffix)
+	}
 	return strings.TrimSuffix(n.basename(), filepath.Ext(n.basename()))
 }
 
@@ -159,11 +456,11 @@ func (n *Node) root() *Node {
 }
 
 func (n *Node) rootFile() bool {
-	return n.Info.Mode().IsRegular() && n.root() == n.Parent
+	return n.Info.Mode().IsRegular() && !n.text && n.root() == n.Parent
 }
 
 func (n *Node) specialCase() bool {
-	re := regexp.MustCompile(`^@.*\.(yml|yaml|json)$`)
+	re := regexp.MustCompile(`^@.*\.(yml|yaml|json|jsonc|json5|toml)$`)
 	return re.MatchString(n.basename())
 }
 
@@ -171,6 +468,34 @@ func (n *Node) specialCaseDirectory() bool {
 	return n.Info.IsDir() && strings.HasPrefix(n.basename(), "@")
 }
 
+// mergesIntoParent reports whether the content of n is merged into its
+// parent's map rather than set under a key named by n.
+func (n *Node) mergesIntoParent() bool {
+	return n.rootFile() || n.specialCaseDirectory() || n.specialCase()
+}
+
+// structureError returns the error for a child whose content of kind gotKind
+// cannot be placed in its parent's map.
+func (n *Node) structureError(gotKind string) error {
+	return &packerr.StructureError{
+		File:             n.FullPath,
+		KeyPath:          n.keyPath(),
+		GotKind:          gotKind,
+		MergesIntoParent: n.mergesIntoParent(),
+	}
+}
+
+// SequenceSuffix marks a directory whose children become the items of a
+// sequence, such as steps[]/.
+const SequenceSuffix = "[]"
+
+// sequenceDirectory reports whether n is a directory below the root whose
+// children, in sorted order, are the items of a sequence named by n.
+func (n *Node) sequenceDirectory() bool {
+	return n.Info.IsDir() && n.Parent != nil && !n.specialCaseDirectory() &&
+		strings.HasSuffix(n.basename(), SequenceSuffix) && n.basename() != SequenceSuffix
+}
+
 // --- File detection helpers ---
 
 func dotfile(info os.FileInfo) bool {
@@ -182,10 +507,31 @@ func dotfolder(info os.FileInfo) bool {
 	return info.IsDir() && dotfile(info)
 }
 
-// isYaml checks if a file is a supported YAML/JSON file.
+// isYaml checks if a file is a supported YAML/JSON/JSON5/TOML file.
 // Note: This project is YAML-first; JSON support is provided as a convenience
-// since JSON is a subset of YAML.
+// since JSON is a subset of YAML, and JSON5 and TOML files are converted on
+// reading.
 func isYaml(info os.FileInfo) bool {
-	re := regexp.MustCompile(`.+\.(yml|yaml|json)$`)
+	re := regexp.MustCompile(`.+\.(yml|yaml|json|jsonc|json5|toml)$`)
 	return re.MatchString(info.Name())
 }
+
+// jsonLanguage returns the language a .jsonc or .json5 file is written in,
+// and with relaxed set the language of a .json file, or "" if the file is
+// read as YAML.
+func jsonLanguage(info os.FileInfo, relaxed bool) string {
+	switch {
+	case strings.HasSuffix(info.Name(), ".jsonc"):
+		return "JSONC"
+	case strings.HasSuffix(info.Name(), ".json5"):
+		return "JSON5"
+	case relaxed && strings.HasSuffix(info.Name(), ".json"):
+		return "JSON"
+	}
+	return ""
+}
+
+// isTOML checks if a file is a TOML file.
+func isTOML(info os.FileInfo) bool {
+	return strings.HasSuffix(info.Name(), ".toml")
+}
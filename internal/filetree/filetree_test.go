@@ -3,8 +3,10 @@ package filetree
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 // Test helpers - shared across test files
@@ -106,6 +108,43 @@ func findNodeByName(t *testing.T, tree *Node, name string) *Node {
 
 // Tree building tests
 
+func TestNewTreeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"b/item.yml":       {Data: []byte("key: b")},
+		"a.yml":            {Data: []byte("key: a")},
+		"notes.txt":        {Data: []byte("not yaml")},
+		".hidden/item.yml": {Data: []byte("key: hidden")},
+	}
+
+	tree, err := NewTreeFS(fsys)
+	assertNoError(t, err)
+
+	if tree == nil {
+		t.Fatal("NewTreeFS() returned nil tree")
+	}
+	if tree.Path != "." {
+		t.Errorf("NewTreeFS() Path = %v, want .", tree.Path)
+	}
+
+	var paths []string
+	for _, child := range tree.Children {
+		paths = append(paths, child.Path)
+	}
+	if strings.Join(paths, ",") != "a.yml,b" {
+		t.Errorf("NewTreeFS() children = %v, want [a.yml b]", paths)
+	}
+	if got := tree.Children[1].Children[0].FullPath; got != "b/item.yml" {
+		t.Errorf("NewTreeFS() FullPath = %v, want b/item.yml", got)
+	}
+
+	result, err := tree.Marshal(&Options{FS: fsys})
+	assertNoError(t, err)
+	m := asMapShared(t, result)
+	if asMapShared(t, m["b"])["item"] == nil {
+		t.Errorf("Marshal() = %v, want b.item", m)
+	}
+}
+
 func TestNewTree(t *testing.T) {
 	tmpDir := createTestDir(t, map[string]string{
 		"sub_dir/sub_dir_file.yml": "entity:\n  id: example1\n  attributes:\n    name: sample name",
@@ -128,6 +167,28 @@ func TestNewTree(t *testing.T) {
 	}
 }
 
+func TestNewTree_Skipped(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"config.yml":        "key: value",
+		".hidden.yml":       "key: value",
+		".git/config.yml":   "key: value",
+		"sub/README.md":     "# readme",
+		"sub/settings.yaml": "key: value",
+	}, nil)
+
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+
+	want := []Skipped{
+		{Path: ".git", Reason: SkipHidden},
+		{Path: ".hidden.yml", Reason: SkipHidden},
+		{Path: "sub/README.md", Reason: SkipUnsupported},
+	}
+	if !reflect.DeepEqual(tree.Skipped, want) {
+		t.Errorf("NewTree() Skipped = %v, want %v", tree.Skipped, want)
+	}
+}
+
 func TestNewTree_NonexistentDirectory(t *testing.T) {
 	_, err := NewTree("/nonexistent/path/that/does/not/exist")
 	assertErrorContains(t, err, "no such file")
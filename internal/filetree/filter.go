@@ -0,0 +1,85 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// filter.go contains the include and exclude path filters.
+
+// globPattern is a doublestar pattern matched against slash-separated paths.
+type globPattern struct {
+	pattern  string   // Pattern as given, for messages
+	segments []string // Pattern split on "/"
+}
+
+// pathFilter selects the paths of a tree by their path relative to the pack root.
+type pathFilter struct {
+	include []globPattern // If any, only files matched by one (or inside a matched directory) are kept
+	exclude []globPattern // Paths matched by any are left out
+}
+
+// newPathFilter compiles the include and exclude patterns.
+func newPathFilter(include, exclude []string) (*pathFilter, error) {
+	f := &pathFilter{}
+	var err error
+	if f.include, err = compileGlobs("include", include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compileGlobs("exclude", exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// compileGlobs compiles patterns, naming their kind in errors. A leading "./"
+// or "/" and a trailing "/" are ignored, since paths are always relative.
+func compileGlobs(kind string, patterns []string) ([]globPattern, error) {
+	globs := make([]globPattern, 0, len(patterns))
+	for _, p := range patterns {
+		clean := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(p, "./"), "/"), "/")
+		segments, err := splitPattern(clean)
+		if err != nil || clean == "" {
+			if err == nil {
+				err = path.ErrBadPattern
+			}
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", kind, p, err)
+		}
+		globs = append(globs, globPattern{pattern: p, segments: segments})
+	}
+	return globs, nil
+}
+
+// matchAny returns the first of globs that matches p, or nil.
+func matchAny(globs []globPattern, p string) *globPattern {
+	name := strings.Split(p, "/")
+	for i := range globs {
+		if matchSegments(globs[i].segments, name) {
+			return &globs[i]
+		}
+	}
+	return nil
+}
+
+// excluded returns the reason p, a path relative to the pack root, is left
+// out, or "" if it is kept. Directories are only left out by exclude patterns,
+// since files inside them may still be included.
+func (f *pathFilter) excluded(p string, isDir bool) string {
+	if f == nil {
+		return ""
+	}
+	if g := matchAny(f.exclude, p); g != nil {
+		return fmt.Sprintf("exclude pattern %s", g.pattern)
+	}
+	if isDir || len(f.include) == 0 {
+		return ""
+	}
+	for dir := p; dir != "."; dir = path.Dir(dir) {
+		if matchAny(f.include, dir) != nil {
+			return ""
+		}
+	}
+	return "no include pattern"
+}
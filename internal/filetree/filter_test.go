@@ -0,0 +1,107 @@
+package filetree
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jksmth/fyaml/internal/logger"
+)
+
+func TestPathFilter_Excluded(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		path    string
+		isDir   bool
+		want    string
+	}{
+		{"no patterns", nil, nil, "a/b.yml", false, ""},
+		{"exclude directory", nil, []string{"experimental/**"}, "experimental", true, "exclude pattern experimental/**"},
+		{"exclude nested file", nil, []string{"**/*.draft.yml"}, "a/b/c.draft.yml", false, "exclude pattern **/*.draft.yml"},
+		{"star stays in segment", nil, []string{"*.yml"}, "a/b.yml", false, ""},
+		{"leading dot slash", nil, []string{"./a/b.yml"}, "a/b.yml", false, "exclude pattern ./a/b.yml"},
+		{"include file", []string{"services/**"}, nil, "services/api.yml", false, ""},
+		{"include misses file", []string{"services/**"}, nil, "global.yml", false, "no include pattern"},
+		{"include keeps directories", []string{"services/**"}, nil, "other", true, ""},
+		{"include directory", []string{"services"}, nil, "services/a/b.yml", false, ""},
+		{"exclude wins over include", []string{"services/**"}, []string{"services/beta"}, "services/beta", true, "exclude pattern services/beta"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newPathFilter(tt.include, tt.exclude)
+			assertNoError(t, err)
+			if got := f.excluded(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("excluded(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPathFilter_InvalidPattern(t *testing.T) {
+	_, err := newPathFilter([]string{"a/[b"}, nil)
+	assertErrorContains(t, err, `invalid include pattern "a/[b"`)
+	if !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("error = %v, want path.ErrBadPattern", err)
+	}
+
+	_, err = newPathFilter(nil, []string{"/"})
+	assertErrorContains(t, err, `invalid exclude pattern "/"`)
+}
+
+func TestNewTreeFS_IncludeExclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"global.yml":               {Data: []byte("name: app")},
+		"services/api.yml":         {Data: []byte("port: 80")},
+		"services/beta/worker.yml": {Data: []byte("port: 81")},
+		"experimental/new.yml":     {Data: []byte("port: 82")},
+	}
+
+	var buf bytes.Buffer
+	tree, err := NewTreeFSWithOptions(fsys, TreeOptions{
+		Include: []string{"services/**", "experimental/**"},
+		Exclude: []string{"experimental", "**/beta/**"},
+		Logger:  logger.New(&buf, true),
+	})
+	assertNoError(t, err)
+
+	var paths []string
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, child := range n.Children {
+			paths = append(paths, child.Path)
+			walk(child)
+		}
+	}
+	walk(tree)
+	wantPaths := []string{"services", "services/api.yml"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("NewTreeFS() paths = %v, want %v", paths, wantPaths)
+	}
+
+	want := []Skipped{
+		{Path: "experimental", Reason: SkipExcluded},
+		{Path: "global.yml", Reason: SkipExcluded},
+		{Path: "services/beta", Reason: SkipExcluded},
+	}
+	if !reflect.DeepEqual(tree.Skipped, want) {
+		t.Errorf("NewTreeFS() Skipped = %v, want %v", tree.Skipped, want)
+	}
+
+	log := buf.String()
+	for _, line := range []string{
+		"[DEBUG] Excluding: experimental (exclude pattern experimental)",
+		"[DEBUG] Excluding: global.yml (no include pattern)",
+		"[DEBUG] Excluding: services/beta (exclude pattern **/beta/**)",
+	} {
+		if !strings.Contains(log, line) {
+			t.Errorf("log = %q, want line %q", log, line)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ignore.go contains .fyamlignore handling, which follows .gitignore semantics.
+
+// IgnoreFile is the name of the files listing paths to leave out of the pack.
+const IgnoreFile = ".fyamlignore"
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	file     string   // Path of the ignore file within its filesystem
+	line     int      // Line of the pattern in the file
+	pattern  string   // Pattern as written, for messages
+	segments []string // Pattern split on "/", matched against the path relative to the file's directory
+	negate   bool     // "!" re-includes paths matched by earlier patterns
+	dirOnly  bool     // A trailing "/" matches directories only
+}
+
+// matches reports whether the rule matches rel, a slash-separated path
+// relative to the directory of the ignore file.
+func (r *ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches name against pattern segment by segment, with
+// path.Match syntax within a segment. A "**" segment matches any number of
+// segments, including none.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// splitPattern splits a slash-separated glob pattern into segments, checking
+// that each is well formed.
+func splitPattern(pattern string) ([]string, error) {
+	segments := strings.Split(pattern, "/")
+	for _, seg := range segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// parseIgnoreFile parses the content of the ignore file at file.
+//
+// As in .gitignore, blank lines and lines starting with "#" are skipped, a
+// leading "!" negates the pattern, a trailing "/" matches directories only,
+// and a pattern with a "/" anywhere else is anchored to the directory of the
+// ignore file; other patterns match a name at any depth below it. A leading
+// "\" escapes a literal "#" or "!".
+func parseIgnoreFile(file string, data []byte) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := trimTrailingSpace(strings.TrimSuffix(scanner.Text(), "\r"))
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		rule := ignoreRule{file: file, line: line, pattern: text}
+		if strings.HasPrefix(text, "!") {
+			rule.negate = true
+			text = text[1:]
+		} else if strings.HasPrefix(text, `\#`) || strings.HasPrefix(text, `\!`) {
+			text = text[1:]
+		}
+		if strings.HasSuffix(text, "/") {
+			rule.dirOnly = true
+			text = strings.TrimRight(text, "/")
+		}
+		if text == "" {
+			continue
+		}
+
+		// Anchored patterns are relative to the ignore file's directory;
+		// others match at any depth.
+		if strings.Contains(text, "/") {
+			text = strings.TrimPrefix(text, "/")
+		} else {
+			text = "**/" + text
+		}
+		// As in .gitignore, "dir/**" matches everything inside dir but not dir itself
+		if strings.HasSuffix(text, "/**") {
+			text += "/*"
+		}
+		segments, err := splitPattern(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q at %s:%d: %w", rule.pattern, file, line, err)
+		}
+		rule.segments = segments
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return rules, nil
+}
+
+// trimTrailingSpace removes trailing spaces that are not escaped with "\".
+func trimTrailingSpace(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// ignorer holds the rules of the ignore files found while walking a tree.
+type ignorer struct {
+	rules map[string][]ignoreRule // Rules by the directory of their ignore file
+}
+
+// load reads the ignore file of dir in fsys, if it has one.
+func (ig *ignorer) load(fsys fs.FS, dir string) error {
+	file := path.Join(dir, IgnoreFile)
+	data, err := fs.ReadFile(fsys, file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	rules, err := parseIgnoreFile(file, data)
+	if err != nil {
+		return err
+	}
+	if ig.rules == nil {
+		ig.rules = make(map[string][]ignoreRule)
+	}
+	ig.rules[dir] = rules
+	return nil
+}
+
+// match returns the rule deciding that p is ignored, or nil if it is not.
+// The ignore files of p's ancestors apply from the outermost in, and within a
+// file from top to bottom; the last matching rule wins, so a negated rule
+// re-includes the path.
+func (ig *ignorer) match(p string, isDir bool) *ignoreRule {
+	if len(ig.rules) == 0 {
+		return nil
+	}
+
+	var dirs []string
+	for dir := path.Dir(p); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." {
+			break
+		}
+	}
+
+	var last *ignoreRule
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		rel := p
+		if dir != "." {
+			rel = strings.TrimPrefix(p, dir+"/")
+		}
+		for j := range ig.rules[dir] {
+			if rule := &ig.rules[dir][j]; rule.matches(rel, isDir) {
+				last = rule
+			}
+		}
+	}
+	if last == nil || last.negate {
+		return nil
+	}
+	return last
+}
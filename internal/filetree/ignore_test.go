@@ -0,0 +1,156 @@
+package filetree
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jksmth/fyaml/internal/logger"
+)
+
+func TestIgnorer_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"name at root", "secret.yml", "secret.yml", false, true},
+		{"name at any depth", "secret.yml", "a/b/secret.yml", false, true},
+		{"glob", "*.draft.yml", "a/x.draft.yml", false, true},
+		{"glob does not cross segments", "a*.yml", "a/b.yml", false, false},
+		{"anchored", "/local", "local", true, true},
+		{"anchored not nested", "/local", "a/local", true, false},
+		{"slash in middle anchors", "a/b.yml", "a/b.yml", false, true},
+		{"slash in middle not nested", "a/b.yml", "x/a/b.yml", false, false},
+		{"directory only matches directory", "scratch/", "scratch", true, true},
+		{"directory only skips file", "scratch/", "scratch", false, false},
+		{"leading double star", "**/tmp", "a/b/tmp", true, true},
+		{"middle double star", "a/**/c.yml", "a/c.yml", false, true},
+		{"middle double star deep", "a/**/c.yml", "a/x/y/c.yml", false, true},
+		{"trailing double star matches contents", "a/**", "a/x.yml", false, true},
+		{"trailing double star not directory", "a/**", "a", true, false},
+		{"escaped hash", `\#notes.yml`, "#notes.yml", false, true},
+		{"trailing spaces trimmed", "x.yml  ", "x.yml", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseIgnoreFile(IgnoreFile, []byte(tt.pattern))
+			assertNoError(t, err)
+			ig := &ignorer{rules: map[string][]ignoreRule{".": rules}}
+			if got := ig.match(tt.path, tt.isDir) != nil; got != tt.want {
+				t.Errorf("match(%q) with %q = %v, want %v", tt.path, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnorer_Negation(t *testing.T) {
+	rules, err := parseIgnoreFile(IgnoreFile, []byte("# comment\n\n*.yml\n!keep.yml\n"))
+	assertNoError(t, err)
+	ig := &ignorer{rules: map[string][]ignoreRule{".": rules}}
+
+	if rule := ig.match("drop.yml", false); rule == nil || rule.line != 3 {
+		t.Errorf("match(drop.yml) = %+v, want rule on line 3", rule)
+	}
+	if rule := ig.match("keep.yml", false); rule != nil {
+		t.Errorf("match(keep.yml) = %+v, want nil", rule)
+	}
+}
+
+func TestParseIgnoreFile_InvalidPattern(t *testing.T) {
+	_, err := parseIgnoreFile("sub/.fyamlignore", []byte("ok.yml\n[bad\n"))
+	assertErrorContains(t, err, `invalid pattern "[bad" at sub/.fyamlignore:2`)
+}
+
+func TestNewTreeFS_IgnoreFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		".fyamlignore":           {Data: []byte("*.draft.yml\n/local/\nfixtures/**\n!fixtures/shared.yml\n")},
+		"config.yml":             {Data: []byte("key: value")},
+		"config.draft.yml":       {Data: []byte("key: draft")},
+		"local/dev.yml":          {Data: []byte("key: dev")},
+		"fixtures/a.yml":         {Data: []byte("key: a")},
+		"fixtures/shared.yml":    {Data: []byte("key: shared")},
+		"sub/.fyamlignore":       {Data: []byte("!keep.draft.yml\nlocal.yml\n")},
+		"sub/keep.draft.yml":     {Data: []byte("key: keep")},
+		"sub/other.draft.yml":    {Data: []byte("key: other")},
+		"sub/local.yml":          {Data: []byte("key: local")},
+		"sub/local/settings.yml": {Data: []byte("key: nested")},
+	}
+
+	var buf bytes.Buffer
+	tree, err := NewTreeFSWithOptions(fsys, TreeOptions{Logger: logger.New(&buf, true)})
+	assertNoError(t, err)
+
+	var paths []string
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, child := range n.Children {
+			if child.Info.Mode().IsRegular() {
+				paths = append(paths, child.Path)
+			}
+			walk(child)
+		}
+	}
+	walk(tree)
+	wantPaths := []string{
+		"config.yml",
+		"fixtures/shared.yml",
+		"sub/keep.draft.yml",
+		"sub/local/settings.yml",
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("NewTreeFS() files = %v, want %v", paths, wantPaths)
+	}
+
+	want := []Skipped{
+		{Path: ".fyamlignore", Reason: SkipHidden},
+		{Path: "config.draft.yml", Reason: SkipIgnored},
+		{Path: "fixtures/a.yml", Reason: SkipIgnored},
+		{Path: "local", Reason: SkipIgnored},
+		{Path: "sub/.fyamlignore", Reason: SkipHidden},
+		{Path: "sub/local.yml", Reason: SkipIgnored},
+		{Path: "sub/other.draft.yml", Reason: SkipIgnored},
+	}
+	if !reflect.DeepEqual(tree.Skipped, want) {
+		t.Errorf("NewTreeFS() Skipped = %v, want %v", tree.Skipped, want)
+	}
+
+	log := buf.String()
+	for _, line := range []string{
+		"[DEBUG] Ignoring: local (.fyamlignore:2: /local/)",
+		"[DEBUG] Ignoring: sub/local.yml (sub/.fyamlignore:2: local.yml)",
+	} {
+		if !strings.Contains(log, line) {
+			t.Errorf("log = %q, want line %q", log, line)
+		}
+	}
+	if n := strings.Count(log, "Ignoring:"); n != 5 {
+		t.Errorf("log has %d ignored paths, want 5:\n%s", n, log)
+	}
+}
+
+func TestNewTree_IgnoreFile(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		".fyamlignore":      "secrets/\n",
+		"config.yml":        "key: value",
+		"secrets/token.yml": "token: x",
+	}, nil)
+
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+
+	result, err := tree.MarshalYAML()
+	assertNoError(t, err)
+	m := asMapShared(t, result)
+	if _, ok := m["secrets"]; ok {
+		t.Errorf("MarshalYAML() = %v, want no secrets key", m)
+	}
+	if m["key"] != "value" {
+		t.Errorf("MarshalYAML() = %v, want key: value", m)
+	}
+}
@@ -0,0 +1,71 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"sort"
+	"strings"
+)
+
+// listmerge.go contains the configuration shared by keyed list merging in
+// both modes: sequences of maps whose items are matched by an identity key.
+
+// listKeyPattern is a key path pattern with the identity keys of the
+// sequences it matches. A "*" segment matches any single key.
+type listKeyPattern struct {
+	segments []string
+	keys     []string
+}
+
+// newListKeyPatterns parses the per-path identity keys of opts, most specific
+// pattern first: fewer wildcards, then in lexical order.
+func newListKeyPatterns(byPath map[string][]string) []listKeyPattern {
+	patterns := make([]listKeyPattern, 0, len(byPath))
+	for p, keys := range byPath {
+		patterns = append(patterns, listKeyPattern{segments: strings.Split(p, "."), keys: keys})
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		wi, wj := patterns[i].wildcards(), patterns[j].wildcards()
+		if wi != wj {
+			return wi < wj
+		}
+		return strings.Join(patterns[i].segments, ".") < strings.Join(patterns[j].segments, ".")
+	})
+	return patterns
+}
+
+func (p listKeyPattern) wildcards() int {
+	n := 0
+	for _, s := range p.segments {
+		if s == "*" {
+			n++
+		}
+	}
+	return n
+}
+
+func (p listKeyPattern) matches(path []string) bool {
+	if len(p.segments) != len(path) {
+		return false
+	}
+	for i, s := range p.segments {
+		if s != "*" && s != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// identityKeys returns the identity keys of the sequence at path, or nil if
+// it is not merged by key. A matching per-path entry takes precedence over
+// the global keys, even when it is empty.
+func (m *merger) identityKeys(path []string) []string {
+	if !m.mergesMaps() {
+		return nil
+	}
+	for _, p := range m.listKeysByPath {
+		if p.matches(path) {
+			return p.keys
+		}
+	}
+	return m.listKeys
+}
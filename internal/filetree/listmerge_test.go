@@ -0,0 +1,179 @@
+package filetree
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// listmerge_test.go contains tests for keyed list merge configuration (listmerge.go).
+
+func TestMerger_IdentityKeys(t *testing.T) {
+	m := newMerger(&Options{
+		MergeStrategy: MergeDeep,
+		ListMergeKeys: []string{"name"},
+		ListMergeKeysByPath: map[string][]string{
+			"spec.containers.*.ports":   {"containerPort"},
+			"spec.containers.app.ports": {"port"},
+			"spec.volumes":              {},
+		},
+	})
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"spec.containers", []string{"name"}},
+		{"spec.containers.web.ports", []string{"containerPort"}},
+		{"spec.containers.app.ports", []string{"port"}},
+		{"spec.volumes", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.identityKeys(strings.Split(tt.path, ".")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("identityKeys(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	shallow := newMerger(&Options{ListMergeKeys: []string{"name"}})
+	if got := shallow.identityKeys([]string{"spec", "containers"}); got != nil {
+		t.Errorf("identityKeys() with MergeShallow = %v, want nil", got)
+	}
+}
+
+// keyedListFiles are two fragments of a Kubernetes-style pod spec.
+var keyedListFiles = map[string]string{
+	"@base.yml": `spec:
+  containers:
+    # the application
+    - name: app
+      image: app:1
+      env:
+        - name: A
+          value: "1"
+    - name: sidecar
+      image: proxy
+  args: [--verbose]
+`,
+	"@patch.yml": `spec:
+  containers:
+    - name: app
+      image: app:2 # pinned
+      env:
+        - name: B
+          value: "2"
+    - name: debug
+      image: busybox
+  args: [--quiet]
+`,
+}
+
+func TestMarshal_KeyedListMerge(t *testing.T) {
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			tmpDir := createTestDir(t, keyedListFiles, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			report := &Report{}
+			result, err := tree.Marshal(&Options{
+				PackRoot:      tmpDir,
+				Mode:          mode,
+				MergeStrategy: MergeDeep,
+				ListMergeKeys: []string{"name"},
+				Report:        report,
+			})
+			assertNoError(t, err)
+
+			got := result
+			if node, ok := result.(*yaml.Node); ok {
+				// Comments of merged and appended items are kept
+				out, err := yaml.Marshal(node)
+				assertNoError(t, err)
+				for _, comment := range []string{"# the application", "# pinned"} {
+					if !strings.Contains(string(out), comment) {
+						t.Errorf("Marshal() lost comment %q:\n%s", comment, out)
+					}
+				}
+				assertNoError(t, node.Decode(&got))
+			}
+			want := map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "app:2", "env": []interface{}{
+							map[string]interface{}{"name": "A", "value": "1"},
+							map[string]interface{}{"name": "B", "value": "2"},
+						}},
+						map[string]interface{}{"name": "sidecar", "image": "proxy"},
+						map[string]interface{}{"name": "debug", "image": "busybox"},
+					},
+					// Items without an identity key are replaced as usual
+					"args": []interface{}{"--quiet"},
+				},
+			}
+			if normalized := NormalizeKeys(got); !reflect.DeepEqual(normalized, want) {
+				t.Errorf("Marshal() = %v, want %v", normalized, want)
+			}
+
+			wantOverrides := []Override{
+				{
+					Path: []string{"spec", "args"},
+					Lost: Source{File: "@base.yml", Line: 11, Column: 3},
+					Won:  Source{File: "@patch.yml", Line: 10, Column: 3},
+				},
+				{
+					Path: []string{"spec", "containers", "app", "image"},
+					Lost: Source{File: "@base.yml", Line: 5, Column: 7},
+					Won:  Source{File: "@patch.yml", Line: 4, Column: 7},
+				},
+			}
+			sort.Slice(report.Overrides, func(i, j int) bool {
+				return strings.Join(report.Overrides[i].Path, ".") < strings.Join(report.Overrides[j].Path, ".")
+			})
+			if !reflect.DeepEqual(report.Overrides, wantOverrides) {
+				t.Errorf("Overrides = %+v, want %+v", report.Overrides, wantOverrides)
+			}
+		})
+	}
+}
+
+func TestMarshal_KeyedListMerge_Comments(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"@a.yml": `containers:
+  # the application
+  - name: app
+    image: v1
+`,
+		"@b.yml": `containers:
+  # from b: bump image
+  - name: app # primary
+    image: v2
+`,
+	}, nil)
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+
+	result, err := tree.Marshal(&Options{
+		PackRoot:      tmpDir,
+		Mode:          ModePreserve,
+		MergeStrategy: MergeDeep,
+		ListMergeKeys: []string{"name"},
+	})
+	assertNoError(t, err)
+
+	out, err := yaml.Marshal(result)
+	assertNoError(t, err)
+	want := `containers:
+    # the application
+    # from b: bump image
+    - name: app # primary
+      image: v2
+`
+	if string(out) != want {
+		t.Errorf("Marshal() = %q, want %q", out, want)
+	}
+}
@@ -4,12 +4,15 @@ package filetree
 import (
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/jksmth/fyaml/internal/include"
+	"github.com/jksmth/fyaml/internal/json5"
 	"github.com/jksmth/fyaml/internal/logger"
+	"github.com/jksmth/fyaml/internal/packerr"
+	"github.com/jksmth/fyaml/internal/toml"
 	"go.yaml.in/yaml/v4"
 )
 
@@ -31,6 +34,36 @@ const (
 	MergeShallow MergeStrategy = "shallow"
 	// MergeDeep recursively merges nested maps, only replacing values at the leaf level.
 	MergeDeep MergeStrategy = "deep"
+	// MergeStrict recursively merges nested maps like MergeDeep, but fails when
+	// two files define the same key with a value that is not a map.
+	MergeStrict MergeStrategy = "strict"
+)
+
+// SequenceMerge controls how sequences are merged when multiple files set the same key to one.
+type SequenceMerge string
+
+const (
+	// SequenceReplace lets the later sequence replace the earlier one (default).
+	SequenceReplace SequenceMerge = "replace"
+	// SequenceAppend concatenates sequences in file order.
+	SequenceAppend SequenceMerge = "append"
+	// SequenceAppendUnique concatenates sequences in file order, leaving out
+	// items equal to one already in the sequence.
+	SequenceAppendUnique SequenceMerge = "append-unique"
+)
+
+// MultiDocument controls how files holding more than one YAML document are packed.
+type MultiDocument string
+
+const (
+	// MultiDocumentFail fails on files with more than one document (default).
+	MultiDocumentFail MultiDocument = "error"
+	// MultiDocumentMerge merges the documents of a file in order, as if each
+	// were a later file.
+	MultiDocumentMerge MultiDocument = "merge"
+	// MultiDocumentSequence packs the documents of a file as the items of a
+	// sequence under the key named by the file.
+	MultiDocumentSequence MultiDocument = "sequence"
 )
 
 // Options controls how the filetree is processed during marshaling.
@@ -38,11 +71,39 @@ type Options struct {
 	// Include processing
 	EnableIncludes bool   // Process <<include(file)>> directives
 	PackRoot       string // Absolute path to pack root (confinement boundary)
+	FS             fs.FS  // Filesystem the tree was built from with NewTreeFS; its root replaces PackRoot
 
 	// YAML processing
 	ConvertBooleans bool          // Convert unquoted YAML 1.1 booleans to true/false
+	RelaxedJSON     bool          // Read .json files with the JSON5 parser, as .jsonc and .json5 files are
 	Mode            Mode          // Marshaling mode: canonical (default) or preserve
-	MergeStrategy   MergeStrategy // Merge strategy: shallow (default) or deep
+	MergeStrategy   MergeStrategy // Merge strategy: shallow (default), deep or strict
+	AllowIdentical  bool          // With MergeStrict, allow files to repeat a key with the same value
+	SequenceMerge   SequenceMerge // Sequence merging: replace (default), append or append-unique
+
+	// Files named by their key may hold a scalar or sequence, which becomes
+	// the value of the key. Root files and @ files and directories merge into
+	// their parent, so they must still hold a map.
+	AllowNonMapFiles bool
+
+	// Files holding more than one YAML document: error (default), merge or
+	// sequence. The policy is applied to the parsed documents, so it has the
+	// same effect in both modes.
+	MultiDocument MultiDocument
+
+	// Keyed list merging, with MergeDeep or MergeStrict: sequences whose items
+	// are all maps with an identity key merge items with equal identities and
+	// append the rest. Per-path keys use dot-separated key paths, where "*"
+	// matches any single key, and take precedence over the global keys.
+	ListMergeKeys       []string            // Identity keys for every sequence, in order of preference
+	ListMergeKeysByPath map[string][]string // Identity keys by key path of the sequence
+
+	// Error handling
+	CollectErrors bool // Keep marshaling past failed files and return all errors joined
+
+	// Provenance
+	SourceMap *SourceMap // If non-nil, Marshal records where each output key came from
+	Report    *Report    // If non-nil, Marshal records the files used and keys overridden
 
 	// Logging
 	Logger logger.Logger // Logger for verbose output (nil-safe: defaults to Nop())
@@ -56,6 +117,78 @@ func (o *Options) log() logger.Logger {
 	return o.Logger
 }
 
+// skipped records an empty file in the report, if any.
+func (o *Options) skipped(p string) {
+	if o != nil && o.Report != nil {
+		o.Report.Skipped = append(o.Report.Skipped, Skipped{Path: p, Reason: SkipEmpty})
+	}
+}
+
+// allowsNonMap reports whether the child n may hold a scalar or sequence.
+// Text files, and files whose documents were packed as a sequence, always may.
+func (o *Options) allowsNonMap(n *Node) bool {
+	if n.text {
+		return true
+	}
+	return o != nil && (o.AllowNonMapFiles || n.multiDocument) && !n.mergesIntoParent()
+}
+
+// fail handles the error of a child. When errors are collected it is added to
+// errs and nil is returned so marshaling continues; otherwise err is returned.
+func (o *Options) fail(errs *[]error, err error) error {
+	if o != nil && o.CollectErrors {
+		*errs = append(*errs, err)
+		return nil
+	}
+	return err
+}
+
+// merger merges marshaled children into their parent, carrying the origin of
+// every key along with its value.
+type merger struct {
+	strategy       MergeStrategy
+	allowIdentical bool             // MergeStrict accepts keys repeated with equal values
+	sequences      SequenceMerge    // how two sequences under the same key combine
+	listKeys       []string         // identity keys for keyed list merging
+	listKeysByPath []listKeyPattern // per-path identity keys, most specific first
+	report         *Report          // nil unless overrides are recorded
+	log            logger.Logger    // receives a warning for every override
+}
+
+// newMerger returns a merger configured from opts.
+func newMerger(opts *Options) *merger {
+	// Get merge strategy from options (default to shallow)
+	strategy := MergeShallow
+	if opts != nil && (opts.MergeStrategy == MergeDeep || opts.MergeStrategy == MergeStrict) {
+		strategy = opts.MergeStrategy
+	}
+	m := &merger{strategy: strategy, sequences: SequenceReplace, log: opts.log()}
+	if opts != nil {
+		if opts.SequenceMerge == SequenceAppend || opts.SequenceMerge == SequenceAppendUnique {
+			m.sequences = opts.SequenceMerge
+		}
+		m.allowIdentical = opts.AllowIdentical
+		m.listKeys = opts.ListMergeKeys
+		m.listKeysByPath = newListKeyPatterns(opts.ListMergeKeysByPath)
+		m.report = opts.Report
+	}
+	return m
+}
+
+// mergesMaps reports whether nested maps are merged rather than replaced.
+func (m *merger) mergesMaps() bool {
+	return m.strategy == MergeDeep || m.strategy == MergeStrict
+}
+
+// conflict returns the error for a key that dst and src both define under MergeStrict.
+func (m *merger) conflict(path []string, dst, src *origin) error {
+	return &packerr.ConflictError{
+		KeyPath: path,
+		First:   dst.lastSource().String(),
+		Second:  src.lastSource().String(),
+	}
+}
+
 // MarshalYAML serializes the tree into YAML.
 // Implements yaml.Marshaler interface (called by yaml.Marshal).
 func (n *Node) MarshalYAML() (interface{}, error) {
@@ -66,69 +199,143 @@ func (n *Node) MarshalYAML() (interface{}, error) {
 // If opts is nil, processing features are disabled and canonical mode is used.
 // Returns *yaml.Node for preserve mode, interface{} for canonical mode.
 func (n *Node) Marshal(opts *Options) (interface{}, error) {
-	mode := ModeCanonical
+	result, o, err := n.marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.SourceMap != nil {
+		opts.SourceMap.record(o)
+	}
+	return result, nil
+}
+
+// marshal serializes the tree and returns the origin of the result.
+func (n *Node) marshal(opts *Options) (interface{}, *origin, error) {
 	if opts != nil && opts.Mode == ModePreserve {
-		mode = ModePreserve
+		return n.marshalPreserve(opts)
 	}
 
 	if len(n.Children) == 0 {
 		// Leaf node
-		if mode == ModePreserve {
-			return n.marshalLeafPreserve(opts)
-		}
 		return n.marshalLeaf(opts)
 	}
 
 	// Parent node
-	if mode == ModePreserve {
-		return n.marshalParentPreserve(opts)
+	if n.sequenceDirectory() {
+		return n.marshalSequence(opts)
 	}
 	return n.marshalParent(opts)
 }
 
 // parseYAMLFile reads and parses a YAML file, applying includes and boolean conversion.
-// Returns the root yaml.Node (doc.Content[0]), or nil if the file is empty/not YAML.
+// TOML, JSONC and JSON5 files are parsed into the same node model by their own
+// parsers. Returns the root yaml.Node (doc.Content[0]), or nil if the file is
+// empty/not YAML.
 func (n *Node) parseYAMLFile(opts *Options) (*yaml.Node, error) {
+	if n.text {
+		return n.readTextFile(opts)
+	}
 	if n.Info.IsDir() || !isYaml(n.Info) {
 		return nil, nil
 	}
 
 	opts.log().Debugf("Processing: %s", n.FullPath)
 
-	buf, err := os.ReadFile(n.FullPath)
+	buf, err := fs.ReadFile(n.fsys, n.Path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %w", n.FullPath, err)
 	}
 
-	var doc yaml.Node
-	if err := yaml.Unmarshal(buf, &doc); err != nil {
+	var docs []*yaml.Node
+	lang := jsonLanguage(n.Info, opts != nil && opts.RelaxedJSON)
+	if lang != "" {
+		root, err := json5.Decode(buf)
+		if err != nil {
+			return nil, packerr.FromJSON5(err, n.FullPath, lang)
+		}
+		if root != nil {
+			docs = append(docs, &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}})
+		}
+	} else if isTOML(n.Info) {
+		root, err := toml.Decode(buf)
+		if err != nil {
+			return nil, packerr.FromTOML(err, n.FullPath)
+		}
+		if len(root.Content) > 0 {
+			docs = append(docs, &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}})
+		}
+	} else if docs, err = decodeDocuments(buf); err != nil {
 		return nil, formatYAMLError(err, n.FullPath)
 	}
-	if len(doc.Content) == 0 {
-		return nil, nil
-	}
 
 	// Process includes if enabled
+	n.included = nil
+	var included []string
 	if opts != nil && opts.EnableIncludes {
-		baseDir := filepath.Dir(n.FullPath)
-		if err := include.ProcessIncludes(&doc, baseDir, opts.PackRoot); err != nil {
-			return nil, fmt.Errorf("failed to process includes in %s: %w", n.FullPath, err)
+		rec := &include.Record{Origins: include.Origins{}}
+		n.included = rec.Origins
+		for _, doc := range docs {
+			var err error
+			if opts.FS != nil {
+				err = include.ProcessIncludesFSRecorded(doc, opts.FS, path.Dir(n.Path), rec)
+			} else {
+				err = include.ProcessIncludesRecorded(doc, filepath.Dir(n.FullPath), opts.PackRoot, rec)
+			}
+			if err != nil {
+				var includeErr *packerr.IncludeError
+				if errors.As(err, &includeErr) {
+					includeErr.File = n.FullPath
+				}
+				return nil, fmt.Errorf("failed to process includes in %s: %w", n.FullPath, err)
+			}
 		}
-		if len(doc.Content) == 0 {
-			return nil, nil
+		included = rec.Files
+	}
+
+	var roots []*yaml.Node
+	for _, doc := range docs {
+		if len(doc.Content) > 0 {
+			roots = append(roots, doc.Content[0])
 		}
 	}
+	if len(roots) == 0 {
+		opts.skipped(n.Path)
+		return nil, nil
+	}
 
-	root := doc.Content[0]
+	root, err := n.joinDocuments(roots, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.Report != nil {
+		opts.Report.addFiles(n.Path)
+		opts.Report.addFiles(included...)
+	}
 
-	// Convert YAML 1.1 booleans if enabled
-	if opts != nil && opts.ConvertBooleans {
+	// Convert YAML 1.1 booleans if enabled; TOML and JSON5 strings are always
+	// quoted, and unquoted JSON5 keys are not booleans
+	if opts != nil && opts.ConvertBooleans && !isTOML(n.Info) && lang == "" {
 		normalizeYAML11Booleans(root)
 	}
 
 	return root, nil
 }
 
+// readTextFile reads a text file as a string scalar, written as a literal
+// block scalar in preserve mode.
+func (n *Node) readTextFile(opts *Options) (*yaml.Node, error) {
+	opts.log().Debugf("Processing text: %s", n.FullPath)
+
+	buf, err := fs.ReadFile(n.fsys, n.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", n.FullPath, err)
+	}
+	if opts != nil && opts.Report != nil {
+		opts.Report.addFiles(n.Path)
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(buf), Style: yaml.LiteralStyle, Line: 1, Column: 1}, nil
+}
+
 // normalizeYAML11Booleans recursively converts unquoted YAML 1.1 boolean
 // strings to canonical boolean values. Quoted strings are left unchanged.
 // Per YAML 1.1 spec: https://yaml.org/type/bool.html
@@ -161,37 +368,10 @@ func normalizeYAML11Booleans(n *yaml.Node) {
 	}
 }
 
-// formatYAMLError formats a yaml error with position information if available.
+// formatYAMLError converts a yaml error into a *packerr.ParseError carrying
+// the file and position, or a list of them for type errors.
 func formatYAMLError(err error, filePath string) error {
-	if err == nil {
-		return nil
-	}
-
-	// Check for ParserError (syntax errors)
-	var parserErr *yaml.ParserError
-	if errors.As(err, &parserErr) {
-		return fmt.Errorf("YAML/JSON syntax error in %s:%d:%d: %s",
-			filePath, parserErr.Line, parserErr.Column, parserErr.Message)
-	}
-
-	// Check for TypeError (type conversion errors)
-	var typeErr *yaml.TypeError
-	if errors.As(err, &typeErr) {
-		var errMsgs []string
-		for _, e := range typeErr.Errors {
-			if e.Line > 0 && e.Column > 0 {
-				errMsgs = append(errMsgs, fmt.Sprintf("  line %d:%d: %v",
-					e.Line, e.Column, e.Err))
-			} else {
-				errMsgs = append(errMsgs, fmt.Sprintf("  %v", e.Err))
-			}
-		}
-		return fmt.Errorf("YAML/JSON type errors in %s:\n%s",
-			filePath, strings.Join(errMsgs, "\n"))
-	}
-
-	// Fallback to generic error with file path
-	return fmt.Errorf("failed to parse YAML/JSON in %s: %w", filePath, err)
+	return packerr.FromYAML(err, filePath)
 }
 
 // NormalizeKeys recursively converts all map keys to strings.
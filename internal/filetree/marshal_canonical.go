@@ -2,41 +2,127 @@
 package filetree
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+
+	"github.com/jksmth/fyaml/internal/toml"
 )
 
 // marshal_canonical.go contains canonical mode marshaling (sorted keys, no comments).
 
-func (n *Node) marshalLeaf(opts *Options) (interface{}, error) {
+func (n *Node) marshalLeaf(opts *Options) (interface{}, *origin, error) {
 	node, err := n.parseYAMLFile(opts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if node == nil {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Decode to interface{} (loses comments and key order)
 	var content interface{}
 	if err := node.Decode(&content); err != nil {
-		return nil, formatYAMLError(err, n.FullPath)
+		return nil, nil, formatYAMLError(err, n.FullPath)
 	}
-	return content, nil
+	return localTimes(node, content), nodeOrigin(n.Path, node, ModeCanonical, n.included), nil
 }
 
-func (n *Node) marshalParent(opts *Options) (interface{}, error) {
-	subtree := map[interface{}]interface{}{}
+// localTimes returns v, decoded from n, with the times of timestamps that have
+// no zone marked by toml.Local, since decoding reads them as UTC.
+func localTimes(n *yaml.Node, v interface{}) interface{} {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n == nil {
+		return v
+	}
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if t, ok := v.(time.Time); ok {
+			return toml.Local(t, n.Value)
+		}
+	case yaml.SequenceNode:
+		if items, ok := v.([]interface{}); ok && len(items) == len(n.Content) {
+			for i, item := range n.Content {
+				items[i] = localTimes(item, items[i])
+			}
+		}
+	case yaml.MappingNode:
+		localMapTimes(n, v, map[interface{}]bool{})
+	}
+	return v
+}
+
+// localMapTimes marks the times in m, decoded from the mapping n, leaving out
+// the keys in done.
+func localMapTimes(n *yaml.Node, m interface{}, done map[interface{}]bool) {
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			continue
+		}
+		if k.ShortTag() == "!!merge" {
+			merges = append(merges, v)
+			continue
+		}
 
-	// Get merge strategy from options (default to shallow)
-	strategy := MergeShallow
-	if opts != nil && opts.MergeStrategy == MergeDeep {
-		strategy = MergeDeep
+		var key interface{}
+		if err := k.Decode(&key); err != nil || done[key] {
+			continue
+		}
+		done[key] = true
+		switch m := m.(type) {
+		case map[string]interface{}:
+			if s, ok := key.(string); ok && m[s] != nil {
+				m[s] = localTimes(v, m[s])
+			}
+		case map[interface{}]interface{}:
+			if m[key] != nil {
+				m[key] = localTimes(v, m[key])
+			}
+		}
+	}
+
+	// Explicit keys take precedence over merged ones, and earlier merges over later ones
+	for _, merge := range merges {
+		for merge.Kind == yaml.AliasNode && merge.Alias != nil {
+			merge = merge.Alias
+		}
+		targets := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			targets = merge.Content
+		}
+		for _, t := range targets {
+			for t.Kind == yaml.AliasNode && t.Alias != nil {
+				t = t.Alias
+			}
+			if t.Kind == yaml.MappingNode {
+				localMapTimes(t, m, done)
+			}
+		}
 	}
+}
+
+func (n *Node) marshalParent(opts *Options) (interface{}, *origin, error) {
+	subtree := map[interface{}]interface{}{}
+	subtreeOrigin := &origin{}
+	m := newMerger(opts)
+	path := n.keyPath()
+	var errs []error
 
 	for _, child := range n.Children {
-		c, err := child.Marshal(opts)
+		c, co, err := child.marshal(opts)
 		if err != nil {
-			return nil, err
+			if err := opts.fail(&errs, err); err != nil {
+				return nil, nil, err
+			}
+			continue
 		}
 
 		if isEmptyContent(c) {
@@ -45,25 +131,94 @@ func (n *Node) marshalParent(opts *Options) (interface{}, error) {
 
 		_, isStringMap := c.(map[string]interface{})
 		_, isInterfaceMap := c.(map[interface{}]interface{})
-		if !isStringMap && !isInterfaceMap {
-			return nil, fmt.Errorf("expected a map, got a `%T` which is not supported at this time for \"%s\"", c, child.FullPath)
+		isMap := isStringMap || isInterfaceMap
+		wrapped := false
+		switch {
+		case child.sequenceDirectory() || (!isMap && opts.allowsNonMap(child)):
+			// The value belongs to the key named by the file or directory itself
+			name := child.name()
+			c, co = map[interface{}]interface{}{name: c}, wrapOrigin(name, co, child.Path)
+			wrapped = true
+		case !isMap:
+			gotKind := "scalar"
+			if _, ok := c.([]interface{}); ok {
+				gotKind = "sequence"
+			}
+			if err := opts.fail(&errs, child.structureError(gotKind)); err != nil {
+				return nil, nil, err
+			}
+			continue
 		}
 
-		if child.rootFile() || child.specialCaseDirectory() || child.specialCase() {
-			subtree, err = mergeTree(subtree, c, strategy)
+		if wrapped || child.mergesIntoParent() {
+			subtree, err = m.mergeTree(subtree, c, subtreeOrigin, co, path)
 		} else {
-			subtree[child.name()], err = mergeTree(subtree[child.name()], c, strategy)
+			// The key is named by the file or directory itself
+			name := child.name()
+			nameSource := &origin{sources: []Source{{File: child.Path}}}
+			dv, exists := subtree[name]
+			replaced := exists && toInterfaceMap(dv) == nil
+			if replaced && m.strategy == MergeStrict {
+				err = m.conflict(appendKey(path, name), subtreeOrigin.get(name), nameSource)
+			} else {
+				if replaced {
+					// A value that is not a map is replaced by the child's map
+					m.override(appendKey(path, name), subtreeOrigin.get(name), nameSource)
+					delete(subtree, name)
+					subtreeOrigin.replace(name, nameSource)
+				} else {
+					subtreeOrigin.addSources(name, nameSource)
+				}
+				subtree[name], err = m.mergeTree(subtree[name], c, subtreeOrigin.get(name), co, appendKey(path, name))
+			}
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to merge tree for %s: %w", child.FullPath, err)
+			if err := opts.fail(&errs, fmt.Errorf("failed to merge tree for %s: %w", child.FullPath, err)); err != nil {
+				return nil, nil, err
+			}
 		}
 	}
 
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
 	if len(subtree) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	return subtree, nil
+	return subtree, subtreeOrigin, nil
+}
+
+// marshalSequence marshals a sequence directory: each child, in sorted order,
+// becomes one item of the sequence.
+func (n *Node) marshalSequence(opts *Options) (interface{}, *origin, error) {
+	var seq []interface{}
+	seqOrigin := &origin{}
+	var errs []error
+
+	for _, child := range n.Children {
+		c, co, err := child.marshal(opts)
+		if err != nil {
+			if err := opts.fail(&errs, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if isEmptyContent(c) {
+			continue
+		}
+		seq = append(seq, c)
+		seqOrigin.appendItem(itemOrigin(co, child.Path))
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	if len(seq) == 0 {
+		return nil, nil, nil
+	}
+
+	return seq, seqOrigin, nil
 }
 
 // isEmptyContent checks if a value is nil or an empty map.
@@ -81,13 +236,16 @@ func isEmptyContent(v interface{}) bool {
 }
 
 // mergeTree merges dst and src maps based on strategy, returning the merged result.
+// The origins of src keys are merged into dstOrigin the same way; either origin
+// may be nil when provenance is not needed. path is the key path of dst.
 //
 // Note: We don't need to sort keys here because yaml.v4's encoder automatically sorts
 // map keys during encoding. For map[interface{}]interface{}, it sorts by type order
 // (bool < int < string) then by value within each type. This provides deterministic
 // canonical output without explicit sorting.
-// Per CircleCI behavior, later values overwrite earlier values (no collision errors).
-func mergeTree(dst, src interface{}, strategy MergeStrategy) (map[interface{}]interface{}, error) {
+// Per CircleCI behavior, later values overwrite earlier values (no collision errors),
+// except with MergeStrict, which returns a *packerr.ConflictError instead.
+func (m *merger) mergeTree(dst, src interface{}, dstOrigin, srcOrigin *origin, path []string) (map[interface{}]interface{}, error) {
 	// Handle nil dst - start with empty map
 	result := toInterfaceMap(dst)
 	if result == nil {
@@ -104,24 +262,166 @@ func mergeTree(dst, src interface{}, strategy MergeStrategy) (map[interface{}]in
 		return nil, fmt.Errorf("expected map, got %T", src)
 	}
 
-	// Merge src into result
-	for k, v := range srcMap {
-		if strategy == MergeDeep {
+	// Merge src into result, in key order so warnings and conflicts are deterministic
+	for _, k := range sortedKeys(srcMap) {
+		v := srcMap[k]
+		if m.mergesMaps() {
 			dstVal := toInterfaceMap(result[k])
 			srcVal := toInterfaceMap(v)
 			if dstVal != nil && srcVal != nil {
-				// Recursive merge - error can't happen since types are already validated
-				merged, _ := mergeTree(dstVal, srcVal, strategy)
+				// Recursive merge - only strict conflicts can fail since types are already validated
+				srcChild := srcOrigin.get(k)
+				merged, err := m.mergeTree(dstVal, srcVal, dstOrigin.addSources(k, srcChild), srcChild, appendKey(path, k))
+				if err != nil {
+					return nil, err
+				}
+				result[k] = merged
+				continue
+			}
+			dstSeq, dstOk := result[k].([]interface{})
+			srcSeq, srcOk := v.([]interface{})
+			if keys := m.identityKeys(appendKey(path, k)); dstOk && srcOk && isKeyedSequence(dstSeq, keys) && isKeyedSequence(srcSeq, keys) {
+				srcChild := srcOrigin.get(k)
+				merged, err := m.mergeKeyedSequence(dstSeq, srcSeq, dstOrigin.addSources(k, srcChild), srcChild, appendKey(path, k), keys)
+				if err != nil {
+					return nil, err
+				}
 				result[k] = merged
 				continue
 			}
 		}
+		if m.sequences != SequenceReplace {
+			dstSeq, dstOk := result[k].([]interface{})
+			srcSeq, srcOk := v.([]interface{})
+			if dstOk && srcOk {
+				result[k] = m.appendSequence(dstSeq, srcSeq)
+				dstOrigin.addSources(k, srcOrigin.get(k))
+				continue
+			}
+		}
+		if dv, exists := result[k]; exists {
+			if m.strategy == MergeStrict {
+				if !m.allowIdentical || !reflect.DeepEqual(dv, v) {
+					return nil, m.conflict(appendKey(path, k), dstOrigin.get(k), srcOrigin.get(k))
+				}
+				// An identical value is kept, with both files as its sources
+				dstOrigin.addSources(k, srcOrigin.get(k))
+				continue
+			}
+			m.override(appendKey(path, k), dstOrigin.get(k), srcOrigin.get(k))
+		}
 		result[k] = v
+		dstOrigin.replace(k, srcOrigin.get(k))
 	}
 
 	return result, nil
 }
 
+// mergeKeyedSequence merges the items of src into dst by identity: an item
+// whose identity matches one in dst is merged into it with mergeTree, and
+// other items are appended. Items are addressed in key paths by their
+// identity value.
+func (m *merger) mergeKeyedSequence(dst, src []interface{}, dstOrigin, srcOrigin *origin, path []string, keys []string) ([]interface{}, error) {
+	result := append(make([]interface{}, 0, len(dst)+len(src)), dst...)
+	for i, item := range src {
+		key, id, _ := itemIdentity(item, keys)
+		j := indexByIdentity(result, key, id, keys)
+		if j < 0 {
+			result = append(result, item)
+			dstOrigin.appendItem(srcOrigin.item(i))
+			continue
+		}
+		// The identity key is equal on both sides, so it is neither an override nor a conflict
+		merged, err := m.mergeTree(result[j], withoutKey(item, key), dstOrigin.item(j), srcOrigin.item(i), appendKey(path, id))
+		if err != nil {
+			return nil, err
+		}
+		result[j] = merged
+	}
+	return result, nil
+}
+
+// withoutKey returns a copy of the map item without key.
+func withoutKey(item interface{}, key string) map[interface{}]interface{} {
+	result := make(map[interface{}]interface{})
+	for k, v := range toInterfaceMap(item) {
+		if k != key {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// itemIdentity returns the first of keys that item has, with its value.
+func itemIdentity(item interface{}, keys []string) (key string, id interface{}, ok bool) {
+	m := toInterfaceMap(item)
+	for _, k := range keys {
+		if v, exists := m[k]; exists {
+			return k, v, true
+		}
+	}
+	return "", nil, false
+}
+
+// isKeyedSequence reports whether every item of seq has an identity.
+func isKeyedSequence(seq []interface{}, keys []string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	for _, item := range seq {
+		if _, _, ok := itemIdentity(item, keys); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// indexByIdentity returns the index of the item of seq with the given
+// identity, or -1.
+func indexByIdentity(seq []interface{}, key string, id interface{}, keys []string) int {
+	for i, item := range seq {
+		if k, v, _ := itemIdentity(item, keys); k == key && reflect.DeepEqual(v, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendSequence returns a new sequence with the items of src appended to dst.
+// With SequenceAppendUnique, items equal to one already present are left out.
+func (m *merger) appendSequence(dst, src []interface{}) []interface{} {
+	result := append(make([]interface{}, 0, len(dst)+len(src)), dst...)
+	for _, item := range src {
+		if m.sequences == SequenceAppendUnique && containsValue(result, item) {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// containsValue reports whether seq holds an item equal to v.
+func containsValue(seq []interface{}, v interface{}) bool {
+	for _, item := range seq {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of m sorted by their string form.
+func sortedKeys(m map[interface{}]interface{}) []interface{} {
+	keys := make([]interface{}, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprintf("%v", keys[i]) < fmt.Sprintf("%v", keys[j])
+	})
+	return keys
+}
+
 // toInterfaceMap converts either map type to map[interface{}]interface{}, or returns nil.
 func toInterfaceMap(v interface{}) map[interface{}]interface{} {
 	switch m := v.(type) {
@@ -1,11 +1,14 @@
 package filetree
 
 import (
+	"errors"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/jksmth/fyaml/internal/logger"
+	"github.com/jksmth/fyaml/internal/packerr"
 	"go.yaml.in/yaml/v4"
 )
 
@@ -52,7 +55,7 @@ func TestMarshalCanonical_WithIncludes(t *testing.T) {
 		t.Fatal("Could not find item1.yml node")
 	}
 
-	result, err := testNode.marshalLeaf(opts)
+	result, _, err := testNode.marshalLeaf(opts)
 	assertNoError(t, err)
 
 	resultMap := asMap(t, result)
@@ -260,7 +263,7 @@ func TestMergeTree_InvalidInput(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := mergeTree(nil, tt.input, MergeShallow)
+			result, err := (&merger{strategy: MergeShallow}).mergeTree(nil, tt.input, nil, nil, nil)
 			if tt.expectError {
 				assertErrorContains(t, err, tt.errorSubstr)
 			} else {
@@ -683,3 +686,249 @@ func TestYAMLEncoderDeterministic(t *testing.T) {
 		}
 	}
 }
+
+func TestMarshalCanonical_StrictMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          map[string]string
+		allowIdentical bool
+		wantErr        *packerr.ConflictError
+	}{
+		{
+			name: "disjoint keys merge recursively",
+			files: map[string]string{
+				"@base.yml":     "config:\n  nested:\n    a: 1\n",
+				"@override.yml": "config:\n  nested:\n    b: 2\n",
+			},
+		},
+		{
+			name: "conflicting leaf",
+			files: map[string]string{
+				"@base.yml":     "config:\n  nested:\n    a: 1\n",
+				"@override.yml": "config:\n  nested:\n    a: 2\n",
+			},
+			wantErr: &packerr.ConflictError{
+				KeyPath: []string{"config", "nested", "a"},
+				First:   "@base.yml:3:5",
+				Second:  "@override.yml:3:5",
+			},
+		},
+		{
+			name: "map replaced by scalar",
+			files: map[string]string{
+				"jobs/build.yml":  "image: node\n",
+				"jobs/@other.yml": "build: none\n",
+			},
+			wantErr: &packerr.ConflictError{
+				KeyPath: []string{"jobs", "build"},
+				First:   "jobs/@other.yml:1:1",
+				Second:  "jobs/build.yml",
+			},
+		},
+		{
+			name: "identical duplicate rejected",
+			files: map[string]string{
+				"@a.yml": "key: value\n",
+				"@b.yml": "key: value\n",
+			},
+			wantErr: &packerr.ConflictError{
+				KeyPath: []string{"key"},
+				First:   "@a.yml:1:1",
+				Second:  "@b.yml:1:1",
+			},
+		},
+		{
+			name: "identical duplicate allowed",
+			files: map[string]string{
+				"@a.yml": "key: [1, 2]\n",
+				"@b.yml": "key: [1, 2]\n",
+			},
+			allowIdentical: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTestDir(t, tt.files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			_, err = tree.Marshal(&Options{
+				PackRoot:       tmpDir,
+				MergeStrategy:  MergeStrict,
+				AllowIdentical: tt.allowIdentical,
+				Logger:         logger.Nop(),
+			})
+			if tt.wantErr == nil {
+				assertNoError(t, err)
+				return
+			}
+			var conflict *packerr.ConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("Marshal() error = %v, want *packerr.ConflictError", err)
+			}
+			if !reflect.DeepEqual(conflict, tt.wantErr) {
+				t.Errorf("ConflictError = %+v, want %+v", conflict, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMarshalCanonical_SequenceMerge(t *testing.T) {
+	files := map[string]string{
+		"@a.yml": "steps: [checkout, build]\nconfig:\n  tags: [x]\n",
+		"@b.yml": "steps: [build, test]\nconfig:\n  tags: [y]\n",
+	}
+
+	tests := []struct {
+		name      string
+		strategy  MergeStrategy
+		sequences SequenceMerge
+		wantSteps []interface{}
+		wantTags  []interface{}
+	}{
+		{"replace", MergeDeep, SequenceReplace, []interface{}{"build", "test"}, []interface{}{"y"}},
+		{"append", MergeDeep, SequenceAppend, []interface{}{"checkout", "build", "build", "test"}, []interface{}{"x", "y"}},
+		{"append unique", MergeDeep, SequenceAppendUnique, []interface{}{"checkout", "build", "test"}, []interface{}{"x", "y"}},
+		{"append with strict", MergeStrict, SequenceAppend, []interface{}{"checkout", "build", "build", "test"}, []interface{}{"x", "y"}},
+		{"append with shallow", MergeShallow, SequenceAppend, []interface{}{"checkout", "build", "build", "test"}, []interface{}{"y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTestDir(t, files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			result, err := tree.Marshal(&Options{
+				PackRoot:      tmpDir,
+				MergeStrategy: tt.strategy,
+				SequenceMerge: tt.sequences,
+				Logger:        logger.Nop(),
+			})
+			assertNoError(t, err)
+
+			resultMap := asMap(t, result)
+			if !reflect.DeepEqual(resultMap["steps"], tt.wantSteps) {
+				t.Errorf("steps = %v, want %v", resultMap["steps"], tt.wantSteps)
+			}
+			if tags := asMap(t, resultMap["config"])["tags"]; !reflect.DeepEqual(tags, tt.wantTags) {
+				t.Errorf("config.tags = %v, want %v", tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestMarshalCanonical_SequenceDirectory(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"workflow.yml":                        "name: ci\n",
+		"jobs/build/steps[]/01-checkout.yml":  "uses: actions/checkout@v4\n",
+		"jobs/build/steps[]/02-test.yml":      "run: make test\n",
+		"jobs/build/steps[]/03-empty.yml":     "",
+		"jobs/build/steps[]/04-deploy/@a.yml": "run: deploy\n",
+		"jobs/build/steps[]/05-tags[]/a.yml":  "x\n",
+		"jobs/build/steps[]/05-tags[]/b.yml":  "[y, z]\n",
+	}, []string{"empty[]"})
+
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+	sourceMap := &SourceMap{}
+	result, err := tree.Marshal(&Options{PackRoot: tmpDir, SourceMap: sourceMap, Logger: logger.Nop()})
+	assertNoError(t, err)
+
+	resultMap := asMap(t, result)
+	if _, ok := resultMap["empty"]; ok {
+		t.Errorf("empty sequence directory should not create a key, got %v", resultMap)
+	}
+	steps := asMap(t, asMap(t, asMap(t, resultMap["jobs"])["build"]))["steps"]
+	want := []interface{}{
+		map[string]interface{}{"uses": "actions/checkout@v4"},
+		map[string]interface{}{"run": "make test"},
+		map[interface{}]interface{}{"run": "deploy"},
+		[]interface{}{"x", []interface{}{"y", "z"}},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps = %#v, want %#v", steps, want)
+	}
+
+	var stepsSources []Source
+	for _, e := range sourceMap.Entries {
+		if strings.Join(e.Path, ".") == "jobs.build.steps" {
+			stepsSources = e.Sources
+		}
+	}
+	if wantSources := []Source{{File: "jobs/build/steps[]"}}; !reflect.DeepEqual(stepsSources, wantSources) {
+		t.Errorf("sources of jobs.build.steps = %v, want %v", stepsSources, wantSources)
+	}
+}
+
+func TestMarshalCanonical_DottedDirectoryName(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"v1.2/config.yml":   "a: 1\n",
+		"list.d[]/item.yml": "b: 2\n",
+	}, nil)
+
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+	result, err := tree.Marshal(&Options{PackRoot: tmpDir, Logger: logger.Nop()})
+	assertNoError(t, err)
+
+	// Only sequence directories keep the part after a dot in their key
+	resultMap := asMap(t, result)
+	if _, ok := resultMap["v1"]; !ok {
+		t.Errorf("v1.2/ should be keyed as v1, got %v", resultMap)
+	}
+	if _, ok := resultMap["list.d"]; !ok {
+		t.Errorf("list.d[]/ should be keyed as list.d, got %v", resultMap)
+	}
+}
+
+func TestMarshalCanonical_SequenceDirectoryMerge(t *testing.T) {
+	files := map[string]string{
+		"@base.yml":         "servers:\n  - url: https://base\n",
+		"servers[]/a.yml":   "url: https://a\n",
+		"servers[]/b.yml":   "url: https://b\n",
+		"config.yml":        "key: value\n",
+		"config[]/item.yml": "key: item\n",
+	}
+
+	tests := []struct {
+		name      string
+		strategy  MergeStrategy
+		sequences SequenceMerge
+		want      int // number of servers
+		wantErr   string
+	}{
+		{"replace", MergeShallow, SequenceReplace, 2, ""},
+		{"append", MergeShallow, SequenceAppend, 3, ""},
+		{"strict", MergeStrict, SequenceReplace, 0, "conflicting values for key servers in @base.yml:1:1 and servers[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTestDir(t, files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			result, err := tree.Marshal(&Options{
+				PackRoot:      tmpDir,
+				MergeStrategy: tt.strategy,
+				SequenceMerge: tt.sequences,
+				Logger:        logger.Nop(),
+			})
+			if tt.wantErr != "" {
+				assertErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assertNoError(t, err)
+
+			resultMap := asMap(t, result)
+			if servers, _ := resultMap["servers"].([]interface{}); len(servers) != tt.want {
+				t.Errorf("servers = %v, want %d items", resultMap["servers"], tt.want)
+			}
+			if _, ok := resultMap["config"].([]interface{}); !ok {
+				t.Errorf("config = %v, want the sequence from config[]", resultMap["config"])
+			}
+		})
+	}
+}
@@ -2,46 +2,72 @@
 package filetree
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 
 	"go.yaml.in/yaml/v4"
 )
 
 // marshal_preserve.go contains preserve mode marshaling (authored order, with comments).
 
-func (n *Node) marshalLeafPreserve(opts *Options) (*yaml.Node, error) {
-	return n.parseYAMLFile(opts)
+// marshalPreserve serializes the tree in preserve mode and returns the origin
+// of the result.
+func (n *Node) marshalPreserve(opts *Options) (*yaml.Node, *origin, error) {
+	if len(n.Children) == 0 {
+		return n.marshalLeafPreserve(opts)
+	}
+	if n.sequenceDirectory() {
+		return n.marshalSequencePreserve(opts)
+	}
+	return n.marshalParentPreserve(opts)
 }
 
-func (n *Node) marshalParentPreserve(opts *Options) (*yaml.Node, error) {
-	subtree := newMapping()
-
-	// Get merge strategy from options (default to shallow)
-	strategy := MergeShallow
-	if opts != nil && opts.MergeStrategy == MergeDeep {
-		strategy = MergeDeep
+func (n *Node) marshalLeafPreserve(opts *Options) (*yaml.Node, *origin, error) {
+	node, err := n.parseYAMLFile(opts)
+	if err != nil || node == nil {
+		return nil, nil, err
 	}
+	return node, nodeOrigin(n.Path, node, ModePreserve, n.included), nil
+}
+
+func (n *Node) marshalParentPreserve(opts *Options) (*yaml.Node, *origin, error) {
+	subtree := newMapping()
+	subtreeOrigin := &origin{}
+	m := newMerger(opts)
+	path := n.keyPath()
+	var errs []error
 
 	for _, child := range n.Children {
-		var c *yaml.Node
-		var err error
-		if len(child.Children) == 0 {
-			c, err = child.marshalLeafPreserve(opts)
-		} else {
-			c, err = child.marshalParentPreserve(opts)
-		}
+		c, co, err := child.marshalPreserve(opts)
 		if err != nil {
-			return nil, err
+			if err := opts.fail(&errs, err); err != nil {
+				return nil, nil, err
+			}
+			continue
 		}
 		if isEmptyNode(c) {
 			continue
 		}
-		if c.Kind != yaml.MappingNode {
-			return nil, fmt.Errorf("expected a map, got a `%v` which is not supported at this time for \"%s\"", c.Kind, child.FullPath)
+		wrapped := false
+		switch {
+		case child.sequenceDirectory() || (c.Kind != yaml.MappingNode && opts.allowsNonMap(child)):
+			// The value belongs to the key named by the file or directory itself
+			c, co = wrapNode(child.name(), c, co, child.Path)
+			wrapped = true
+		case c.Kind != yaml.MappingNode:
+			gotKind := "scalar"
+			if c.Kind == yaml.SequenceNode {
+				gotKind = "sequence"
+			}
+			if err := opts.fail(&errs, child.structureError(gotKind)); err != nil {
+				return nil, nil, err
+			}
+			continue
 		}
 
-		if child.rootFile() || child.specialCaseDirectory() || child.specialCase() {
-			mergeMapping(subtree, c, strategy)
+		if wrapped || child.mergesIntoParent() {
+			err = m.mergeMapping(subtree, c, subtreeOrigin, co, path)
 		} else {
 			childName := child.name()
 			dv, ok := mappingGet(subtree, childName)
@@ -49,15 +75,78 @@ func (n *Node) marshalParentPreserve(opts *Options) (*yaml.Node, error) {
 				dv = newMapping()
 				mappingSet(subtree, newScalarKey(childName), dv)
 			}
-			mergeMapping(dv, c, strategy)
+			// The key is named by the file or directory itself
+			nameSource := &origin{sources: []Source{{File: child.Path}}}
+			if dv.Kind != yaml.MappingNode && m.strategy == MergeStrict {
+				err = m.conflict(appendKey(path, childName), subtreeOrigin.get(childName), nameSource)
+			} else {
+				if dv.Kind != yaml.MappingNode {
+					// A value that is not a map is replaced by the child's map
+					m.override(appendKey(path, childName), subtreeOrigin.get(childName), nameSource)
+					dv = newMapping()
+					mappingReplace(subtree, childName, dv)
+					subtreeOrigin.replace(childName, nameSource)
+				} else {
+					subtreeOrigin.addSources(childName, nameSource)
+				}
+				err = m.mergeMapping(dv, c, subtreeOrigin.get(childName), co, appendKey(path, childName))
+			}
+		}
+		if err != nil {
+			if err := opts.fail(&errs, fmt.Errorf("failed to merge tree for %s: %w", child.FullPath, err)); err != nil {
+				return nil, nil, err
+			}
 		}
 	}
 
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
 	if len(subtree.Content) == 0 {
-		return nil, nil
+		return nil, nil, nil
+	}
+
+	return subtree, subtreeOrigin, nil
+}
+
+// marshalSequencePreserve marshals a sequence directory: each child, in sorted
+// order, becomes one item of the sequence node, with its comments.
+func (n *Node) marshalSequencePreserve(opts *Options) (*yaml.Node, *origin, error) {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	seqOrigin := &origin{}
+	var errs []error
+
+	for _, child := range n.Children {
+		c, co, err := child.marshalPreserve(opts)
+		if err != nil {
+			if err := opts.fail(&errs, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if isEmptyNode(c) {
+			continue
+		}
+		seq.Content = append(seq.Content, c)
+		seqOrigin.appendItem(itemOrigin(co, child.Path))
 	}
 
-	return subtree, nil
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	if len(seq.Content) == 0 {
+		return nil, nil, nil
+	}
+
+	return seq, seqOrigin, nil
+}
+
+// wrapNode returns a mapping node holding n under key, for merging a value
+// whose key is named by file into its parent.
+func wrapNode(key string, n *yaml.Node, o *origin, file string) (*yaml.Node, *origin) {
+	m := newMapping()
+	mappingSet(m, newScalarKey(key), n)
+	return m, wrapOrigin(key, o, file)
 }
 
 // isEmptyNode checks if a yaml.Node is nil or an empty mapping.
@@ -95,19 +184,33 @@ func mappingSet(m *yaml.Node, keyNode, valNode *yaml.Node) {
 	m.Content = append(m.Content, keyNode, valNode)
 }
 
+// mappingReplace replaces the value of key in a mapping node, keeping the
+// comments of the key.
+func mappingReplace(m *yaml.Node, key string, valNode *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if k := m.Content[i]; k.Kind == yaml.ScalarNode && k.Value == key {
+			m.Content[i+1] = valNode
+			return
+		}
+	}
+}
+
 // newScalarKey creates a scalar key node from a string.
 func newScalarKey(s string) *yaml.Node {
 	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
 }
 
 // mergeMapping merges src mapping node into dst mapping node.
-// Later (src) values overwrite earlier (dst) values - "later wins" semantics.
-func mergeMapping(dst, src *yaml.Node, strategy MergeStrategy) {
+// Later (src) values overwrite earlier (dst) values - "later wins" semantics -
+// except with MergeStrict, which returns a *packerr.ConflictError instead.
+// The origins of src keys are merged into dstOrigin the same way; either origin
+// may be nil when provenance is not needed. path is the key path of dst.
+func (m *merger) mergeMapping(dst, src *yaml.Node, dstOrigin, srcOrigin *origin, path []string) error {
 	if src == nil || dst == nil {
-		return
+		return nil
 	}
 	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
-		return
+		return nil
 	}
 
 	// Build index of dst keys -> key node position
@@ -127,17 +230,185 @@ func mergeMapping(dst, src *yaml.Node, strategy MergeStrategy) {
 			// New key - add it
 			mappingSet(dst, srcKey, srcVal)
 			dstIndex[k] = len(dst.Content) - 2
+			dstOrigin.replace(k, srcOrigin.get(k))
 			continue
 		}
 
 		// Existing key - deep merge if both are maps, otherwise replace
-		if strategy == MergeDeep {
-			dstVal := dst.Content[dstKeyPos+1]
+		dstVal := dst.Content[dstKeyPos+1]
+		if m.mergesMaps() {
 			if dstVal.Kind == yaml.MappingNode && srcVal.Kind == yaml.MappingNode {
-				mergeMapping(dstVal, srcVal, strategy)
+				srcChild := srcOrigin.get(k)
+				if err := m.mergeMapping(dstVal, srcVal, dstOrigin.addSources(k, srcChild), srcChild, appendKey(path, k)); err != nil {
+					return err
+				}
 				continue
 			}
+			if keys := m.identityKeys(appendKey(path, k)); isKeyedSequenceNode(dstVal, keys) && isKeyedSequenceNode(srcVal, keys) {
+				srcChild := srcOrigin.get(k)
+				if err := m.mergeKeyedSequenceNode(dstVal, srcVal, dstOrigin.addSources(k, srcChild), srcChild, appendKey(path, k), keys); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if m.sequences != SequenceReplace && dstVal.Kind == yaml.SequenceNode && srcVal.Kind == yaml.SequenceNode {
+			m.appendSequenceNode(dstVal, srcVal)
+			dstOrigin.addSources(k, srcOrigin.get(k))
+			continue
+		}
+		if m.strategy == MergeStrict {
+			if !m.allowIdentical || !nodesEqual(dstVal, srcVal) {
+				return m.conflict(appendKey(path, k), dstOrigin.get(k), srcOrigin.get(k))
+			}
+			// An identical value is kept, with both files as its sources
+			dstOrigin.addSources(k, srcOrigin.get(k))
+			continue
 		}
+		m.override(appendKey(path, k), dstOrigin.get(k), srcOrigin.get(k))
 		dst.Content[dstKeyPos+1] = srcVal
+		dstOrigin.replace(k, srcOrigin.get(k))
+	}
+	return nil
+}
+
+// mergeKeyedSequenceNode merges the items of the src sequence node into dst by
+// identity: an item whose identity matches one in dst is merged into it with
+// mergeMapping, keeping the comments of both, and other items are appended.
+// Items are addressed in key paths by their identity value.
+func (m *merger) mergeKeyedSequenceNode(dst, src *yaml.Node, dstOrigin, srcOrigin *origin, path []string, keys []string) error {
+	for i, item := range src.Content {
+		key, id := itemIdentityNode(item, keys)
+		j := indexByIdentityNode(dst, key, id, keys)
+		if j < 0 {
+			dst.Content = append(dst.Content, item)
+			dstOrigin.appendItem(srcOrigin.item(i))
+			continue
+		}
+		// The identity key is equal on both sides, so it is neither an override nor a conflict
+		if err := m.mergeMapping(dst.Content[j], withoutKeyNode(item, key), dstOrigin.item(j), srcOrigin.item(i), appendKey(path, id.Value)); err != nil {
+			return err
+		}
+		mergeComments(dst.Content[j], item)
+		dstKey, dstID := mappingGetPair(dst.Content[j], key)
+		srcKey, srcID := mappingGetPair(item, key)
+		mergeComments(dstKey, srcKey)
+		mergeComments(dstID, srcID)
+	}
+	return nil
+}
+
+// mappingGetPair finds a key in a mapping node and returns its key and value
+// nodes, or nil nodes if it is missing.
+func mappingGetPair(m *yaml.Node, key string) (keyNode, val *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if k := m.Content[i]; k.Kind == yaml.ScalarNode && k.Value == key {
+			return k, m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// mergeComments adds the comments of src to dst, after those dst already
+// has. Both nodes may be nil.
+func mergeComments(dst, src *yaml.Node) {
+	if dst == nil || src == nil {
+		return
+	}
+	dst.HeadComment = appendComment(dst.HeadComment, src.HeadComment, "\n")
+	dst.LineComment = appendComment(dst.LineComment, src.LineComment, " ")
+	dst.FootComment = appendComment(dst.FootComment, src.FootComment, "\n")
+}
+
+// appendComment returns comment a followed by b, joined by sep. A comment
+// already in a is not repeated.
+func appendComment(a, b, sep string) string {
+	switch {
+	case b == "" || a == b:
+		return a
+	case a == "":
+		return b
+	}
+	return a + sep + b
+}
+
+// withoutKeyNode returns a copy of the mapping node n without key.
+func withoutKeyNode(n *yaml.Node, key string) *yaml.Node {
+	c := *n
+	c.Content = nil
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != key {
+			c.Content = append(c.Content, n.Content[i], n.Content[i+1])
+		}
+	}
+	return &c
+}
+
+// itemIdentityNode returns the first of keys that the item mapping node has,
+// with its value node, or a nil value node if it has none.
+func itemIdentityNode(item *yaml.Node, keys []string) (key string, id *yaml.Node) {
+	for _, k := range keys {
+		if v, ok := mappingGet(item, k); ok {
+			return k, v
+		}
+	}
+	return "", nil
+}
+
+// isKeyedSequenceNode reports whether n is a sequence whose every item has an identity.
+func isKeyedSequenceNode(n *yaml.Node, keys []string) bool {
+	if len(keys) == 0 || n.Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, item := range n.Content {
+		if _, id := itemIdentityNode(item, keys); id == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// indexByIdentityNode returns the index of the item of the seq node with the
+// given identity, or -1.
+func indexByIdentityNode(seq *yaml.Node, key string, id *yaml.Node, keys []string) int {
+	for i, item := range seq.Content {
+		if k, v := itemIdentityNode(item, keys); k == key && nodesEqual(v, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendSequenceNode appends the items of src to the dst sequence node.
+// With SequenceAppendUnique, items equal to one already present are left out.
+func (m *merger) appendSequenceNode(dst, src *yaml.Node) {
+	for _, item := range src.Content {
+		if m.sequences == SequenceAppendUnique && containsNode(dst, item) {
+			continue
+		}
+		dst.Content = append(dst.Content, item)
+	}
+}
+
+// containsNode reports whether the seq node holds an item equal to n.
+func containsNode(seq, n *yaml.Node) bool {
+	for _, item := range seq.Content {
+		if nodesEqual(item, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodesEqual reports whether two nodes decode to the same value, ignoring
+// comments and style.
+func nodesEqual(a, b *yaml.Node) bool {
+	var av, bv interface{}
+	if err := a.Decode(&av); err != nil {
+		return false
+	}
+	if err := b.Decode(&bv); err != nil {
+		return false
 	}
+	return reflect.DeepEqual(av, bv)
 }
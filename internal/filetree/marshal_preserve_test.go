@@ -1,11 +1,14 @@
 package filetree
 
 import (
+	"errors"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/jksmth/fyaml/internal/logger"
+	"github.com/jksmth/fyaml/internal/packerr"
 	"go.yaml.in/yaml/v4"
 )
 
@@ -123,7 +126,8 @@ func TestMergeMapping(t *testing.T) {
 	mappingSet(src, newScalarKey("key1"), &yaml.Node{Kind: yaml.ScalarNode, Value: "value1_updated"})
 	mappingSet(src, newScalarKey("key2"), &yaml.Node{Kind: yaml.ScalarNode, Value: "value2"})
 
-	mergeMapping(dst, src, MergeShallow)
+	m := &merger{strategy: MergeShallow}
+	m.mergeMapping(dst, src, nil, nil, nil)
 
 	val1, ok := mappingGet(dst, "key1")
 	if !ok {
@@ -165,14 +169,15 @@ func TestIsEmptyNode(t *testing.T) {
 }
 
 func TestMergeMapping_NilInputs(t *testing.T) {
-	mergeMapping(nil, newMapping(), MergeShallow)
+	m := &merger{strategy: MergeShallow}
+	m.mergeMapping(nil, newMapping(), nil, nil, nil)
 
 	dst := newMapping()
-	mergeMapping(dst, nil, MergeShallow)
+	m.mergeMapping(dst, nil, nil, nil, nil)
 
 	scalar := &yaml.Node{Kind: yaml.ScalarNode, Value: "test"}
-	mergeMapping(dst, scalar, MergeShallow)
-	mergeMapping(scalar, dst, MergeShallow)
+	m.mergeMapping(dst, scalar, nil, nil, nil)
+	m.mergeMapping(scalar, dst, nil, nil, nil)
 }
 
 func TestMappingGet_EdgeCases(t *testing.T) {
@@ -212,7 +217,7 @@ func TestMarshalPreserve_WithIncludes(t *testing.T) {
 		t.Fatal("Could not find item1.yml node")
 	}
 
-	result, err := testNode.marshalLeafPreserve(opts)
+	result, _, err := testNode.marshalLeafPreserve(opts)
 	assertNoError(t, err)
 
 	if result == nil {
@@ -918,3 +923,163 @@ func TestMarshalPreserve_DeepMerge(t *testing.T) {
 		t.Error("Deep merge should include 'c' from override file")
 	}
 }
+
+func TestMarshalPreserve_StrictMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          map[string]string
+		allowIdentical bool
+		wantErr        *packerr.ConflictError
+	}{
+		{
+			name: "disjoint keys merge recursively",
+			files: map[string]string{
+				"@base.yml":     "config:\n  nested:\n    a: 1\n",
+				"@override.yml": "config:\n  nested:\n    b: 2\n",
+			},
+		},
+		{
+			name: "conflicting leaf",
+			files: map[string]string{
+				"@base.yml":     "config:\n  nested:\n    a: 1\n",
+				"@override.yml": "config:\n  nested:\n    a: 2\n",
+			},
+			wantErr: &packerr.ConflictError{
+				KeyPath: []string{"config", "nested", "a"},
+				First:   "@base.yml:3:5",
+				Second:  "@override.yml:3:5",
+			},
+		},
+		{
+			name: "map replaced by scalar",
+			files: map[string]string{
+				"jobs/build.yml":  "image: node\n",
+				"jobs/@other.yml": "build: none\n",
+			},
+			wantErr: &packerr.ConflictError{
+				KeyPath: []string{"jobs", "build"},
+				First:   "jobs/@other.yml:1:1",
+				Second:  "jobs/build.yml",
+			},
+		},
+		{
+			name: "identical duplicate rejected",
+			files: map[string]string{
+				"@a.yml": "key: value\n",
+				"@b.yml": "key: value\n",
+			},
+			wantErr: &packerr.ConflictError{
+				KeyPath: []string{"key"},
+				First:   "@a.yml:1:1",
+				Second:  "@b.yml:1:1",
+			},
+		},
+		{
+			name: "identical duplicate allowed",
+			files: map[string]string{
+				"@a.yml": "key: [1, 2]\n",
+				"@b.yml": "key: [1, 2]\n",
+			},
+			allowIdentical: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTestDir(t, tt.files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			_, err = tree.Marshal(&Options{
+				PackRoot:       tmpDir,
+				Mode:           ModePreserve,
+				MergeStrategy:  MergeStrict,
+				AllowIdentical: tt.allowIdentical,
+				Logger:         logger.Nop(),
+			})
+			if tt.wantErr == nil {
+				assertNoError(t, err)
+				return
+			}
+			var conflict *packerr.ConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("Marshal() error = %v, want *packerr.ConflictError", err)
+			}
+			if !reflect.DeepEqual(conflict, tt.wantErr) {
+				t.Errorf("ConflictError = %+v, want %+v", conflict, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMarshalPreserve_SequenceMerge(t *testing.T) {
+	files := map[string]string{
+		"@a.yml": "steps:\n    - checkout # first\n    - build\n",
+		"@b.yml": "steps:\n    - build\n    - test # last\n",
+	}
+
+	tests := []struct {
+		name      string
+		sequences SequenceMerge
+		want      string
+	}{
+		{"replace", SequenceReplace, "steps:\n    - build\n    - test # last\n"},
+		{"append", SequenceAppend, "steps:\n    - checkout # first\n    - build\n    - build\n    - test # last\n"},
+		{"append unique", SequenceAppendUnique, "steps:\n    - checkout # first\n    - build\n    - test # last\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTestDir(t, files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			result, err := tree.Marshal(&Options{
+				PackRoot:      tmpDir,
+				Mode:          ModePreserve,
+				MergeStrategy: MergeDeep,
+				SequenceMerge: tt.sequences,
+				Logger:        logger.Nop(),
+			})
+			assertNoError(t, err)
+
+			out, err := yaml.Marshal(result)
+			assertNoError(t, err)
+			if string(out) != tt.want {
+				t.Errorf("Marshal() = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalPreserve_SequenceDirectory(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{
+		"name.yml":                "value: ci\n",
+		"steps[]/01-checkout.yml": "# Check out the code\nuses: actions/checkout@v4\nwith:\n    depth: 1\n",
+		"steps[]/02-test.yml":     "run: make test # fast\n",
+		"steps[]/03-tags[]/a.yml": "x\n",
+		"steps[]/03-tags[]/b.yml": "- y\n- z\n",
+		"steps[]/04-empty.yml":    "",
+	}, nil)
+
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+	result, err := tree.Marshal(&Options{PackRoot: tmpDir, Mode: ModePreserve, Logger: logger.Nop()})
+	assertNoError(t, err)
+
+	out, err := yaml.Marshal(result)
+	assertNoError(t, err)
+	want := "value: ci\n" +
+		"steps:\n" +
+		"    - # Check out the code\n" +
+		"      uses: actions/checkout@v4\n" +
+		"      with:\n" +
+		"        depth: 1\n" +
+		"    - run: make test # fast\n" +
+		"    - - x\n" +
+		"      - - y\n" +
+		"        - z\n"
+	if string(out) != want {
+		t.Errorf("Marshal() = %q, want %q", out, want)
+	}
+}
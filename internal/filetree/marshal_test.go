@@ -1,13 +1,16 @@
 package filetree
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/jksmth/fyaml/internal/logger"
+	"github.com/jksmth/fyaml/internal/packerr"
 	"go.yaml.in/yaml/v4"
 )
 
@@ -343,6 +346,14 @@ func TestMarshal_FormatYAMLError_ParserError(t *testing.T) {
 			if !strings.Contains(err.Error(), ":") {
 				t.Errorf("Expected position information (line:column) in error message, got: %s", err.Error())
 			}
+
+			var parseErr *packerr.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected *packerr.ParseError, got %T", err)
+			}
+			if parseErr.File != testFile || parseErr.Line != 1 || parseErr.Column == 0 {
+				t.Errorf("ParseError = %+v, want %s at line 1 with a column", parseErr, testFile)
+			}
 		})
 	}
 }
@@ -383,9 +394,9 @@ func TestMarshal_WithIncludes_ErrorCases(t *testing.T) {
 
 			var err2 error
 			if tt.mode == ModePreserve {
-				_, err2 = testNode.marshalLeafPreserve(opts)
+				_, _, err2 = testNode.marshalLeafPreserve(opts)
 			} else {
-				_, err2 = testNode.marshalLeaf(opts)
+				_, _, err2 = testNode.marshalLeaf(opts)
 			}
 			assertErrorContains(t, err2, "could not open")
 		})
@@ -432,9 +443,9 @@ func TestMarshal_FileReadError(t *testing.T) {
 
 			var err2 error
 			if tt.mode == ModePreserve {
-				_, err2 = testNode.marshalLeafPreserve(opts)
+				_, _, err2 = testNode.marshalLeafPreserve(opts)
 			} else {
-				_, err2 = testNode.marshalLeaf(opts)
+				_, _, err2 = testNode.marshalLeaf(opts)
 			}
 			assertErrorContains(t, err2, "failed to read file")
 		})
@@ -475,6 +486,14 @@ func TestMarshal_NonMapTypeError(t *testing.T) {
 			_, err = dirNode.Marshal(opts)
 			assertErrorContains(t, err, "expected a map")
 			assertErrorContains(t, err, "scalar.yml")
+
+			var structErr *packerr.StructureError
+			if !errors.As(err, &structErr) {
+				t.Fatalf("Expected *packerr.StructureError, got %T", err)
+			}
+			if structErr.GotKind != "scalar" || !reflect.DeepEqual(structErr.KeyPath, []string{"dir", "scalar"}) {
+				t.Errorf("StructureError = %+v, want scalar at [dir scalar]", structErr)
+			}
 		})
 	}
 }
@@ -662,3 +681,359 @@ func deepEqual(a, b interface{}) bool {
 		return a == b
 	}
 }
+
+func TestMarshal_CollectErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		mode Mode
+	}{
+		{"canonical", ModeCanonical},
+		{"preserve", ModePreserve},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTestDir(t, map[string]string{
+				"a/broken.yml":   "key: [unclosed",
+				"a/good.yml":     "key: value",
+				"b/list.yml":     "- one",
+				"c/nested/x.yml": "key: {unclosed",
+			}, nil)
+
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			opts := &Options{
+				PackRoot:      tmpDir,
+				Mode:          tt.mode,
+				CollectErrors: true,
+				Logger:        logger.Nop(),
+			}
+
+			result, err := tree.Marshal(opts)
+			if err == nil {
+				t.Fatalf("Marshal() = %v, want an error", result)
+			}
+			for _, file := range []string{"broken.yml", "list.yml", "x.yml"} {
+				assertErrorContains(t, err, file)
+			}
+			var structErr *packerr.StructureError
+			if !errors.As(err, &structErr) {
+				t.Errorf("Expected the joined error to contain a *packerr.StructureError, got %v", err)
+			}
+
+			// Without CollectErrors, marshaling stops at the first error
+			opts.CollectErrors = false
+			_, err = tree.Marshal(opts)
+			assertErrorContains(t, err, "broken.yml")
+			if strings.Contains(err.Error(), "list.yml") {
+				t.Errorf("Expected only the first error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestMarshal_AllowNonMapFiles(t *testing.T) {
+	files := map[string]string{
+		"service/timeout.yml":  "30\n",
+		"service/tags.yml":     "- web # public\n- api\n",
+		"service/name.yml":     "\"web\"\n",
+		"service/@base.yml":    "tags:\n  - base\nport: 80\n",
+		"service/nested/x.yml": "key: value\n",
+	}
+	want := map[Mode]string{
+		ModeCanonical: "service:\n    name: web\n    nested:\n        x:\n            key: value\n    port: 80\n    tags:\n        - base\n        - web\n        - api\n    timeout: 30\n",
+		ModePreserve:  "service:\n    tags:\n        - base\n        - web # public\n        - api\n    port: 80\n    name: \"web\"\n    nested:\n        x:\n            key: value\n    timeout: 30\n",
+	}
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			tmpDir := createTestDir(t, files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			opts := &Options{
+				PackRoot:         tmpDir,
+				Mode:             mode,
+				SequenceMerge:    SequenceAppend,
+				AllowNonMapFiles: true,
+				Logger:           logger.Nop(),
+			}
+			result, err := tree.Marshal(opts)
+			assertNoError(t, err)
+			out, err := yaml.Marshal(result)
+			assertNoError(t, err)
+			if string(out) != want[mode] {
+				t.Errorf("Marshal() = %q, want %q", out, want[mode])
+			}
+
+			// The same content is still rejected without the option
+			opts.AllowNonMapFiles = false
+			_, err = tree.Marshal(opts)
+			assertErrorContains(t, err, "which is not supported at this time")
+		})
+	}
+}
+
+func TestMarshal_AllowNonMapFiles_MergedFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"root file", map[string]string{"timeout.yml": "30\n"}, "expected a map, got a `scalar` in"},
+		{"@ file", map[string]string{"service/@tags.yml": "- web\n"}, "expected a map, got a `sequence` in"},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+			t.Run(tt.name+"/"+string(mode), func(t *testing.T) {
+				tmpDir := createTestDir(t, tt.files, nil)
+				tree, err := NewTree(tmpDir)
+				assertNoError(t, err)
+
+				_, err = tree.Marshal(&Options{PackRoot: tmpDir, Mode: mode, AllowNonMapFiles: true, Logger: logger.Nop()})
+				assertErrorContains(t, err, tt.want)
+				assertErrorContains(t, err, "which merges into its parent map")
+				var structErr *packerr.StructureError
+				if !errors.As(err, &structErr) || !structErr.MergesIntoParent {
+					t.Errorf("error = %v, want a *packerr.StructureError with MergesIntoParent", err)
+				}
+			})
+		}
+	}
+}
+
+func TestMarshal_MultiDocument(t *testing.T) {
+	files := map[string]string{
+		"service/config.yml": "# defaults\nport: 80\nname: web\n---\n# production\nport: 443\n---\n",
+		"service/other.yml":  "key: value\n",
+	}
+	tests := []struct {
+		policy MultiDocument
+		want   map[Mode]string
+	}{
+		{MultiDocumentMerge, map[Mode]string{
+			ModeCanonical: "service:\n    config:\n        name: web\n        port: 443\n    other:\n        key: value\n",
+			ModePreserve:  "service:\n    config:\n        # defaults\n        port: 443\n        name: web\n    other:\n        key: value\n",
+		}},
+		{MultiDocumentSequence, map[Mode]string{
+			ModeCanonical: "service:\n    config:\n        - name: web\n          port: 80\n        - port: 443\n    other:\n        key: value\n",
+			ModePreserve:  "service:\n    config:\n        - # defaults\n          port: 80\n          name: web\n        - # production\n          port: 443\n    other:\n        key: value\n",
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+			t.Run(string(tt.policy)+"/"+string(mode), func(t *testing.T) {
+				tmpDir := createTestDir(t, files, nil)
+				tree, err := NewTree(tmpDir)
+				assertNoError(t, err)
+
+				result, err := tree.Marshal(&Options{PackRoot: tmpDir, Mode: mode, MultiDocument: tt.policy, Logger: logger.Nop()})
+				assertNoError(t, err)
+				out, err := yaml.Marshal(result)
+				assertNoError(t, err)
+				if string(out) != tt.want[mode] {
+					t.Errorf("Marshal() = %q, want %q", out, tt.want[mode])
+				}
+			})
+		}
+	}
+}
+
+func TestMarshal_MultiDocumentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		policy   MultiDocument
+		wantLine int
+		want     string
+	}{
+		{"default", map[string]string{"a/b.yml": "x: 1\n---\nx: 2\n"}, "", 3, "set a multi-document policy"},
+		{"merge scalar", map[string]string{"a/b.yml": "x: 1\n---\n- 2\n"}, MultiDocumentMerge, 3, "document 2 is a sequence"},
+		{"sequence @ file", map[string]string{"a/@b.yml": "x: 1\n---\nx: 2\n"}, MultiDocumentSequence, 3, "merges into its parent map"},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+			t.Run(tt.name+"/"+string(mode), func(t *testing.T) {
+				tmpDir := createTestDir(t, tt.files, nil)
+				tree, err := NewTree(tmpDir)
+				assertNoError(t, err)
+
+				_, err = tree.Marshal(&Options{PackRoot: tmpDir, Mode: mode, MultiDocument: tt.policy, Logger: logger.Nop()})
+				assertErrorContains(t, err, tt.want)
+				var docErr *packerr.MultiDocumentError
+				if !errors.As(err, &docErr) || docErr.Line != tt.wantLine || docErr.Documents != 2 {
+					t.Errorf("error = %#v, want a *packerr.MultiDocumentError at line %d", err, tt.wantLine)
+				}
+			})
+		}
+	}
+}
+
+func TestMarshal_MultiDocumentStrictConflict(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"a/b.yml": "x: 1\n---\nx: 2\n"}, nil)
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+
+	_, err = tree.Marshal(&Options{PackRoot: tmpDir, MergeStrategy: MergeStrict, MultiDocument: MultiDocumentMerge, Logger: logger.Nop()})
+	assertErrorContains(t, err, "conflicting values for key a.b.x in a/b.yml:1:1 and a/b.yml:3:1")
+}
+
+func TestMarshal_TextExtensions(t *testing.T) {
+	files := map[string]string{
+		"scripts/deploy.SH":   "#!/bin/sh\necho deploy\n",
+		"scripts/config.yml":  "shell: sh\n",
+		"scripts/empty.txt":   "",
+		"scripts/notes.md":    "# Notes\n",
+		"readme.txt":          "top level\n",
+		"scripts/query.sql":   "SELECT 1;\n",
+		"scripts/ignored.css": "body {}\n",
+	}
+	want := map[Mode]string{
+		ModeCanonical: "readme: |\n    top level\nscripts:\n    config:\n        shell: sh\n    deploy: |\n        #!/bin/sh\n        echo deploy\n    empty: \"\"\n    query: |\n        SELECT 1;\n",
+		ModePreserve:  "readme: |\n    top level\nscripts:\n    config:\n        shell: sh\n    deploy: |\n        #!/bin/sh\n        echo deploy\n    empty: \"\"\n    query: |\n        SELECT 1;\n",
+	}
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			tmpDir := createTestDir(t, files, nil)
+			tree, err := NewTreeWithOptions(tmpDir, TreeOptions{TextExtensions: []string{".sh", "sql", ".txt"}})
+			assertNoError(t, err)
+
+			result, err := tree.Marshal(&Options{PackRoot: tmpDir, Mode: mode, Logger: logger.Nop()})
+			assertNoError(t, err)
+			out, err := yaml.Marshal(result)
+			assertNoError(t, err)
+			if string(out) != want[mode] {
+				t.Errorf("Marshal() = %q, want %q", out, want[mode])
+			}
+		})
+	}
+}
+
+func TestMarshal_TOMLFiles(t *testing.T) {
+	files := map[string]string{
+		"app/@base.toml":   "# Defaults\nname = \"web\"\nport = 80\n",
+		"app/@local.yml":   "port: 8080\n",
+		"app/server.toml":  "[tls]\nenabled = true\n\n[[routes]]\npath = \"/\"\n",
+		"app/empty.toml":   "# nothing yet\n",
+		"app/enabled.toml": "value = \"yes\"\n",
+	}
+	want := map[Mode]string{
+		ModeCanonical: "app:\n    enabled:\n        value: \"yes\"\n    name: web\n    port: 8080\n    server:\n        routes:\n            - path: /\n        tls:\n            enabled: true\n",
+		ModePreserve:  "app:\n    # Defaults\n    name: web\n    port: 8080\n    enabled:\n        value: yes\n    server:\n        tls:\n            enabled: true\n        routes:\n            - path: /\n",
+	}
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			tmpDir := createTestDir(t, files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			result, err := tree.Marshal(&Options{PackRoot: tmpDir, Mode: mode, MergeStrategy: MergeDeep, ConvertBooleans: true, Logger: logger.Nop()})
+			assertNoError(t, err)
+			out, err := yaml.Marshal(result)
+			assertNoError(t, err)
+			if string(out) != want[mode] {
+				t.Errorf("Marshal() = %q, want %q", out, want[mode])
+			}
+		})
+	}
+}
+
+func TestMarshal_JSON5Files(t *testing.T) {
+	files := map[string]string{
+		"app/@base.jsonc":  "// Defaults\n{\n  \"name\": \"web\",\n  \"port\": 80, // http\n}\n",
+		"app/@local.yml":   "port: 8080\n",
+		"app/server.json5": "{\n  tls: {enabled: true},\n  /* Routes */\n  routes: ['/', '/api',],\n}\n",
+		"app/flags.jsonc":  "{\n  on: \"yes\"\n}\n",
+		"app/legacy.json":  "{\"debug\": false,}\n",
+		"app/empty.jsonc":  "// nothing yet\n",
+	}
+	want := map[Mode]string{
+		ModeCanonical: "app:\n    flags:\n        \"on\": \"yes\"\n    legacy:\n        debug: false\n    name: web\n    port: 8080\n    server:\n        routes:\n            - /\n            - /api\n        tls:\n            enabled: true\n",
+		ModePreserve:  "app:\n    # Defaults\n    \"name\": \"web\"\n    \"port\": 8080\n    flags:\n        on: \"yes\"\n    legacy:\n        \"debug\": false\n    server:\n        tls: {enabled: true}\n        # Routes\n        routes: ['/', '/api']\n",
+	}
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			tmpDir := createTestDir(t, files, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			result, err := tree.Marshal(&Options{PackRoot: tmpDir, Mode: mode, MergeStrategy: MergeDeep, ConvertBooleans: true, RelaxedJSON: true, Logger: logger.Nop()})
+			assertNoError(t, err)
+			out, err := yaml.Marshal(result)
+			assertNoError(t, err)
+			if string(out) != want[mode] {
+				t.Errorf("Marshal() = %q, want %q", out, want[mode])
+			}
+		})
+	}
+}
+
+func TestMarshal_JSON5SyntaxError(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		relaxed  bool
+		language string
+	}{
+		{"jsonc", "config.jsonc", "{\n  \"port\": 80\n  \"host\": \"a\"\n}\n", false, "JSONC"},
+		{"relaxed json", "config.json", "{\n  \"port\": 80\n  \"host\": \"a\"\n}\n", true, "JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := createTestDir(t, map[string]string{"app/" + tt.file: tt.content}, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			_, err = tree.Marshal(&Options{PackRoot: tmpDir, RelaxedJSON: tt.relaxed, Logger: logger.Nop()})
+			var parseErr *packerr.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Marshal() error = %v, want a *packerr.ParseError", err)
+			}
+			if parseErr.Language != tt.language || parseErr.Line != 3 || parseErr.Column != 3 {
+				t.Errorf("ParseError = %+v, want a %s error at 3:3", parseErr, tt.language)
+			}
+			assertErrorContains(t, err, "expected , or } in the object")
+		})
+	}
+}
+
+func TestMarshal_StrictJSON(t *testing.T) {
+	tmpDir := createTestDir(t, map[string]string{"app/config.json": "{\n  // HTTP port\n  \"port\": 80\n}\n"}, nil)
+	tree, err := NewTree(tmpDir)
+	assertNoError(t, err)
+
+	_, err = tree.Marshal(&Options{PackRoot: tmpDir, Logger: logger.Nop()})
+	var parseErr *packerr.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Language != "" {
+		t.Errorf("Marshal() error = %v, want a YAML/JSON *packerr.ParseError", err)
+	}
+}
+
+func TestMarshal_TOMLSyntaxError(t *testing.T) {
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			tmpDir := createTestDir(t, map[string]string{"app/config.toml": "[server]\nport = 80\nport = 81\n"}, nil)
+			tree, err := NewTree(tmpDir)
+			assertNoError(t, err)
+
+			_, err = tree.Marshal(&Options{PackRoot: tmpDir, Mode: mode, Logger: logger.Nop()})
+			var parseErr *packerr.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Marshal() error = %v, want a *packerr.ParseError", err)
+			}
+			if parseErr.File != filepath.Join(tmpDir, "app", "config.toml") || parseErr.Line != 3 || parseErr.Column != 1 {
+				t.Errorf("ParseError = %+v, want app/config.toml at 3:1", parseErr)
+			}
+			assertErrorContains(t, err, "key server.port is already defined")
+		})
+	}
+}
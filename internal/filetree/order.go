@@ -0,0 +1,162 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jksmth/fyaml/internal/logger"
+)
+
+// order.go contains the ordering of siblings: by path, by numeric ordering
+// prefixes such as 010-build.yml, or as listed in a directory's .order file.
+
+// OrderFile is the name of the files listing the order of a directory's children.
+const OrderFile = ".order"
+
+var orderPrefixRe = regexp.MustCompile(`^([0-9]+)-(.+)$`)
+
+// orderPrefix splits an ordering prefix such as "010-" off name.
+func orderPrefix(name string) (order int, rest string, ok bool) {
+	m := orderPrefixRe.FindStringSubmatch(name)
+	if m == nil {
+		return 0, name, false
+	}
+	order, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, name, false
+	}
+	return order, m[2], true
+}
+
+// orderFile is the content of an order file.
+type orderFile struct {
+	file    string   // Slash-separated path of the file within its filesystem
+	path    string   // Path of the file, as shown in messages
+	entries []string // Child names, in order
+}
+
+// readOrderFile reads the order file of dir in fsys, or nil if it has none.
+// Blank lines and lines starting with "#" are skipped.
+func readOrderFile(fsys fs.FS, dir string) (*orderFile, error) {
+	file := path.Join(dir, OrderFile)
+	data, err := fs.ReadFile(fsys, file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return &orderFile{file: file, path: file, entries: entries}, nil
+}
+
+// lessChildren reports whether sibling a sorts before b. Siblings are
+// compared by slash-separated path, which is deterministic across platforms.
+// With ordering prefixes, prefixed siblings come first, by prefix value.
+func lessChildren(a, b *Node) bool {
+	if a.orderPrefixes {
+		ao, _, aok := orderPrefix(a.basename())
+		bo, _, bok := orderPrefix(b.basename())
+		if aok != bok {
+			return aok
+		}
+		if aok && ao != bo {
+			return ao < bo
+		}
+	}
+	return a.Path < b.Path
+}
+
+// sortChildren sorts the children of node and its descendants. Children
+// listed in their directory's order file come first, in the listed order, and
+// the rest follow sorted by lessChildren. An entry names a child by its file
+// or directory name, or by its key.
+// Entries that match no child are warned about and recorded in pathNodes.
+func sortChildren(node *Node, pathNodes *PathNodes, log logger.Logger) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		return lessChildren(node.Children[i], node.Children[j])
+	})
+
+	if order, ok := pathNodes.orders[node.Path]; ok {
+		rank := make(map[*Node]int, len(node.Children))
+		for i, entry := range order.entries {
+			found := false
+			for _, child := range node.Children {
+				if child.basename() != entry && child.name() != entry {
+					continue
+				}
+				found = true
+				if _, ranked := rank[child]; !ranked {
+					rank[child] = i
+				}
+			}
+			if !found {
+				pathNodes.warn(log, WarnOrderEntry, order.file, "%s lists %q, which matches no packed file or directory", order.path, entry)
+			}
+		}
+		sort.SliceStable(node.Children, func(i, j int) bool {
+			ri, iok := rank[node.Children[i]]
+			rj, jok := rank[node.Children[j]]
+			if iok != jok {
+				return iok
+			}
+			return iok && ri < rj
+		})
+	}
+
+	for _, child := range node.Children {
+		sortChildren(child, pathNodes, log)
+	}
+}
+
+// checkOrderPrefixes returns an error for siblings under node that name the
+// same key only once their ordering prefixes are stripped, such as
+// 010-build.yml and build.yml, which would otherwise be merged unnoticed.
+// Items of sequence directories have no keys and are not compared.
+func checkOrderPrefixes(node *Node) error {
+	if !node.sequenceDirectory() {
+		seen := make(map[string]*Node, len(node.Children))
+		for _, child := range node.Children {
+			if child.mergesIntoParent() {
+				continue
+			}
+			key := child.name()
+			other, ok := seen[key]
+			if !ok {
+				seen[key] = child
+				continue
+			}
+			if other.prefixedName() != child.prefixedName() {
+				return fmt.Errorf("%s and %s both name key %q once their ordering prefixes are stripped", other.FullPath, child.FullPath, key)
+			}
+		}
+	}
+
+	for _, child := range node.Children {
+		if err := checkOrderPrefixes(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package filetree
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jksmth/fyaml/internal/logger"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestOrderPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantN    int
+		wantRest string
+		wantOK   bool
+	}{
+		{"010-build", 10, "build", true},
+		{"2-test", 2, "test", true},
+		{"build", 0, "build", false},
+		{"010-", 0, "010-", false},
+		{"v1-build", 0, "v1-build", false},
+	}
+	for _, tt := range tests {
+		n, rest, ok := orderPrefix(tt.name)
+		if n != tt.wantN || rest != tt.wantRest || ok != tt.wantOK {
+			t.Errorf("orderPrefix(%q) = %d, %q, %v, want %d, %q, %v", tt.name, n, rest, ok, tt.wantN, tt.wantRest, tt.wantOK)
+		}
+	}
+}
+
+// childPaths returns the paths of the children of n, in order.
+func childPaths(n *Node) string {
+	var paths []string
+	for _, child := range n.Children {
+		paths = append(paths, child.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestNewTreeFS_OrderPrefixes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ci/10-test.yml":    {Data: []byte("run: test")},
+		"ci/9-build.yml":    {Data: []byte("run: build")},
+		"ci/100-deploy.yml": {Data: []byte("run: deploy")},
+		"ci/@base.yml":      {Data: []byte("name: ci")},
+		"ci/020-jobs/a.yml": {Data: []byte("key: a")},
+		"ci/notes.yml":      {Data: []byte("key: notes")},
+	}
+
+	tree, err := NewTreeFSWithOptions(fsys, TreeOptions{OrderPrefixes: true})
+	assertNoError(t, err)
+	ci := tree.Children[0]
+	if got, want := childPaths(ci), "ci/9-build.yml,ci/10-test.yml,ci/020-jobs,ci/100-deploy.yml,ci/@base.yml,ci/notes.yml"; got != want {
+		t.Errorf("children = %s, want %s", got, want)
+	}
+
+	result, err := tree.Marshal(&Options{FS: fsys, Mode: ModePreserve})
+	assertNoError(t, err)
+	out, err := yaml.Marshal(result)
+	assertNoError(t, err)
+	want := "ci:\n" +
+		"    build:\n        run: build\n" +
+		"    test:\n        run: test\n" +
+		"    jobs:\n        a:\n            key: a\n" +
+		"    deploy:\n        run: deploy\n" +
+		"    name: ci\n" +
+		"    notes:\n        key: notes\n"
+	if string(out) != want {
+		t.Errorf("Marshal() = %q, want %q", out, want)
+	}
+
+	// Without the option, prefixes are part of the key and sorting is by path
+	tree, err = NewTreeFS(fsys)
+	assertNoError(t, err)
+	ci = tree.Children[0]
+	if got, want := childPaths(ci), "ci/020-jobs,ci/10-test.yml,ci/100-deploy.yml,ci/9-build.yml,ci/@base.yml,ci/notes.yml"; got != want {
+		t.Errorf("children = %s, want %s", got, want)
+	}
+	if name := ci.Children[0].name(); name != "020-jobs" {
+		t.Errorf("name() = %q, want 020-jobs", name)
+	}
+}
+
+func TestNewTreeFS_OrderFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		".order":          {Data: []byte("# sections\njobs\non.yml\n\nname\nmissing\njobs\n")},
+		"name.yml":        {Data: []byte("value: ci")},
+		"on.yml":          {Data: []byte("push: {}")},
+		"jobs/build.yml":  {Data: []byte("runs-on: ubuntu")},
+		"jobs/.order":     {Data: []byte("test\n")},
+		"jobs/test.yml":   {Data: []byte("runs-on: ubuntu")},
+		"env.yml":         {Data: []byte("CI: true")},
+		"permissions.yml": {Data: []byte("contents: read")},
+	}
+
+	var buf bytes.Buffer
+	tree, err := NewTreeFSWithOptions(fsys, TreeOptions{OrderPrefixes: true, Logger: logger.New(&buf, false)})
+	assertNoError(t, err)
+
+	if got, want := childPaths(tree), "jobs,on.yml,name.yml,env.yml,permissions.yml"; got != want {
+		t.Errorf("children = %s, want %s", got, want)
+	}
+	if got, want := childPaths(tree.Children[0]), "jobs/test.yml,jobs/build.yml"; got != want {
+		t.Errorf("jobs children = %s, want %s", got, want)
+	}
+	if want := "[WARN] .order lists \"missing\", which matches no packed file or directory\n"; buf.String() != want {
+		t.Errorf("log = %q, want %q", buf.String(), want)
+	}
+
+	// Without the option, .order files are ignored like other dotfiles
+	tree, err = NewTreeFS(fsys)
+	assertNoError(t, err)
+	if got, want := childPaths(tree), "env.yml,jobs,name.yml,on.yml,permissions.yml"; got != want {
+		t.Errorf("children = %s, want %s", got, want)
+	}
+	if got, want := childPaths(tree.Children[1]), "jobs/build.yml,jobs/test.yml"; got != want {
+		t.Errorf("jobs children = %s, want %s", got, want)
+	}
+}
+
+func TestNewTreeFS_OrderPrefixCollision(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+	}{
+		{
+			name: "prefixed and plain",
+			files: fstest.MapFS{
+				"ci/010-build.yml": {Data: []byte("run: a")},
+				"ci/build.yml":     {Data: []byte("run: b")},
+			},
+			wantErr: `ci/010-build.yml and ci/build.yml both name key "build" once their ordering prefixes are stripped`,
+		},
+		{
+			name: "two prefixes",
+			files: fstest.MapFS{
+				"ci/010-build.yml":   {Data: []byte("run: a")},
+				"ci/020-build/a.yml": {Data: []byte("run: b")},
+			},
+			wantErr: `ci/010-build.yml and ci/020-build both name key "build"`,
+		},
+		{
+			// A file and a directory with the same name merge, as without prefixes
+			name: "same prefix",
+			files: fstest.MapFS{
+				"ci/010-build.yml":   {Data: []byte("run: a")},
+				"ci/010-build/a.yml": {Data: []byte("run: b")},
+			},
+		},
+		{
+			name: "sequence items",
+			files: fstest.MapFS{
+				"steps[]/010-a.yml": {Data: []byte("run: a")},
+				"steps[]/a.yml":     {Data: []byte("run: b")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTreeFSWithOptions(tt.files, TreeOptions{OrderPrefixes: true})
+			if tt.wantErr == "" {
+				assertNoError(t, err)
+				return
+			}
+			assertErrorContains(t, err, tt.wantErr)
+
+			// Without the option, the prefix is part of the key
+			_, err = NewTreeFS(tt.files)
+			assertNoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// report.go contains the record of what happened while marshaling a tree.
+
+// Report collects the files used and the keys overridden while marshaling.
+type Report struct {
+	Files     []string   // Files whose content was read, in merge order; included files follow their includer
+	Skipped   []Skipped  // Files left out because they were empty
+	Overrides []Override // Keys whose value was replaced by a later file
+}
+
+// Override is a key whose value from one source was replaced by another's.
+type Override struct {
+	Path []string // Key path of the replaced value
+	Lost Source   // Where the replaced value was set
+	Won  Source   // Where the value in the output was set
+}
+
+// addFiles records files as read, skipping those already listed.
+func (r *Report) addFiles(files ...string) {
+	for _, f := range files {
+		if !slices.Contains(r.Files, f) {
+			r.Files = append(r.Files, f)
+		}
+	}
+}
+
+// lastSource returns the source that won, or the zero Source if unknown.
+func (o *origin) lastSource() Source {
+	if o == nil || len(o.sources) == 0 {
+		return Source{}
+	}
+	return o.sources[len(o.sources)-1]
+}
+
+// override warns that the value at path from dst was replaced by src, and
+// records it in the report, if any.
+func (m *merger) override(path []string, dst, src *origin) {
+	o := Override{
+		Path: path,
+		Lost: dst.lastSource(),
+		Won:  src.lastSource(),
+	}
+	if m.log != nil {
+		m.log.Warnf("%s", o.Message())
+	}
+	if m.report != nil {
+		m.report.Overrides = append(m.report.Overrides, o)
+	}
+}
+
+// Message describes the override in the words used for warnings.
+func (o Override) Message() string {
+	return fmt.Sprintf("key %s from %s overridden by %s", strings.Join(o.Path, "."), o.Lost, o.Won)
+}
+
+// keyPath returns the key path that the content of n is merged into.
+// Root files and @ files and directories merge into their parent's map.
+func (n *Node) keyPath() []string {
+	if n.Parent == nil {
+		return nil
+	}
+	parent := n.Parent.keyPath()
+	if n.mergesIntoParent() {
+		return parent
+	}
+	return appendKey(parent, n.name())
+}
+
+// appendKey returns a new key path with key added to path.
+func appendKey(path []string, key interface{}) []string {
+	// Key paths use the same string form as JSON output (see NormalizeKeys)
+	return append(append(make([]string, 0, len(path)+1), path...), fmt.Sprintf("%v", key))
+}
@@ -0,0 +1,148 @@
+package filetree
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+
+	"github.com/jksmth/fyaml/internal/logger"
+)
+
+// report_test.go contains tests for marshal reports (report.go).
+
+func TestReport(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/@a.yml":    "build:\n  image: x\n  shell: bash\n",
+		"jobs/@b.yml":    "build:\n  image: y\n",
+		"jobs/empty.yml": "# nothing here\n",
+		"version.yml":    "version: 2\n",
+	}, nil)
+
+	tests := []struct {
+		strategy  MergeStrategy
+		overrides []Override
+	}{
+		{MergeShallow, []Override{{
+			Path: []string{"jobs", "build"},
+			Lost: Source{File: "jobs/@a.yml", Line: 1, Column: 1},
+			Won:  Source{File: "jobs/@b.yml", Line: 1, Column: 1},
+		}}},
+		{MergeDeep, []Override{{
+			Path: []string{"jobs", "build", "image"},
+			Lost: Source{File: "jobs/@a.yml", Line: 2, Column: 3},
+			Won:  Source{File: "jobs/@b.yml", Line: 2, Column: 3},
+		}}},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+			t.Run(string(tt.strategy)+"/"+string(mode), func(t *testing.T) {
+				tree, err := NewTree(dir)
+				assertNoError(t, err)
+				report := &Report{}
+				_, err = tree.Marshal(&Options{PackRoot: dir, Mode: mode, MergeStrategy: tt.strategy, Report: report})
+				assertNoError(t, err)
+
+				if want := []string{"jobs/@a.yml", "jobs/@b.yml", "version.yml"}; !reflect.DeepEqual(report.Files, want) {
+					t.Errorf("Files = %v, want %v", report.Files, want)
+				}
+				if want := []Skipped{{Path: "jobs/empty.yml", Reason: SkipEmpty}}; !reflect.DeepEqual(report.Skipped, want) {
+					t.Errorf("Skipped = %v, want %v", report.Skipped, want)
+				}
+				if !reflect.DeepEqual(report.Overrides, tt.overrides) {
+					t.Errorf("Overrides = %+v, want %+v", report.Overrides, tt.overrides)
+				}
+			})
+		}
+	}
+}
+
+func TestReport_OverrideNamedByFile(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"entities/@base.yml": "item:\n  id: base\n",
+		"entities/item.yml":  "id: example\n",
+	}, nil)
+
+	tree, err := NewTree(dir)
+	assertNoError(t, err)
+	report := &Report{}
+	_, err = tree.Marshal(&Options{PackRoot: dir, Report: report})
+	assertNoError(t, err)
+
+	want := []Override{{
+		Path: []string{"entities", "item", "id"},
+		Lost: Source{File: "entities/@base.yml", Line: 2, Column: 3},
+		Won:  Source{File: "entities/item.yml", Line: 1, Column: 1},
+	}}
+	if !reflect.DeepEqual(report.Overrides, want) {
+		t.Errorf("Overrides = %+v, want %+v", report.Overrides, want)
+	}
+}
+
+func TestReport_OverrideWarnings(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"@a.yml": "name: a\nport: 80\nhost: x\n",
+		"@b.yml": "port: 81\nname: b\n",
+	}, nil)
+
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			tree, err := NewTree(dir)
+			assertNoError(t, err)
+			var buf strings.Builder
+			_, err = tree.Marshal(&Options{PackRoot: dir, Mode: mode, Logger: logger.New(&buf, false)})
+			assertNoError(t, err)
+
+			// Canonical mode merges in key order, preserve mode in authored order
+			want := []string{
+				"[WARN] key name from @a.yml:1:1 overridden by @b.yml:2:1",
+				"[WARN] key port from @a.yml:2:1 overridden by @b.yml:1:1",
+			}
+			if mode == ModePreserve {
+				want[0], want[1] = want[1], want[0]
+			}
+			if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+				t.Errorf("warnings = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestReport_ScalarReplacedByFile(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"sub/@a.yml":  "foo: 1\n",
+		"sub/foo.yml": "x: 1\n",
+	}, nil)
+
+	for _, strategy := range []MergeStrategy{MergeShallow, MergeDeep} {
+		for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+			t.Run(string(strategy)+"/"+string(mode), func(t *testing.T) {
+				tree, err := NewTree(dir)
+				assertNoError(t, err)
+				report := &Report{}
+				var buf strings.Builder
+				result, err := tree.Marshal(&Options{PackRoot: dir, Mode: mode, MergeStrategy: strategy, Report: report, Logger: logger.New(&buf, false)})
+				assertNoError(t, err)
+
+				out, err := yaml.Marshal(result)
+				assertNoError(t, err)
+				if want := "sub:\n    foo:\n        x: 1\n"; string(out) != want {
+					t.Errorf("Marshal() = %q, want %q", out, want)
+				}
+				want := []Override{{
+					Path: []string{"sub", "foo"},
+					Lost: Source{File: "sub/@a.yml", Line: 1, Column: 1},
+					Won:  Source{File: "sub/foo.yml"},
+				}}
+				if !reflect.DeepEqual(report.Overrides, want) {
+					t.Errorf("Overrides = %+v, want %+v", report.Overrides, want)
+				}
+				if want := "[WARN] key sub.foo from sub/@a.yml:1:1 overridden by sub/foo.yml\n"; buf.String() != want {
+					t.Errorf("log = %q, want %q", buf.String(), want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jksmth/fyaml/internal/include"
+	"go.yaml.in/yaml/v4"
+)
+
+// sourcemap.go contains provenance tracking: which file and position each key
+// of the marshaled output came from.
+
+// Source is a location in the pack that contributed a value.
+type Source struct {
+	File   string // Slash-separated path relative to the pack root
+	Line   int    // 1-based line of the key, or 0 for keys named by files and directories
+	Column int    // 1-based column of the key, or 0 for keys named by files and directories
+}
+
+// String returns the source as "file", or "file:line:column" when the position is known.
+func (s Source) String() string {
+	if s.Line == 0 {
+		return s.File
+	}
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column)
+}
+
+// SourceMapEntry lists the sources of one key path, in merge order.
+// The last source is the one whose value appears in the output; earlier
+// sources were overridden or, for merged maps, contributed keys.
+type SourceMapEntry struct {
+	Path    []string
+	Sources []Source
+}
+
+// SourceMap records where each key path of the marshaled output came from.
+// Keys inside sequences are not tracked. Keys brought in by !include are
+// attributed to the including file, at their position in the included file.
+type SourceMap struct {
+	Entries []SourceMapEntry // Sorted by path
+}
+
+// origin records where a marshaled value came from. It mirrors the map
+// structure of the value, so merges can carry it along with the value.
+type origin struct {
+	sources  []Source
+	children map[interface{}]*origin // keyed like the value's map keys
+	items    []*origin               // for sequences, the origin of each item
+}
+
+// get returns the origin of a child key, or nil. It is nil-safe.
+func (o *origin) get(key interface{}) *origin {
+	if o == nil {
+		return nil
+	}
+	return o.children[key]
+}
+
+// child returns the origin of a child key, creating it if needed.
+// It is nil-safe, returning nil when o is nil.
+func (o *origin) child(key interface{}) *origin {
+	if o == nil {
+		return nil
+	}
+	if o.children == nil {
+		o.children = make(map[interface{}]*origin)
+	}
+	c, ok := o.children[key]
+	if !ok {
+		c = &origin{}
+		o.children[key] = c
+	}
+	return c
+}
+
+// item returns the origin of the i-th item of a sequence, or nil. It is nil-safe.
+func (o *origin) item(i int) *origin {
+	if o == nil || i >= len(o.items) {
+		return nil
+	}
+	return o.items[i]
+}
+
+// appendItem records an item appended to a sequence. It is nil-safe.
+func (o *origin) appendItem(item *origin) {
+	if o != nil {
+		o.items = append(o.items, item)
+	}
+}
+
+// replace records that the value at key was replaced by a value from src.
+// The override chain of the old value is kept, but its children are dropped
+// along with the value.
+func (o *origin) replace(key interface{}, src *origin) {
+	if o == nil {
+		return
+	}
+	c := &origin{}
+	if old := o.get(key); old != nil {
+		c.sources = append(c.sources, old.sources...)
+	}
+	if src != nil {
+		c.sources = append(c.sources, src.sources...)
+		c.children = src.children
+		c.items = src.items
+	}
+	o.child(key)
+	o.children[key] = c
+}
+
+// addSources appends the sources of src to the origin of key, for values
+// that are merged rather than replaced.
+func (o *origin) addSources(key interface{}, src *origin) *origin {
+	c := o.child(key)
+	if c != nil && src != nil {
+		c.sources = append(c.sources, src.sources...)
+	}
+	return c
+}
+
+// itemOrigin returns o as the origin of a sequence item read from file.
+// It is nil-safe.
+func itemOrigin(o *origin, file string) *origin {
+	if o == nil {
+		o = &origin{}
+	}
+	o.sources = []Source{{File: file}}
+	return o
+}
+
+// wrapOrigin returns the origin of a map holding a value with origin o under
+// key, where the key is named by the file or directory itself.
+func wrapOrigin(key interface{}, o *origin, file string) *origin {
+	c := &origin{sources: []Source{{File: file}}}
+	if o != nil {
+		c.children = o.children
+		c.items = o.items
+	}
+	return &origin{children: map[interface{}]*origin{key: c}}
+}
+
+// nodeOrigin builds the origin of a parsed value from file. Keys are decoded
+// like canonical mode decodes them, or taken as their string value in preserve
+// mode, matching how each mode merges maps. Only canonical mode resolves
+// aliases and merge keys. Nodes in included are located in the file they were
+// included from instead.
+func nodeOrigin(file string, n *yaml.Node, mode Mode, included include.Origins) *origin {
+	return buildNodeOrigin(includedFile(included, n, file), n, mode, included, make(map[*yaml.Node]bool))
+}
+
+// includedFile returns the file the position of n refers to: the file n was
+// included from, or file, the file of its parent.
+func includedFile(included include.Origins, n *yaml.Node, file string) string {
+	if f, ok := included[n]; ok {
+		return f
+	}
+	return file
+}
+
+func buildNodeOrigin(file string, n *yaml.Node, mode Mode, included include.Origins, active map[*yaml.Node]bool) *origin {
+	o := &origin{}
+	// Preserve mode writes aliases as they are, so only canonical mode has keys behind them
+	for mode != ModePreserve && n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	// Recursive anchors cannot be followed
+	if n == nil || (n.Kind != yaml.MappingNode && n.Kind != yaml.SequenceNode) || active[n] {
+		return o
+	}
+	active[n] = true
+	defer delete(active, n)
+
+	// Sequence items are tracked for keyed list merging, but not in the source map
+	if n.Kind == yaml.SequenceNode {
+		for _, item := range n.Content {
+			itemFile := includedFile(included, item, file)
+			c := buildNodeOrigin(itemFile, item, mode, included, active)
+			c.sources = []Source{{File: itemFile, Line: item.Line, Column: item.Column}}
+			o.items = append(o.items, c)
+		}
+		return o
+	}
+
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			continue
+		}
+		// Canonical mode decodes merge keys into the map itself
+		if mode != ModePreserve && k.ShortTag() == "!!merge" {
+			merges = append(merges, v)
+			continue
+		}
+
+		key := interface{}(k.Value)
+		if mode != ModePreserve {
+			if err := k.Decode(&key); err != nil {
+				continue
+			}
+		}
+
+		c := buildNodeOrigin(includedFile(included, v, file), v, mode, included, active)
+		c.sources = []Source{{File: includedFile(included, k, file), Line: k.Line, Column: k.Column}}
+		o.child(key)
+		o.children[key] = c
+	}
+
+	// Explicit keys take precedence over merged ones, and earlier merges over later ones
+	for _, m := range merges {
+		for m.Kind == yaml.AliasNode && m.Alias != nil {
+			m = m.Alias
+		}
+		targets := []*yaml.Node{m}
+		if m.Kind == yaml.SequenceNode {
+			targets = m.Content
+		}
+		for _, t := range targets {
+			for key, c := range buildNodeOrigin(includedFile(included, t, file), t, mode, included, active).children {
+				if o.get(key) == nil {
+					o.child(key)
+					o.children[key] = c
+				}
+			}
+		}
+	}
+
+	return o
+}
+
+// record replaces the entries of m with the key paths of o.
+func (m *SourceMap) record(o *origin) {
+	m.Entries = nil
+	m.collect(nil, o)
+}
+
+func (m *SourceMap) collect(prefix []string, o *origin) {
+	if o == nil {
+		return
+	}
+
+	type child struct {
+		name string
+		o    *origin
+	}
+	children := make([]child, 0, len(o.children))
+	for key, c := range o.children {
+		// Key paths use the same string form as JSON output (see NormalizeKeys)
+		children = append(children, child{name: fmt.Sprintf("%v", key), o: c})
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+
+	for _, c := range children {
+		path := append(append([]string{}, prefix...), c.name)
+		m.Entries = append(m.Entries, SourceMapEntry{Path: path, Sources: c.o.sources})
+		m.collect(path, c.o)
+	}
+}
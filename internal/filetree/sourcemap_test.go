@@ -0,0 +1,162 @@
+package filetree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sourcemap_test.go contains tests for provenance tracking (sourcemap.go).
+
+// marshalSourceMap packs dir and returns its source map as "path: sources" lines.
+func marshalSourceMap(t *testing.T, dir string, opts *Options) []string {
+	t.Helper()
+	tree, err := NewTree(dir)
+	assertNoError(t, err)
+	opts.PackRoot = dir
+	opts.SourceMap = &SourceMap{}
+	_, err = tree.Marshal(opts)
+	assertNoError(t, err)
+
+	var lines []string
+	for _, e := range opts.SourceMap.Entries {
+		var sources []string
+		for _, s := range e.Sources {
+			sources = append(sources, fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column))
+		}
+		lines = append(lines, strings.Join(e.Path, ".")+": "+strings.Join(sources, " "))
+	}
+	return lines
+}
+
+func assertSourceMap(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("source map differs\nGot:\n%s\nWant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"@root.yml":       "version: 2\n",
+		"jobs/build.yml":  "image: x\nsteps:\n  - run: make\n",
+		"jobs/@extra.yml": "test:\n  image: y\n",
+	}, nil)
+
+	want := []string{
+		"jobs: jobs:0:0",
+		"jobs.build: jobs/build.yml:0:0",
+		"jobs.build.image: jobs/build.yml:1:1",
+		"jobs.build.steps: jobs/build.yml:2:1",
+		"jobs.test: jobs/@extra.yml:1:1",
+		"jobs.test.image: jobs/@extra.yml:2:3",
+		"version: @root.yml:1:1",
+	}
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			assertSourceMap(t, marshalSourceMap(t, dir, &Options{Mode: mode}), want)
+		})
+	}
+}
+
+func TestSourceMap_OverrideChain(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"jobs/@a.yml": "build:\n  image: x\n  shell: bash\n",
+		"jobs/@b.yml": "build:\n  image: y\n",
+	}, nil)
+
+	tests := []struct {
+		strategy MergeStrategy
+		want     []string
+	}{
+		{MergeShallow, []string{
+			"jobs: jobs:0:0",
+			"jobs.build: jobs/@a.yml:1:1 jobs/@b.yml:1:1",
+			"jobs.build.image: jobs/@b.yml:2:3",
+		}},
+		{MergeDeep, []string{
+			"jobs: jobs:0:0",
+			"jobs.build: jobs/@a.yml:1:1 jobs/@b.yml:1:1",
+			"jobs.build.image: jobs/@a.yml:2:3 jobs/@b.yml:2:3",
+			"jobs.build.shell: jobs/@a.yml:3:3",
+		}},
+	}
+	for _, tt := range tests {
+		for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+			t.Run(string(tt.strategy)+"/"+string(mode), func(t *testing.T) {
+				got := marshalSourceMap(t, dir, &Options{Mode: mode, MergeStrategy: tt.strategy})
+				assertSourceMap(t, got, tt.want)
+			})
+		}
+	}
+}
+
+func TestSourceMap_MergeKeys(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"@config.yml": "base: &base\n  timeout: 30\nservice:\n  <<: *base\n  name: api\n",
+	}, nil)
+
+	t.Run("canonical", func(t *testing.T) {
+		// Merged keys point at the anchor they were copied from
+		assertSourceMap(t, marshalSourceMap(t, dir, &Options{}), []string{
+			"base: @config.yml:1:1",
+			"base.timeout: @config.yml:2:3",
+			"service: @config.yml:3:1",
+			"service.name: @config.yml:5:3",
+			"service.timeout: @config.yml:2:3",
+		})
+	})
+
+	t.Run("preserve", func(t *testing.T) {
+		// The merge key and alias are kept as written
+		assertSourceMap(t, marshalSourceMap(t, dir, &Options{Mode: ModePreserve}), []string{
+			"base: @config.yml:1:1",
+			"base.timeout: @config.yml:2:3",
+			"service: @config.yml:3:1",
+			"service.<<: @config.yml:4:3",
+			"service.name: @config.yml:5:3",
+		})
+	})
+}
+
+func TestSourceMap_NonStringKeys(t *testing.T) {
+	dir := createTestDir(t, map[string]string{
+		"@a.yml": "codes:\n  404: missing\n",
+		"@b.yml": "codes:\n  404: not found\n",
+	}, nil)
+
+	got := marshalSourceMap(t, dir, &Options{MergeStrategy: MergeDeep})
+	assertSourceMap(t, got, []string{
+		"codes: @a.yml:1:1 @b.yml:1:1",
+		"codes.404: @a.yml:2:3 @b.yml:2:3",
+	})
+}
+
+func TestSourceMap_Includes(t *testing.T) {
+	// Fragments are .inc files, so they are only read through includes
+	dir := createTestDir(t, map[string]string{
+		"@a.yml":           "a:\n  x: !include shared/inc.inc\n  items:\n    - !include shared/item.inc\n  text: <<include(shared/note.txt)>>\n",
+		"shared/inc.inc":   "\n\ndeep:\n  leaf: !include shared/outer.inc\n",
+		"shared/outer.inc": "!include nested.inc\n",
+		"shared/item.inc":  "name: first\n",
+		"nested.inc":       "\nvalue: 1\n",
+		"shared/note.txt":  "hello\n",
+	}, nil)
+
+	// Included keys point at the file they were read from
+	want := []string{
+		"a: @a.yml:1:1",
+		"a.items: @a.yml:3:3",
+		"a.text: @a.yml:5:3",
+		"a.x: @a.yml:2:3",
+		"a.x.deep: shared/inc.inc:3:1",
+		"a.x.deep.leaf: shared/inc.inc:4:3",
+		"a.x.deep.leaf.value: nested.inc:2:1",
+	}
+	for _, mode := range []Mode{ModeCanonical, ModePreserve} {
+		t.Run(string(mode), func(t *testing.T) {
+			got := marshalSourceMap(t, dir, &Options{Mode: mode, EnableIncludes: true})
+			assertSourceMap(t, got, want)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jksmth/fyaml/internal/logger"
+)
+
+// symlink.go contains symbolic link following for the walker.
+
+// SymlinkPolicy controls how followed symbolic links that point outside the
+// pack root are handled.
+type SymlinkPolicy string
+
+const (
+	// SymlinkError fails the walk (default).
+	SymlinkError SymlinkPolicy = "error"
+	// SymlinkSkip leaves the link out of the tree.
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkAllow follows the link like any other.
+	SymlinkAllow SymlinkPolicy = "allow"
+)
+
+// maxSymlinkHops bounds the links followed to resolve one path.
+const maxSymlinkHops = 255
+
+// symlinks follows the symbolic links met while walking a tree.
+type symlinks struct {
+	fsys     fs.FS
+	realRoot string // Native path of the root of fsys with links resolved, or "" if it has none
+	outside  SymlinkPolicy
+	fullPath func(string) string
+	log      logger.Logger
+	nodes    *PathNodes // records the warnings
+}
+
+// follow returns the info of the target of the link at p, or a nil info and
+// the reason the link is left out. Links to a directory that contains them
+// are left out as cycles, with a warning.
+//
+// Directories are compared by their paths with links resolved rather than by
+// device and inode: an fs.FS other than os.DirFS, such as fstest.MapFS, has
+// no inodes, and os.SameFile never matches its file infos. Within the root,
+// a resolved path names one directory just as an inode does. Device and inode
+// are still compared where fsys cannot read links, or a link leads outside
+// the root under SymlinkAllow.
+func (l *symlinks) follow(p string) (fs.FileInfo, SkipReason, error) {
+	target, outside, err := l.resolve(p)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to follow symlink %s: %w", l.fullPath(p), err)
+	}
+	if outside {
+		switch l.outside {
+		case SymlinkSkip:
+			l.log.Debugf("Skipping symlink outside the pack root: %s", l.fullPath(p))
+			return nil, SkipSymlinkOutside, nil
+		case SymlinkAllow:
+			l.log.Debugf("Following symlink outside the pack root: %s", l.fullPath(p))
+		default:
+			return nil, "", fmt.Errorf("symlink %s points outside the pack root", l.fullPath(p))
+		}
+	}
+
+	info, err := fs.Stat(l.fsys, p)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to follow symlink %s: %w", l.fullPath(p), err)
+	}
+
+	if info.IsDir() {
+		for dir := path.Dir(p); ; dir = path.Dir(dir) {
+			same, err := l.sameDir(dir, target, info)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to follow symlink %s: %w", l.fullPath(p), err)
+			}
+			if same {
+				l.nodes.warn(l.log, WarnSymlinkCycle, p, "Not following symlink %s: it points to %s, which contains it", l.fullPath(p), l.fullPath(dir))
+				return nil, SkipSymlinkCycle, nil
+			}
+			if dir == "." {
+				break
+			}
+		}
+	}
+
+	if !outside {
+		l.log.Debugf("Following symlink: %s", l.fullPath(p))
+	}
+	return info, "", nil
+}
+
+// sameDir reports whether dir is the directory of a followed link, given by
+// its resolved path target, or by its info where target is "".
+func (l *symlinks) sameDir(dir, target string, info fs.FileInfo) (bool, error) {
+	if target == "" {
+		ancestor, err := fs.Stat(l.fsys, dir)
+		return err == nil && os.SameFile(ancestor, info), nil
+	}
+	resolved, _, err := l.resolve(dir)
+	return resolved == target, err
+}
+
+// resolve returns p with its links resolved, as a slash-separated path
+// within fsys, and reports whether resolving them leads outside the root of
+// fsys. The path is "" when p leads outside or fsys cannot read links;
+// filesystems that cannot read links are assumed to stay inside.
+func (l *symlinks) resolve(p string) (string, bool, error) {
+	rfs, ok := l.fsys.(fs.ReadLinkFS)
+	if !ok {
+		return "", false, nil
+	}
+
+	var resolved []string
+	todo := strings.Split(p, "/")
+	for hops := 0; len(todo) > 0; {
+		elem := todo[0]
+		todo = todo[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", true, nil
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		cur := path.Join(append(resolved, elem)...)
+		info, err := rfs.Lstat(cur)
+		if err != nil {
+			return "", false, err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = append(resolved, elem)
+			continue
+		}
+
+		if hops++; hops > maxSymlinkHops {
+			return "", false, fmt.Errorf("too many links")
+		}
+		target, err := rfs.ReadLink(cur)
+		if err != nil {
+			return "", false, err
+		}
+		if filepath.IsAbs(target) {
+			// An absolute target is inside only if it resolves below the root
+			rel, ok := l.relToRoot(target)
+			if !ok {
+				return "", true, nil
+			}
+			resolved, target = nil, rel
+		}
+		todo = append(strings.Split(filepath.ToSlash(target), "/"), todo...)
+	}
+	if len(resolved) == 0 {
+		return ".", false, nil
+	}
+	return path.Join(resolved...), false, nil
+}
+
+// relToRoot returns the absolute native path target, with links resolved,
+// as a slash-separated path relative to the root, or false if it is outside.
+func (l *symlinks) relToRoot(target string) (string, bool) {
+	if l.realRoot == "" {
+		return "", false
+	}
+	real, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(l.realRoot, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
@@ -0,0 +1,269 @@
+package filetree
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jksmth/fyaml/internal/logger"
+)
+
+// symlink creates a symbolic link at link, relative to dir, pointing to target.
+func symlink(t *testing.T, dir, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+}
+
+// symlinkPack creates a pack directory next to a directory outside it, and
+// returns the pack directory and the outside directory.
+func symlinkPack(t *testing.T) (pack, outside string) {
+	t.Helper()
+	tmpDir := createTestDir(t, map[string]string{
+		"pack/shared/common.yml": "region: eu",
+		"pack/app/service.yml":   "name: api",
+		"outside/extra.yml":      "tier: gold",
+	}, nil)
+	return filepath.Join(tmpDir, "pack"), filepath.Join(tmpDir, "outside")
+}
+
+func TestNewTree_SymlinkedDirectoryNotFollowedByDefault(t *testing.T) {
+	pack, _ := symlinkPack(t)
+	symlink(t, pack, filepath.Join("..", "shared"), filepath.Join("app", "shared"))
+
+	tree, err := NewTree(pack)
+	assertNoError(t, err)
+	result, err := tree.MarshalYAML()
+	assertNoError(t, err)
+	app := asMapShared(t, asMapShared(t, result)["app"])
+	if _, ok := app["shared"]; ok {
+		t.Errorf("app = %v, want no shared key", app)
+	}
+}
+
+func TestNewTree_FollowSymlinks(t *testing.T) {
+	pack, _ := symlinkPack(t)
+	symlink(t, pack, filepath.Join("..", "shared"), filepath.Join("app", "shared"))
+	symlink(t, pack, filepath.Join(pack, "shared", "common.yml"), filepath.Join("app", "common.yml"))
+
+	var buf bytes.Buffer
+	tree, err := NewTreeWithOptions(pack, TreeOptions{FollowSymlinks: true, Logger: logger.New(&buf, true)})
+	assertNoError(t, err)
+	result, err := tree.MarshalYAML()
+	assertNoError(t, err)
+
+	app := asMapShared(t, asMapShared(t, result)["app"])
+	want := map[interface{}]interface{}{
+		"common":  map[interface{}]interface{}{"region": "eu"},
+		"service": map[interface{}]interface{}{"name": "api"},
+		"shared":  map[interface{}]interface{}{"common": map[interface{}]interface{}{"region": "eu"}},
+	}
+	if !reflect.DeepEqual(app, want) {
+		t.Errorf("app = %v, want %v", app, want)
+	}
+	if !strings.Contains(buf.String(), "Following symlink: "+filepath.Join(pack, "app", "shared")) {
+		t.Errorf("log = %q, want the followed link", buf.String())
+	}
+}
+
+func TestNewTree_FollowSymlinksCycle(t *testing.T) {
+	pack, _ := symlinkPack(t)
+	symlink(t, pack, "..", filepath.Join("app", "loop"))
+
+	var buf bytes.Buffer
+	tree, err := NewTreeWithOptions(pack, TreeOptions{FollowSymlinks: true, Logger: logger.New(&buf, false)})
+	assertNoError(t, err)
+
+	want := []Skipped{{Path: "app/loop", Reason: SkipSymlinkCycle}}
+	if !reflect.DeepEqual(tree.Skipped, want) {
+		t.Errorf("Skipped = %v, want %v", tree.Skipped, want)
+	}
+	if !strings.Contains(buf.String(), "Not following symlink") {
+		t.Errorf("log = %q, want a cycle warning", buf.String())
+	}
+}
+
+func TestNewTree_FollowSymlinksOutsideRoot(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      SymlinkPolicy
+		wantErr     string
+		wantSkipped []Skipped
+		wantExtra   bool
+	}{
+		{name: "default", wantErr: "points outside the pack root"},
+		{name: "error", policy: SymlinkError, wantErr: "points outside the pack root"},
+		{name: "skip", policy: SymlinkSkip, wantSkipped: []Skipped{
+			{Path: "abs", Reason: SkipSymlinkOutside},
+			{Path: "rel", Reason: SkipSymlinkOutside},
+		}},
+		{name: "allow", policy: SymlinkAllow, wantExtra: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pack, outside := symlinkPack(t)
+			symlink(t, pack, filepath.Join("..", "outside"), "rel")
+			symlink(t, pack, outside, "abs")
+
+			tree, err := NewTreeWithOptions(pack, TreeOptions{FollowSymlinks: true, OutsideSymlinks: tt.policy})
+			if tt.wantErr != "" {
+				assertErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assertNoError(t, err)
+			if !reflect.DeepEqual(tree.Skipped, tt.wantSkipped) {
+				t.Errorf("Skipped = %v, want %v", tree.Skipped, tt.wantSkipped)
+			}
+
+			result, err := tree.MarshalYAML()
+			assertNoError(t, err)
+			m := asMapShared(t, result)
+			if _, ok := m["rel"]; ok != tt.wantExtra {
+				t.Errorf("MarshalYAML() = %v, want rel key: %v", m, tt.wantExtra)
+			}
+			if _, ok := m["abs"]; ok != tt.wantExtra {
+				t.Errorf("MarshalYAML() = %v, want abs key: %v", m, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestNewTree_FollowSymlinksThroughFollowedDirectory(t *testing.T) {
+	// deep/link points to ../shared relative to where deep really is
+	pack, _ := symlinkPack(t)
+	if err := os.MkdirAll(filepath.Join(pack, "real", "deep"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, pack, filepath.Join("..", "..", "shared"), filepath.Join("real", "deep", "link"))
+	symlink(t, pack, filepath.Join("real", "deep"), "deep")
+
+	tree, err := NewTreeWithOptions(pack, TreeOptions{FollowSymlinks: true})
+	assertNoError(t, err)
+	if node := findNodeByName(t, tree, "common.yml"); node == nil {
+		t.Fatal("common.yml not found")
+	}
+	if got, want := childPaths(findNodeByName(t, tree, "deep")), "deep/link"; got != want {
+		t.Errorf("children = %s, want %s", got, want)
+	}
+}
+
+func TestNewTreeFS_FollowSymlinks(t *testing.T) {
+	link := func(target string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(target), Mode: fs.ModeSymlink}
+	}
+	tests := []struct {
+		name        string
+		files       fstest.MapFS
+		wantErr     string
+		wantSkipped []Skipped
+		wantKeys    string
+	}{
+		{
+			name: "directory",
+			files: fstest.MapFS{
+				"app/shared":      link("../shared"),
+				"shared/item.yml": {Data: []byte("k: 1\n")},
+			},
+			wantKeys: "app.shared.item,shared.item",
+		},
+		{
+			name: "cycle",
+			files: fstest.MapFS{
+				"app/item.yml": {Data: []byte("k: 1\n")},
+				"app/loop":     link(".."),
+			},
+			wantSkipped: []Skipped{{Path: "app/loop", Reason: SkipSymlinkCycle}},
+			wantKeys:    "app.item",
+		},
+		{
+			name: "cycle through two links",
+			files: fstest.MapFS{
+				"a/item.yml": {Data: []byte("k: 1\n")},
+				"a/to-b":     link("../b"),
+				"b/to-a":     link("../a"),
+			},
+			wantSkipped: []Skipped{
+				{Path: "a/to-b/to-a", Reason: SkipSymlinkCycle},
+				{Path: "b/to-a/to-b", Reason: SkipSymlinkCycle},
+			},
+			wantKeys: "a.item,b.to-a.item",
+		},
+		{
+			name: "outside",
+			files: fstest.MapFS{
+				"app/up": link("../../elsewhere"),
+			},
+			wantErr: "points outside the pack root",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tree, err := NewTreeFSWithOptions(tt.files, TreeOptions{FollowSymlinks: true, Logger: logger.New(&buf, false)})
+			if tt.wantErr != "" {
+				assertErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assertNoError(t, err)
+			if !reflect.DeepEqual(tree.Skipped, tt.wantSkipped) {
+				t.Errorf("Skipped = %v, want %v", tree.Skipped, tt.wantSkipped)
+			}
+			if len(tt.wantSkipped) > 0 && !strings.Contains(buf.String(), "Not following symlink") {
+				t.Errorf("log = %q, want a cycle warning", buf.String())
+			}
+			if len(tree.Warnings) != len(tt.wantSkipped) {
+				t.Fatalf("Warnings = %+v, want one per skipped link", tree.Warnings)
+			}
+			for i, w := range tree.Warnings {
+				if w.Kind != WarnSymlinkCycle || w.File != tt.wantSkipped[i].Path {
+					t.Errorf("Warnings[%d] = %+v, want a %s warning for %s", i, w, WarnSymlinkCycle, tt.wantSkipped[i].Path)
+				}
+			}
+
+			result, err := tree.MarshalYAML()
+			assertNoError(t, err)
+			if got := strings.Join(leafPaths("", result), ","); got != tt.wantKeys {
+				t.Errorf("MarshalYAML() keys = %s, want %s", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+// leafPaths returns the dotted paths of the maps in v that hold no further
+// maps, sorted.
+func leafPaths(prefix string, v interface{}) []string {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok || len(m) == 0 || prefix != "" && !hasMapValue(m) {
+		return []string{prefix}
+	}
+	var paths []string
+	for k, child := range m {
+		name := fmt.Sprint(k)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		paths = append(paths, leafPaths(name, child)...)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// hasMapValue reports whether any value of m is a map.
+func hasMapValue(m map[interface{}]interface{}) bool {
+	for _, v := range m {
+		if _, ok := v.(map[interface{}]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,434 @@
+// Package filetree provides filesystem traversal for FYAML packing.
+package filetree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jksmth/fyaml/internal/logger"
+	"go.yaml.in/yaml/v4"
+)
+
+// unpack.go contains the inverse of marshaling: splitting a single document
+// into a directory tree that packs back to the same output.
+
+// UnpackOptions controls how a document is split into a directory tree.
+type UnpackOptions struct {
+	Mode       Mode     // Output behavior: canonical (default) or preserve
+	Depth      int      // Number of key levels split into separate entries (minimum 1)
+	SplitPaths []string // Dot-separated key paths always split into directories
+	Indent     int      // Indentation for written files
+
+	// Logging
+	Logger logger.Logger // Logger for verbose output (nil-safe: defaults to Nop())
+}
+
+// log returns the logger, defaulting to Nop() if nil.
+func (o *UnpackOptions) log() logger.Logger {
+	if o == nil || o.Logger == nil {
+		return logger.Nop()
+	}
+	return o.Logger
+}
+
+// rootValuesFile holds the top-level keys that cannot be written as their own
+// file or directory. Root files merge into the root, like @ files do elsewhere.
+const rootValuesFile = "@root.yml"
+
+// unpackEntry is a file or directory written for one or more keys of a mapping.
+type unpackEntry struct {
+	name    string       // file or directory name
+	pairs   []*yaml.Node // key/value node pairs covered by this entry, in order
+	content *yaml.Node   // mapping written to the file (files only)
+	entries []unpackEntry
+	dir     bool
+	values  bool // file of keys kept inline
+}
+
+// Unpack writes root as an FYAML directory tree under dir, following the rules
+// marshalParent applies in reverse: map values become directories or files
+// named after their key, and values that cannot be named become part of an @
+// file that merges into the parent. Packing dir with the same mode yields the
+// same document.
+//
+// In preserve mode, keys keep their authored order through order files, so
+// dir must be packed with OrderPrefixes when Unpack writes one; it logs a
+// warning then. Splits that would lose comments, anchors or other authored
+// details are left out of the plan, with a warning.
+//
+// root may be a document node or a mapping node. An empty document only
+// creates dir. dir must not exist or be empty.
+func Unpack(root *yaml.Node, dir string, opts *UnpackOptions) error {
+	if opts == nil {
+		opts = &UnpackOptions{}
+	}
+
+	var docHead string
+	if root != nil && root.Kind == yaml.DocumentNode {
+		docHead = root.HeadComment
+		if len(root.Content) == 0 {
+			root = nil
+		} else {
+			root = root.Content[0]
+		}
+	}
+	if root != nil && root.Kind == yaml.ScalarNode && root.ShortTag() == "!!null" {
+		root = nil
+	}
+	if root != nil && root.Kind != yaml.MappingNode {
+		return fmt.Errorf("expected a map at document root, got a `%v` which is not supported at this time", root.Kind)
+	}
+
+	if err := prepareUnpackDir(dir); err != nil {
+		return err
+	}
+	if root == nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	if opts.Mode != ModePreserve {
+		// Canonical output is sorted and has no comments or aliases, so lay
+		// out the decoded document instead of the authored one.
+		var content interface{}
+		if err := root.Decode(&content); err != nil {
+			return fmt.Errorf("failed to decode document: %w", err)
+		}
+		var canonical yaml.Node
+		if err := canonical.Encode(content); err != nil {
+			return fmt.Errorf("failed to encode document: %w", err)
+		}
+		root = &canonical
+	}
+
+	u := &unpacker{opts: opts}
+	entries, ok := u.plan(root, nil, rootValuesFile)
+	if !ok {
+		entries = []unpackEntry{{name: rootValuesFile, pairs: root.Content, content: root, values: true}}
+	}
+	for _, w := range u.warnings {
+		opts.log().Warnf("%s", w)
+	}
+	if opts.Mode == ModePreserve && docHead != "" {
+		// Comments of the document itself are lost when packing, so keep them on its first key
+		entries = pushHeadComment(entries, docHead)
+	}
+
+	if err := u.write(dir, entries); err != nil {
+		return err
+	}
+	if u.ordered {
+		u.opts.log().Warnf("Key order is kept in %s files; pack %s with order prefixes enabled (--order-prefixes) to apply them", OrderFile, dir)
+	}
+	return nil
+}
+
+// prepareUnpackDir creates dir, or verifies that it is empty if it exists.
+func prepareUnpackDir(dir string) error {
+	existing, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// #nosec G301 - 0755 is standard for config directories, umask applies
+			return os.MkdirAll(dir, 0o755)
+		}
+		return fmt.Errorf("failed to read output directory: %w", err)
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("output directory %s is not empty", dir)
+	}
+	return nil
+}
+
+type unpacker struct {
+	opts     *UnpackOptions
+	warnings []string // splits left out of the plan, logged once it is final
+	ordered  bool     // an order file was written
+}
+
+// plan lays out the keys of mapping m as the entries of a directory. Keys
+// that cannot be written as their own entry are collected in valuesFile.
+// It reports false if m cannot be split without changing the packed output.
+//
+// In preserve mode, entries keep the authored order of their keys, and keys
+// kept inline are collected in one values file per run of consecutive keys.
+// A key whose nodes carry comments, a tag, an anchor or a style is written
+// with its map to an @ file of its own, which keeps them as authored.
+func (u *unpacker) plan(m *yaml.Node, keyPath []string, valuesFile string) ([]unpackEntry, bool) {
+	preserve := u.opts.Mode == ModePreserve
+	var entries []unpackEntry
+	values := -1 // index of the values file taking inline keys
+	names := make(map[string]bool)
+	files := make(map[string]bool) // lowercased @ file names
+	warned := len(u.warnings)
+
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		childPath := append(append([]string{}, keyPath...), k.Value)
+
+		name, ok := u.entryName(k, v)
+		blocker, keyed := "", len(keyPath) == 0
+		if ok && preserve {
+			blocker = preserveBlocker(k, v)
+			if !keyed && (blocker != "" || hasComments(k) || hasComments(v)) {
+				keyed = true
+				ok = !files[strings.ToLower("@"+name+".yml")]
+			}
+		}
+		// Case-insensitive filesystems cannot hold names differing only by case
+		if !ok || names[strings.ToLower(name)] {
+			if values < 0 || (preserve && values != len(entries)-1) {
+				values = len(entries)
+				entries = append(entries, unpackEntry{name: nextValuesFile(valuesFile, files), content: newMapping(), values: true})
+			}
+			mappingSet(entries[values].content, k, v)
+			entries[values].pairs = entries[values].content.Content
+			continue
+		}
+		names[strings.ToLower(name)] = true
+
+		entry := unpackEntry{name: name + ".yml", pairs: m.Content[i : i+2], content: v}
+		if keyed {
+			// The file merges into its parent, so it carries its own key
+			entry.content = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: entry.pairs}
+			if len(keyPath) > 0 {
+				entry.name = "@" + entry.name
+				files[strings.ToLower(entry.name)] = true
+			}
+		}
+
+		// Directory names lose anything after a dot (see Node.name)
+		if u.splitDir(childPath) && !strings.Contains(name, ".") {
+			if blocker == "" && preserve && (hasComments(k) || hasComments(v)) {
+				blocker = "comments"
+			}
+			if blocker != "" {
+				u.warnings = append(u.warnings, fmt.Sprintf("Writing %s to a single file: a directory cannot keep its %s", strings.Join(childPath, "."), blocker))
+			} else if children, ok := u.plan(v, childPath, "@"+name+".yml"); ok && hasNamedEntry(children) {
+				entry = unpackEntry{name: name, pairs: m.Content[i : i+2], entries: children, dir: true}
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if !preserve {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].name < entries[j].name
+		})
+		return entries, true
+	}
+
+	// Packing reads each file on its own, so an alias needs its anchor in the same file
+	for _, e := range entries {
+		if !selfContained(e.pairs) {
+			// m is written whole, so the splits left out within it no longer matter
+			u.warnings = u.warnings[:warned]
+			if len(keyPath) > 0 {
+				u.warnings = append(u.warnings, fmt.Sprintf("Writing %s to a single file: its keys share anchors and aliases", strings.Join(keyPath, ".")))
+			} else {
+				u.warnings = append(u.warnings, fmt.Sprintf("Writing the document to %s: its keys share anchors and aliases", rootValuesFile))
+			}
+			return nil, false
+		}
+	}
+	return entries, true
+}
+
+// nextValuesFile returns the name of the next values file: valuesFile
+// itself, or a numbered name such as @root-2.yml if that is taken in files.
+// The name is added to files.
+func nextValuesFile(valuesFile string, files map[string]bool) string {
+	name := valuesFile
+	ext := filepath.Ext(valuesFile)
+	for n := 2; files[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(valuesFile, ext), n, ext)
+	}
+	files[strings.ToLower(name)] = true
+	return name
+}
+
+// entryName returns the file name for a key whose value can be written as its
+// own file or directory. Only non-empty maps under plain string keys qualify;
+// characters that cannot be written in a file name are escaped.
+func (u *unpacker) entryName(k, v *yaml.Node) (string, bool) {
+	if k.Kind != yaml.ScalarNode || k.ShortTag() != "!!str" || k.Value == "<<" {
+		return "", false
+	}
+	if v.Kind != yaml.MappingNode || len(v.Content) == 0 {
+		return "", false
+	}
+
+	if k.Value == "" {
+		return "", false
+	}
+
+	return escapeName(k.Value), true
+}
+
+// preserveBlocker returns what keeps a key and its map from being written as
+// a file or directory named by the key in preserve mode: packing rebuilds the
+// key from the name, so anything authored on the nodes besides comments would
+// be lost. It returns "" if nothing does.
+func preserveBlocker(k, v *yaml.Node) string {
+	switch {
+	case k.Style != 0:
+		return "quoted key"
+	case v.Style&yaml.FlowStyle != 0:
+		return "flow style"
+	case v.ShortTag() != "!!map":
+		return "tag"
+	case v.Anchor != "":
+		return "anchor"
+	}
+	return ""
+}
+
+// splitDir reports whether the map at keyPath should become a directory.
+func (u *unpacker) splitDir(keyPath []string) bool {
+	if len(keyPath) < u.opts.Depth {
+		return true
+	}
+	joined := strings.Join(keyPath, ".")
+	for _, p := range u.opts.SplitPaths {
+		if p == joined || strings.HasPrefix(p, joined+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNamedEntry reports whether entries contain anything besides a values file.
+func hasNamedEntry(entries []unpackEntry) bool {
+	for _, e := range entries {
+		if !e.values {
+			return true
+		}
+	}
+	return false
+}
+
+// withHeadComment returns mapping m with head added above its first key.
+// m itself is not modified.
+func withHeadComment(m *yaml.Node, head string) *yaml.Node {
+	c := *m
+	c.Content = append([]*yaml.Node(nil), m.Content...)
+	first := *c.Content[0]
+	if first.HeadComment != "" {
+		head += "\n" + first.HeadComment
+	}
+	first.HeadComment = head
+	c.Content[0] = &first
+	return &c
+}
+
+// pushHeadComment adds head above the first key written for entries.
+func pushHeadComment(entries []unpackEntry, head string) []unpackEntry {
+	entries = append([]unpackEntry(nil), entries...)
+	if entries[0].dir {
+		entries[0].entries = pushHeadComment(entries[0].entries, head)
+	} else {
+		entries[0].content = withHeadComment(entries[0].content, head)
+	}
+	return entries
+}
+
+// selfContained reports whether every alias within nodes refers to an anchor
+// that is also within nodes, so they can be written to a file of their own.
+func selfContained(nodes []*yaml.Node) bool {
+	inside := make(map[*yaml.Node]bool)
+	var aliases []*yaml.Node
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n == nil || inside[n] {
+			return
+		}
+		inside[n] = true
+		if n.Kind == yaml.AliasNode {
+			aliases = append(aliases, n)
+			return
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	for _, a := range aliases {
+		if !inside[a.Alias] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasComments reports whether a node carries any comments of its own.
+func hasComments(n *yaml.Node) bool {
+	return n.HeadComment != "" || n.LineComment != "" || n.FootComment != ""
+}
+
+// write creates the planned entries under dir. Entries out of name order are
+// listed in an order file, so that packing reads them in the planned order.
+func (u *unpacker) write(dir string, entries []unpackEntry) error {
+	if !sort.SliceIsSorted(entries, func(i, j int) bool { return entries[i].name < entries[j].name }) {
+		var order strings.Builder
+		for _, e := range entries {
+			order.WriteString(e.name + "\n")
+		}
+		p := filepath.Join(dir, OrderFile)
+		u.opts.log().Debugf("Writing: %s", p)
+		// #nosec G306 - 0644 is standard for config files, umask applies
+		if err := os.WriteFile(p, []byte(order.String()), 0o644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", p, err)
+		}
+		u.ordered = true
+	}
+
+	for _, e := range entries {
+		p := filepath.Join(dir, e.name)
+		if e.dir {
+			u.opts.log().Debugf("Creating: %s", p)
+			// #nosec G301 - 0755 is standard for config directories, umask applies
+			if err := os.Mkdir(p, 0o755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", p, err)
+			}
+			if err := u.write(p, e.entries); err != nil {
+				return err
+			}
+			continue
+		}
+
+		u.opts.log().Debugf("Writing: %s", p)
+		data, err := u.encode(e.content)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", p, err)
+		}
+		// #nosec G306 - 0644 is standard for config files, umask applies
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// encode serializes a mapping node as a YAML file.
+func (u *unpacker) encode(m *yaml.Node) ([]byte, error) {
+	indent := u.opts.Indent
+	if indent < 1 {
+		indent = 2
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	if err := enc.Encode(m); err != nil {
+		_ = enc.Close() // Close on error, ignore close error
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,320 @@
+package filetree
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jksmth/fyaml/internal/logger"
+	"go.yaml.in/yaml/v4"
+)
+
+// unpack_test.go contains tests for splitting documents into trees (unpack.go).
+
+// packDir packs dir in the given mode, applying the order files Unpack
+// writes, and encodes the result as YAML.
+func packDir(t *testing.T, dir string, mode Mode) string {
+	t.Helper()
+	tree, err := NewTreeWithOptions(dir, TreeOptions{OrderPrefixes: true})
+	assertNoError(t, err)
+	result, err := tree.Marshal(&Options{PackRoot: dir, Mode: mode})
+	assertNoError(t, err)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	assertNoError(t, enc.Encode(result))
+	assertNoError(t, enc.Close())
+	return buf.String()
+}
+
+// unpackString parses input and unpacks it into a new directory.
+func unpackString(t *testing.T, input string, opts *UnpackOptions) string {
+	t.Helper()
+	var doc yaml.Node
+	assertNoError(t, yaml.Unmarshal([]byte(input), &doc))
+	dir := filepath.Join(t.TempDir(), "out")
+	assertNoError(t, Unpack(&doc, dir, opts))
+	return dir
+}
+
+// listFiles returns the slash-separated paths of all files under dir.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	assertNoError(t, err)
+	return files
+}
+
+func TestUnpack_RoundTrip(t *testing.T) {
+	cases := []string{"simple", "nested", "ordering", "at-files", "at-root", "at-directories", "anchors", "json-input", "includes"}
+	modes := []Mode{ModeCanonical, ModePreserve}
+	layouts := []struct {
+		name       string
+		depth      int
+		splitPaths []string
+	}{
+		{"depth1", 1, nil},
+		{"depth2", 2, nil},
+		{"depth4", 4, nil},
+		{"split paths", 1, []string{"entities", "level1.level2"}},
+	}
+
+	for _, c := range cases {
+		for _, mode := range modes {
+			expected, err := os.ReadFile(filepath.Join("../../testdata", c, "expected-"+string(mode)+".yml"))
+			if err != nil {
+				continue
+			}
+			for _, l := range layouts {
+				t.Run(c+"/"+string(mode)+"/"+l.name, func(t *testing.T) {
+					dir := unpackString(t, string(expected), &UnpackOptions{
+						Mode:       mode,
+						Depth:      l.depth,
+						SplitPaths: l.splitPaths,
+					})
+					got := packDir(t, dir, mode)
+					if got != string(expected) {
+						t.Errorf("repacked output differs\nGot:\n%s\nWant:\n%s\nFiles: %v", got, expected, listFiles(t, dir))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestUnpack_Layout(t *testing.T) {
+	input := `version: 2
+jobs:
+  build:
+    steps: [checkout]
+  test:
+    steps: [checkout]
+workflows:
+  main:
+    jobs: [build, test]
+`
+
+	tests := []struct {
+		name       string
+		depth      int
+		splitPaths []string
+		want       []string
+	}{
+		{"depth1", 1, nil, []string{"@root.yml", "jobs.yml", "workflows.yml"}},
+		{"depth2", 2, nil, []string{"@root.yml", "jobs/build.yml", "jobs/test.yml", "workflows/main.yml"}},
+		{"split paths", 1, []string{"jobs"}, []string{"@root.yml", "jobs/build.yml", "jobs/test.yml", "workflows.yml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := unpackString(t, input, &UnpackOptions{Depth: tt.depth, SplitPaths: tt.splitPaths})
+			got := listFiles(t, dir)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnpack_KeysKeptInline(t *testing.T) {
+	input := `dotted.key:
+  a: 1
+empty: {}
+list: [1, 2]
+123:
+  a: 1
+Case:
+  a: 1
+case:
+  a: 1
+`
+	dir := unpackString(t, input, &UnpackOptions{Depth: 2})
+	got := listFiles(t, dir)
+	want := []string{"@root.yml", "Case.yml", "dotted.key.yml"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestUnpack_EscapedNames(t *testing.T) {
+	input := `.hidden:
+  a: 1
+'@at':
+  a: 1
+010-setup:
+  a: 1
+100%:
+  a: 1
+paths:
+  /users:
+    get:
+      summary: List users
+  /users/{id}:
+    get:
+      summary: Get a user
+steps[]:
+  a: 1
+`
+	dir := unpackString(t, input, &UnpackOptions{Depth: 2})
+	got := listFiles(t, dir)
+	want := []string{"%2Ehidden.yml", "%3010-setup.yml", "%40at.yml", "100%25.yml", "paths/%2Fusers%2F{id}.yml", "paths/%2Fusers.yml", "steps[%5D.yml"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if got := packDir(t, dir, ModeCanonical); got != input {
+		t.Errorf("repacked output = %q, want %q", got, input)
+	}
+}
+
+func TestUnpack_Preserve_CrossFileAliases(t *testing.T) {
+	input := `base: &base
+  timeout: 30
+service:
+  <<: *base
+  name: api
+`
+	var log bytes.Buffer
+	dir := unpackString(t, input, &UnpackOptions{Mode: ModePreserve, Depth: 2, Logger: logger.New(&log, false)})
+	got := listFiles(t, dir)
+	if strings.Join(got, ",") != rootValuesFile {
+		t.Errorf("files = %v, want everything in %s", got, rootValuesFile)
+	}
+	if want := "[WARN] Writing the document to @root.yml: its keys share anchors and aliases\n"; log.String() != want {
+		t.Errorf("log = %q, want %q", log.String(), want)
+	}
+	// The encoder always tags merge keys explicitly, as Pack does
+	want := strings.Replace(input, "<<:", "!!merge <<:", 1)
+	if packed := packDir(t, dir, ModePreserve); packed != want {
+		t.Errorf("repacked output differs\nGot:\n%s\nWant:\n%s", packed, want)
+	}
+}
+
+func TestUnpack_Preserve_KeepsCommentsAndOrder(t *testing.T) {
+	input := `# Build jobs
+zebra:
+  # the first key
+  b: 1 # inline
+  a: 2
+alpha:
+  key: value
+`
+	dir := unpackString(t, input, &UnpackOptions{Mode: ModePreserve})
+	if packed := packDir(t, dir, ModePreserve); packed != input {
+		t.Errorf("repacked output differs\nGot:\n%s\nWant:\n%s\nFiles: %v", packed, input, listFiles(t, dir))
+	}
+}
+
+func TestUnpack_Preserve_Workflow(t *testing.T) {
+	input := `# CI workflow
+name: ci
+on:
+  push:
+    branches: [main]
+env:
+  GO: "1.25"
+jobs:
+  # Compile everything
+  build:
+    runs-on: ubuntu-latest # pinned
+  test:
+    needs: build
+    runs-on: ubuntu-latest
+  lint: &lint
+    runs-on: ubuntu-latest
+`
+	var log bytes.Buffer
+	dir := unpackString(t, input, &UnpackOptions{Mode: ModePreserve, Depth: 2, Logger: logger.New(&log, false)})
+
+	got := listFiles(t, dir)
+	want := []string{".order", "@root.yml", "env.yml", "jobs/.order", "jobs/@build.yml", "jobs/@lint.yml", "jobs/test.yml", "on/push.yml"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	order, err := os.ReadFile(filepath.Join(dir, OrderFile))
+	assertNoError(t, err)
+	if want := "@root.yml\non\nenv.yml\njobs\n"; string(order) != want {
+		t.Errorf(".order = %q, want %q", order, want)
+	}
+	// Commented keys are written with their key, so the comments stay in place
+	build, err := os.ReadFile(filepath.Join(dir, "jobs", "@build.yml"))
+	assertNoError(t, err)
+	if want := "# Compile everything\nbuild:\n  runs-on: ubuntu-latest # pinned\n"; string(build) != want {
+		t.Errorf("jobs/@build.yml = %q, want %q", build, want)
+	}
+
+	wantLog := "[WARN] Key order is kept in .order files; pack " + dir + " with order prefixes enabled (--order-prefixes) to apply them\n"
+	if log.String() != wantLog {
+		t.Errorf("log = %q, want %q", log.String(), wantLog)
+	}
+	if packed := packDir(t, dir, ModePreserve); packed != input {
+		t.Errorf("repacked output differs\nGot:\n%s\nWant:\n%s", packed, input)
+	}
+}
+
+func TestUnpack_Preserve_DirectoriesKeepComments(t *testing.T) {
+	input := `# Jobs
+jobs:
+  build:
+    runs-on: ubuntu-latest
+services:
+  db: &db
+    image: postgres
+`
+	var log bytes.Buffer
+	dir := unpackString(t, input, &UnpackOptions{Mode: ModePreserve, Depth: 3, Logger: logger.New(&log, false)})
+
+	got := listFiles(t, dir)
+	want := []string{"jobs.yml", "services/@db.yml"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	for _, line := range []string{
+		"[WARN] Writing jobs to a single file: a directory cannot keep its comments",
+		"[WARN] Writing services.db to a single file: a directory cannot keep its anchor",
+	} {
+		if !strings.Contains(log.String(), line+"\n") {
+			t.Errorf("log = %q, want it to contain %q", log.String(), line)
+		}
+	}
+	if packed := packDir(t, dir, ModePreserve); packed != input {
+		t.Errorf("repacked output differs\nGot:\n%s\nWant:\n%s", packed, input)
+	}
+}
+
+func TestUnpack_Errors(t *testing.T) {
+	t.Run("non-map root", func(t *testing.T) {
+		var doc yaml.Node
+		assertNoError(t, yaml.Unmarshal([]byte("- a\n- b"), &doc))
+		err := Unpack(&doc, filepath.Join(t.TempDir(), "out"), nil)
+		assertErrorContains(t, err, "expected a map at document root")
+	})
+
+	t.Run("non-empty directory", func(t *testing.T) {
+		dir := createTestDir(t, map[string]string{"existing.yml": "a: 1"}, nil)
+		var doc yaml.Node
+		assertNoError(t, yaml.Unmarshal([]byte("a: 1"), &doc))
+		err := Unpack(&doc, dir, nil)
+		assertErrorContains(t, err, "is not empty")
+	})
+
+	t.Run("empty document", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "out")
+		assertNoError(t, Unpack(&yaml.Node{Kind: yaml.DocumentNode}, dir, nil))
+		if files := listFiles(t, dir); len(files) != 0 {
+			t.Errorf("files = %v, want none", files)
+		}
+	})
+}
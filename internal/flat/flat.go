@@ -0,0 +1,353 @@
+// Package flat writes packed documents as flat key/value files: Java
+// .properties files, dotenv files and literal environment files.
+//
+// Every scalar of the document becomes one line, keyed by its key path.
+// Lines follow the order of the mapping nodes, so callers decide whether
+// keys are sorted or authored.
+package flat
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Error is content that cannot be written as a flat file.
+type Error struct {
+	Path []string // Key path of the value, with sequence indexes; empty for the root
+	Msg  string   // Description of the problem
+}
+
+func (e *Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s at %s", e.Msg, strings.Join(e.Path, "."))
+}
+
+var (
+	// plainValueRe matches the dotenv values written without quotes, and
+	// the only values EnvFile writes.
+	plainValueRe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+	// variableRe matches the dotenv keys shells accept as variable names.
+	variableRe = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+)
+
+// Properties writes the document rooted at n as a .properties file. Key
+// paths are joined with dots and sequence items are indexed in brackets, as
+// in servers[0].host=a. Keys and values are escaped as
+// java.util.Properties.store does, with characters outside ASCII written as
+// \uXXXX escapes. A nil or empty document writes nothing.
+//
+// Properties fails with an *Error for content a flat file cannot hold: null
+// values, empty maps and sequences, a root that is not a map, and two key
+// paths that are written as the same key.
+func Properties(n *yaml.Node) ([]byte, error) {
+	return write(n, func(path []part) (string, error) {
+		var b strings.Builder
+		for i, p := range path {
+			switch {
+			case p.index:
+				b.WriteString("[" + p.name + "]")
+			case i > 0:
+				b.WriteString("." + escapeProperty(p.name, true))
+			default:
+				b.WriteString(escapeProperty(p.name, true))
+			}
+		}
+		return b.String(), nil
+	}, func(value string) (string, error) {
+		return escapeProperty(value, false), nil
+	})
+}
+
+// Dotenv writes the document rooted at n as a dotenv file that a POSIX shell
+// reads back with set -a; . ./file. Key paths, with sequence indexes, are
+// joined with underscores and uppercased, and characters other than letters,
+// digits and underscores become underscores, as in SERVERS_0_HOST=a. Values
+// holding only safe characters are written bare; others are double-quoted
+// with the shell's rules: \, ", $ and ` are escaped by a backslash, and
+// newlines are kept inside the quotes. Readers that take values literally,
+// such as docker --env-file, or that apply their own escapes, such as most
+// dotenv libraries, only read bare values the same way. A nil or empty
+// document writes nothing.
+//
+// Besides the content Properties rejects, Dotenv fails with an *Error for a
+// key that does not start with a letter or underscore, and for values
+// holding control characters other than tab and newline.
+func Dotenv(n *yaml.Node) ([]byte, error) {
+	return write(n, dotenvKey, quoteDotenv)
+}
+
+// EnvFile writes the document rooted at n as an environment file for readers
+// that take values literally, such as docker --env-file. Keys are written as
+// Dotenv writes them and values are never quoted, so the file also reads the
+// same in a shell and with dotenv libraries.
+//
+// Besides the content Dotenv rejects, EnvFile fails with an *Error for values
+// that Dotenv would quote: values holding characters other than letters,
+// digits and _./:@%+,=-.
+func EnvFile(n *yaml.Node) ([]byte, error) {
+	return write(n, dotenvKey, func(value string) (string, error) {
+		if !plainValueRe.MatchString(value) {
+			return "", fmt.Errorf("value %q needs quotes, which literal readers keep as part of the value", value)
+		}
+		return value, nil
+	})
+}
+
+// dotenvKey joins path as a dotenv key: uppercased, joined with underscores,
+// and with other characters replaced by underscores.
+func dotenvKey(path []part) (string, error) {
+	names := make([]string, len(path))
+	for i, p := range path {
+		names[i] = strings.Map(func(r rune) rune {
+			if 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_' {
+				return r
+			}
+			return '_'
+		}, strings.ToUpper(p.name))
+	}
+	key := strings.Join(names, "_")
+	if !variableRe.MatchString(key) {
+		return "", fmt.Errorf("key %s is not a valid variable name", key)
+	}
+	return key, nil
+}
+
+// part is one step of a key path: a map key or a sequence index.
+type part struct {
+	name  string
+	index bool
+}
+
+// write flattens the document rooted at n and writes one key=value line per
+// scalar, with the key and value formatted by the given functions.
+func write(n *yaml.Node, formatKey func([]part) (string, error), formatValue func(string) (string, error)) ([]byte, error) {
+	n = resolve(n)
+	if n != nil && n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		n = resolve(n.Content[0])
+	}
+	if n == nil || n.Kind == yaml.MappingNode && len(n.Content) == 0 {
+		return nil, nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil, &Error{Msg: fmt.Sprintf("the root is a %s, and a flat file needs a map", kindName(n))}
+	}
+
+	var buf bytes.Buffer
+	written := map[string]bool{}
+	err := flatten(nil, n, func(path []part, value *yaml.Node) error {
+		names := pathNames(path)
+		key, err := formatKey(path)
+		if err != nil {
+			return &Error{Path: names, Msg: err.Error()}
+		}
+		if written[key] {
+			return &Error{Path: names, Msg: fmt.Sprintf("key %s is already written for an earlier value", key)}
+		}
+		written[key] = true
+		text, err := formatValue(value.Value)
+		if err != nil {
+			return &Error{Path: names, Msg: err.Error()}
+		}
+		buf.WriteString(key + "=" + text + "\n")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten calls fn for every scalar under n, in order, with its key path.
+func flatten(path []part, n *yaml.Node, fn func([]part, *yaml.Node) error) error {
+	n = resolve(n)
+	switch n.Kind {
+	case yaml.MappingNode:
+		entries, err := mapEntries(path, n)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return &Error{Path: pathNames(path), Msg: "empty map"}
+		}
+		for _, en := range entries {
+			if err := flatten(appendPath(path, part{name: en.key}), en.value, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			return &Error{Path: pathNames(path), Msg: "empty sequence"}
+		}
+		for i, elem := range n.Content {
+			if err := flatten(appendPath(path, part{name: strconv.Itoa(i), index: true}), elem, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		if n.ShortTag() == "!!null" {
+			return &Error{Path: pathNames(path), Msg: "null value"}
+		}
+		return fn(path, n)
+	}
+}
+
+// entry is a key and its value in a map.
+type entry struct {
+	key   string
+	value *yaml.Node
+}
+
+// mapEntries returns the entries of the mapping n in order, with merge keys
+// (<<) replaced by the entries they merge.
+func mapEntries(path []part, n *yaml.Node) ([]entry, error) {
+	explicit := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !isMergeKey(n.Content[i]) {
+			explicit[n.Content[i].Value] = true
+		}
+	}
+
+	var entries []entry
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := resolve(n.Content[i]), resolve(n.Content[i+1])
+		if !isMergeKey(k) {
+			if k.Kind != yaml.ScalarNode {
+				return nil, &Error{Path: pathNames(path), Msg: fmt.Sprintf("a %s key cannot be part of a flat key", kindName(k))}
+			}
+			entries = append(entries, entry{k.Value, v})
+			seen[k.Value] = true
+			continue
+		}
+
+		// Earlier maps in a merge sequence take precedence, and explicit keys over all
+		sources := []*yaml.Node{v}
+		if v.Kind == yaml.SequenceNode {
+			sources = v.Content
+		}
+		for _, src := range sources {
+			src = resolve(src)
+			if src.Kind != yaml.MappingNode {
+				return nil, &Error{Path: pathNames(path), Msg: fmt.Sprintf("a merge key holds a %s, not a map", kindName(src))}
+			}
+			merged, err := mapEntries(path, src)
+			if err != nil {
+				return nil, err
+			}
+			for _, en := range merged {
+				if !explicit[en.key] && !seen[en.key] {
+					entries = append(entries, en)
+					seen[en.key] = true
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+// escapeProperty escapes s as a .properties key or value.
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '=', r == ':', r == '#', r == '!':
+			b.WriteString(`\` + string(r))
+		case r == ' ' && (key || i == 0):
+			// Spaces end a key, and leading spaces of a value are skipped
+			b.WriteString(`\ `)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// quoteDotenv returns s as a dotenv value: bare if it holds only safe
+// characters, and double-quoted as a shell word otherwise.
+func quoteDotenv(s string) (string, error) {
+	if plainValueRe.MatchString(s) {
+		return s, nil
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\', r == '"', r == '$', r == '`':
+			b.WriteString(`\` + string(r))
+		case r < 0x20 && r != '\t' && r != '\n' || r == 0x7f:
+			return "", fmt.Errorf("value holds the control character %U", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
+
+// isMergeKey reports whether k is the YAML merge key <<.
+func isMergeKey(k *yaml.Node) bool {
+	return k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge"
+}
+
+// resolve follows alias nodes to the node they refer to.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// appendPath returns a new key path with p added to path.
+func appendPath(path []part, p part) []part {
+	return append(append(make([]part, 0, len(path)+1), path...), p)
+}
+
+// pathNames returns the names of the parts of path, for messages.
+func pathNames(path []part) []string {
+	names := make([]string, len(path))
+	for i, p := range path {
+		names[i] = p.name
+	}
+	return names
+}
+
+// kindName names the kind of n in messages.
+func kindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "map"
+	case yaml.SequenceNode:
+		return "sequence"
+	default:
+		return "scalar"
+	}
+}
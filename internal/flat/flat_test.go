@@ -0,0 +1,276 @@
+package flat
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// parse returns the document node of src.
+func parse(t *testing.T, src string) *yaml.Node {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	return &doc
+}
+
+func TestProperties(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "nested keys and sequences",
+			src:  "server:\n  port: 8080\n  hosts: [a, b]\nroutes:\n  - path: /\n    tags: [x]\n",
+			want: "server.port=8080\nserver.hosts[0]=a\nserver.hosts[1]=b\nroutes[0].path=/\nroutes[0].tags[0]=x\n",
+		},
+		{
+			name: "escaped keys and values",
+			src:  "\"a b=c\": \" lead: #1\\tend\\\\\"\nmsg: \"two\\nlines\"\nname: Zoë 😀\n",
+			want: "a\\ b\\=c=\\ lead\\: \\#1\\tend\\\\\nmsg=two\\nlines\nname=Zo\\u00EB \\uD83D\\uDE00\n",
+		},
+		{
+			name: "scalars keep their text",
+			src:  "on: true\nratio: 0.5\nday: 2024-01-02\nempty: \"\"\n",
+			want: "on=true\nratio=0.5\nday=2024-01-02\nempty=\n",
+		},
+		{
+			name: "aliases and merge keys",
+			src:  "base: &base\n  x: 1\nsite:\n  <<: *base\n  y: *base\n",
+			want: "base.x=1\nsite.x=1\nsite.y.x=1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Properties(parse(t, tt.src))
+			if err != nil {
+				t.Fatalf("Properties() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Properties() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDotenv(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "nested keys and sequences",
+			src:  "server:\n  port: 8080\n  max-conns: 10\nhosts: [a.example.com, b]\nurl: https://x.io/a\n",
+			want: "SERVER_PORT=8080\nSERVER_MAX_CONNS=10\nHOSTS_0=a.example.com\nHOSTS_1=b\nURL=https://x.io/a\n",
+		},
+		{
+			name: "quoted values",
+			src:  "greeting: hello world\nprice: \"$5 \\\"off\\\"\"\ncmd: \"`id` \\\\ x\"\nmulti: \"a\\nb\"\nurl: https://x.io/?a=1\nempty: \"\"\n",
+			want: "GREETING=\"hello world\"\nPRICE=\"\\$5 \\\"off\\\"\"\nCMD=\"\\`id\\` \\\\ x\"\nMULTI=\"a\nb\"\nURL=\"https://x.io/?a=1\"\nEMPTY=\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Dotenv(parse(t, tt.src))
+			if err != nil {
+				t.Fatalf("Dotenv() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Dotenv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// readerValues are values with the characters the readers of dotenv files
+// treat differently.
+var readerValues = map[string]string{
+	"PLAIN":     "a.example.com:8080",
+	"URL":       "https://x.io/a,b=1%20@c+d",
+	"SPACES":    "hello world",
+	"QUOTES":    `say "hi" it's`,
+	"DOLLAR":    "$HOME and ${PATH}",
+	"BACKTICK":  "`id`",
+	"BACKSLASH": `C:\dir\n`,
+	"NEWLINES":  "one\ntwo\n",
+	"TAB":       "a\tb",
+	"UNICODE":   "Zoë 😀",
+	"HASH":      "x # not a comment",
+	"EMPTY":     "",
+}
+
+// readShell sources out in a POSIX shell with set -a and returns the values
+// of keys as the shell sees them.
+func readShell(t *testing.T, out []byte, keys []string) map[string]string {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	file := filepath.Join(t.TempDir(), "app.env")
+	if err := os.WriteFile(file, out, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	script := `set -a; . "$1"`
+	for _, k := range keys {
+		script += `; printf '%s\0' "$` + k + `"`
+	}
+	got, err := exec.Command(sh, "-c", script, "sh", file).Output()
+	if err != nil {
+		t.Fatalf("sourcing %q: %v", out, err)
+	}
+	read := strings.Split(string(got), "\x00")
+	values := make(map[string]string, len(keys))
+	for i, k := range keys {
+		values[k] = read[i]
+	}
+	return values
+}
+
+// readLiteral reads out as docker --env-file does: each line is split at its
+// first = and the value is taken as written.
+func readLiteral(out []byte) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// TestDotenv_Readers reads the output back the ways the Dotenv doc names: a
+// shell must see every value unchanged, and a reader that takes values
+// literally, like docker --env-file, every value written bare.
+func TestDotenv_Readers(t *testing.T) {
+	var src strings.Builder
+	keys := make([]string, 0, len(readerValues))
+	for k, v := range readerValues {
+		src.WriteString(k + ": " + strconv.Quote(v) + "\n")
+		keys = append(keys, k)
+	}
+	out, err := Dotenv(parse(t, src.String()))
+	if err != nil {
+		t.Fatalf("Dotenv() error = %v", err)
+	}
+
+	t.Run("shell", func(t *testing.T) {
+		for k, v := range readShell(t, out, keys) {
+			if v != readerValues[k] {
+				t.Errorf("shell read %s = %q, want %q", k, v, readerValues[k])
+			}
+		}
+	})
+
+	t.Run("literal", func(t *testing.T) {
+		literal := readLiteral(out)
+		for _, k := range []string{"PLAIN", "URL", "EMPTY"} {
+			if literal[k] != readerValues[k] {
+				t.Errorf("literal read %s = %q, want %q", k, literal[k], readerValues[k])
+			}
+		}
+	})
+}
+
+// TestEnvFile_Readers checks that EnvFile writes every value it accepts so
+// that a shell and a literal reader both see it unchanged, and rejects the
+// others.
+func TestEnvFile_Readers(t *testing.T) {
+	accepted := map[string]bool{"PLAIN": true, "URL": true, "EMPTY": true}
+	var src strings.Builder
+	var keys []string
+	for k, v := range readerValues {
+		_, err := EnvFile(parse(t, k+": "+strconv.Quote(v)+"\n"))
+		if accepted[k] {
+			if err != nil {
+				t.Errorf("EnvFile(%s) error = %v", k, err)
+			}
+			src.WriteString(k + ": " + strconv.Quote(v) + "\n")
+			keys = append(keys, k)
+			continue
+		}
+		var flatErr *Error
+		if !errors.As(err, &flatErr) || !strings.Contains(err.Error(), "needs quotes") {
+			t.Errorf("EnvFile(%s) error = %v, want an *Error about quotes", k, err)
+		}
+	}
+	out, err := EnvFile(parse(t, src.String()))
+	if err != nil {
+		t.Fatalf("EnvFile() error = %v", err)
+	}
+
+	for name, read := range map[string]map[string]string{
+		"shell":   readShell(t, out, keys),
+		"literal": readLiteral(out),
+	} {
+		for _, k := range keys {
+			if read[k] != readerValues[k] {
+				t.Errorf("%s read %s = %q, want %q", name, k, read[k], readerValues[k])
+			}
+		}
+	}
+}
+
+func TestWrite_Empty(t *testing.T) {
+	for _, n := range []*yaml.Node{nil, {Kind: yaml.DocumentNode}, parse(t, "{}")} {
+		for name, write := range map[string]func(*yaml.Node) ([]byte, error){"Properties": Properties, "Dotenv": Dotenv, "EnvFile": EnvFile} {
+			got, err := write(n)
+			if err != nil || len(got) != 0 {
+				t.Errorf("%s() = %q, %v, want no output", name, got, err)
+			}
+		}
+	}
+}
+
+func TestWrite_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		dotenv   bool
+		src      string
+		wantPath string
+		want     string
+	}{
+		{"null", false, "a:\n  b: null\n", "a.b", "null value at a.b"},
+		{"null in sequence", true, "a: [1, ~]\n", "a.1", "null value at a.1"},
+		{"empty map", false, "a:\n  b: {}\n", "a.b", "empty map at a.b"},
+		{"empty sequence", true, "a: []\n", "a", "empty sequence at a"},
+		{"sequence root", false, "- 1\n", "", "the root is a sequence, and a flat file needs a map"},
+		{"complex key", false, "? [a]\n: 1\n", "", "a sequence key cannot be part of a flat key"},
+		{"properties collision", false, "a.b: 1\na:\n  b: 2\n", "a.b", "key a.b is already written for an earlier value"},
+		{"dotenv collision", true, "a_b: 1\na:\n  b: 2\n", "a.b", "key A_B is already written for an earlier value"},
+		{"invalid variable", true, "1st: x\n", "1st", "key 1ST is not a valid variable name"},
+		{"control character", true, "a: \"x\\ry\"\n", "a", "value holds the control character U+000D"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write := Properties
+			if tt.dotenv {
+				write = Dotenv
+			}
+			_, err := write(parse(t, tt.src))
+			var flatErr *Error
+			if !errors.As(err, &flatErr) {
+				t.Fatalf("error = %v, want an *Error", err)
+			}
+			if got := strings.Join(flatErr.Path, "."); got != tt.wantPath {
+				t.Errorf("Path = %q, want %q", got, tt.wantPath)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -17,13 +17,19 @@
 package include
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"go.yaml.in/yaml/v4"
+
+	"github.com/jksmth/fyaml/internal/packerr"
 )
 
 // includeRegex matches <<include(file)>> syntax with optional whitespace.
@@ -41,6 +47,39 @@ func (f *Fragment) UnmarshalYAML(n *yaml.Node) error {
 	return nil
 }
 
+// Origins records the file each node replaced by an !include tag was read
+// from, as a slash-separated path relative to the pack root. The nodes keep
+// the line and column they have in that file.
+type Origins map[*yaml.Node]string
+
+// Record collects what include processing read.
+type Record struct {
+	Origins Origins  // Nodes replaced by !include tags; not recorded if nil
+	Files   []string // Files read by any kind of include, as slash-separated paths relative to the pack root, once each in read order
+}
+
+// opener returns open, recording in r the files it opens. It is nil-safe.
+func (r *Record) opener(open opener) opener {
+	if r == nil {
+		return open
+	}
+	return func(p string, baseDir string) (fs.FS, string, func(), error) {
+		fsys, name, closeFn, err := open(p, baseDir)
+		if err == nil && !slices.Contains(r.Files, name) {
+			r.Files = append(r.Files, name)
+		}
+		return fsys, name, closeFn, err
+	}
+}
+
+// origins returns the origins to record, or nil. It is nil-safe.
+func (r *Record) origins() Origins {
+	if r == nil {
+		return nil
+	}
+	return r.Origins
+}
+
 // TagProcessor is a function that processes a YAML node with a specific tag.
 type TagProcessor = func(n *yaml.Node, baseDir string, packRoot string) error
 
@@ -79,24 +118,75 @@ func resolvePath(path string, baseDir string, packRoot string) (absPackRoot stri
 	return absPackRoot, relPath, nil
 }
 
+// opener resolves an include path relative to baseDir and returns the
+// filesystem and name to read it from. The returned close function releases
+// any resources held for the read and must always be called.
+type opener func(path string, baseDir string) (fsys fs.FS, name string, closeFn func(), err error)
+
+// rootOpener returns an opener that resolves include paths on the OS
+// filesystem, confined to packRoot.
+func rootOpener(packRoot string) opener {
+	return func(path string, baseDir string) (fs.FS, string, func(), error) {
+		absPackRoot, relPath, err := resolvePath(path, baseDir, packRoot)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		// Use os.Root to read file - automatically prevents directory traversal
+		root, err := os.OpenRoot(absPackRoot)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("could not open pack root %s: %w", packRoot, err)
+		}
+		closeFn := func() {
+			_ = root.Close() // Ignore error - resource cleanup
+		}
+
+		return root.FS(), filepath.ToSlash(relPath), closeFn, nil
+	}
+}
+
+// fsOpener returns an opener that resolves include paths within fsys.
+// The root of fsys is the pack root, and baseDir is a slash-separated
+// directory within fsys.
+func fsOpener(fsys fs.FS) opener {
+	return func(p string, baseDir string) (fs.FS, string, func(), error) {
+		name, err := resolveFSPath(p, baseDir)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return fsys, name, func() {}, nil
+	}
+}
+
+// resolveFSPath resolves a slash-separated include path relative to baseDir
+// and validates it stays within the root of the filesystem.
+func resolveFSPath(p string, baseDir string) (string, error) {
+	if path.IsAbs(p) || filepath.IsAbs(p) {
+		return "", fmt.Errorf("include path %s must be relative when packing from a filesystem", p)
+	}
+
+	name := path.Join(baseDir, filepath.ToSlash(p))
+	if name == ".." || strings.HasPrefix(name, "../") || !fs.ValidPath(name) {
+		return "", fmt.Errorf("include path %s escapes pack root", p)
+	}
+
+	return name, nil
+}
+
 // LoadFileText reads a file and returns its contents as a string.
 // Paths are resolved relative to baseDir and must be within packRoot.
 func LoadFileText(path string, baseDir string, packRoot string) (string, error) {
-	absPackRoot, relPath, err := resolvePath(path, baseDir, packRoot)
-	if err != nil {
-		return "", err
-	}
+	return loadFileText(path, baseDir, rootOpener(packRoot))
+}
 
-	// Use os.Root to read file - automatically prevents directory traversal
-	root, err := os.OpenRoot(absPackRoot)
+func loadFileText(path string, baseDir string, open opener) (string, error) {
+	fsys, name, closeFn, err := open(path, baseDir)
 	if err != nil {
-		return "", fmt.Errorf("could not open pack root %s: %w", packRoot, err)
+		return "", err
 	}
-	defer func() {
-		_ = root.Close() // Ignore error in defer - resource cleanup
-	}()
+	defer closeFn()
 
-	data, err := root.ReadFile(relPath)
+	data, err := fs.ReadFile(fsys, name)
 	if err != nil {
 		return "", fmt.Errorf("could not open %s for inclusion", path)
 	}
@@ -107,32 +197,31 @@ func LoadFileText(path string, baseDir string, packRoot string) (string, error)
 // LoadFileFragment reads in and parses a given file returning a YAML node.
 // Paths are resolved relative to baseDir and must be within packRoot.
 func LoadFileFragment(path string, baseDir string, packRoot string) (*yaml.Node, error) {
-	absPackRoot, relPath, err := resolvePath(path, baseDir, packRoot)
-	if err != nil {
-		return nil, err
-	}
+	fragment, _, err := loadFileFragment(path, baseDir, rootOpener(packRoot))
+	return fragment, err
+}
 
-	// Use os.Root to read file - automatically prevents directory traversal
-	root, err := os.OpenRoot(absPackRoot)
+// loadFileFragment is like LoadFileFragment, and also returns the name of the
+// file it read.
+func loadFileFragment(path string, baseDir string, open opener) (*yaml.Node, string, error) {
+	fsys, name, closeFn, err := open(path, baseDir)
 	if err != nil {
-		return nil, fmt.Errorf("could not open pack root %s: %w", packRoot, err)
+		return nil, "", err
 	}
-	defer func() {
-		_ = root.Close() // Ignore error in defer - resource cleanup
-	}()
+	defer closeFn()
 
-	data, err := root.ReadFile(relPath)
+	data, err := fs.ReadFile(fsys, name)
 	if err != nil {
-		return nil, fmt.Errorf("could not open %s for inclusion: %w", path, err)
+		return nil, "", fmt.Errorf("could not open %s for inclusion: %w", path, err)
 	}
 
 	var f Fragment
 	err = yaml.Unmarshal(data, &f)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse YAML/JSON in %s: %w", path, err)
+		return nil, "", fmt.Errorf("failed to parse YAML/JSON in %s: %w", path, err)
 	}
 
-	return f.Content, nil
+	return f.Content, name, nil
 }
 
 // HandleCustomTag recursively searches YAML nodes for the tag and calls the tag processor function.
@@ -172,40 +261,79 @@ func HandleCustomTag(n *yaml.Node, tag string, fn TagProcessor, baseDir string,
 // ProcessIncludeTag recursively searches for the !include tag from the given node
 // and replaces the tag node with content of the included file (parsed as YAML).
 func ProcessIncludeTag(n *yaml.Node, baseDir string, packRoot string) error {
-	return HandleCustomTag(n, "!include", func(n *yaml.Node, baseDir string, packRoot string) error {
+	return processIncludeTag(n, baseDir, rootOpener(packRoot))
+}
+
+func processIncludeTag(n *yaml.Node, baseDir string, open opener) error {
+	return processIncludeTagChain(n, baseDir, open, nil, nil)
+}
+
+// processIncludeTagChain processes !include tags in n, which was reached by
+// following the include paths in chain. Included fragments are fully
+// processed before they replace their tag, so errors carry the chain. The
+// replaced nodes are recorded in origins, if it is not nil.
+func processIncludeTagChain(n *yaml.Node, baseDir string, open opener, chain []string, origins Origins) error {
+	return HandleCustomTag(n, "!include", func(n *yaml.Node, baseDir string, _ string) error {
 		if n.Kind != yaml.ScalarNode {
-			return fmt.Errorf("!include tag must be used on a scalar value, got %v", n.Kind)
+			return includeError(n.Value, chain, fmt.Errorf("!include tag must be used on a scalar value, got %v", n.Kind))
 		}
 
-		fragment, err := LoadFileFragment(n.Value, baseDir, packRoot)
+		target := path.Clean(filepath.ToSlash(n.Value))
+		for _, c := range chain {
+			if path.Clean(filepath.ToSlash(c)) == target {
+				return includeError(n.Value, chain, fmt.Errorf("include cycle: %s includes itself", n.Value))
+			}
+		}
+
+		fragment, name, err := loadFileFragment(n.Value, baseDir, open)
 		if err != nil {
+			return includeError(n.Value, chain, err)
+		}
+
+		if err := processIncludesChain(fragment, baseDir, open, appendChain(chain, n.Value), origins); err != nil {
 			return err
 		}
 
+		if origins != nil {
+			// A fragment that is itself an include holds the content of that file
+			if nested, ok := origins[fragment]; ok {
+				name = nested
+			}
+			origins[n] = name
+		}
+
 		// Replace the node with the fragment content
 		*n = *fragment
 		return nil
-	}, baseDir, packRoot)
+	}, baseDir, "")
 }
 
 // ProcessIncludeTextTag recursively searches for the !include-text tag from the given node
 // and replaces the tag node with the raw text content of the included file.
 func ProcessIncludeTextTag(n *yaml.Node, baseDir string, packRoot string) error {
-	return HandleCustomTag(n, "!include-text", func(n *yaml.Node, baseDir string, packRoot string) error {
+	return processIncludeTextTag(n, baseDir, rootOpener(packRoot))
+}
+
+func processIncludeTextTag(n *yaml.Node, baseDir string, open opener) error {
+	return processIncludeTextTagChain(n, baseDir, open, nil)
+}
+
+func processIncludeTextTagChain(n *yaml.Node, baseDir string, open opener, chain []string) error {
+	return HandleCustomTag(n, "!include-text", func(n *yaml.Node, baseDir string, _ string) error {
 		if n.Kind != yaml.ScalarNode {
-			return fmt.Errorf("!include-text tag must be used on a scalar value, got %v", n.Kind)
+			return includeError(n.Value, chain, fmt.Errorf("!include-text tag must be used on a scalar value, got %v", n.Kind))
 		}
 
-		text, err := LoadFileText(n.Value, baseDir, packRoot)
+		text, err := loadFileText(n.Value, baseDir, open)
 		if err != nil {
-			return err
+			return includeError(n.Value, chain, err)
 		}
 
 		// Replace node with text content
 		n.Tag = "!!str"
 		n.Value = text
 		return nil
-	}, baseDir, packRoot)
+	}, baseDir, "")
 }
 
 // MaybeIncludeFile checks if the string s is an include directive and returns
@@ -219,10 +347,18 @@ func ProcessIncludeTextTag(n *yaml.Node, baseDir string, packRoot string) error
 //
 // Based on CircleCI CLI: https://github.com/CircleCI-Public/circleci-cli
 func MaybeIncludeFile(s string, baseDir string, packRoot string) (string, error) {
+	return maybeIncludeFile(s, baseDir, rootOpener(packRoot))
+}
+
+func maybeIncludeFile(s string, baseDir string, open opener) (string, error) {
+	return maybeIncludeFileChain(s, baseDir, open, nil)
+}
+
+func maybeIncludeFileChain(s string, baseDir string, open opener, chain []string) (string, error) {
 	// Only find up to 2 matches, because we throw an error if we find >1
 	includeMatches := includeRegex.FindAllStringSubmatch(s, 2)
 	if len(includeMatches) > 1 {
-		return "", fmt.Errorf("multiple include statements: '%s'", s)
+		return "", includeError(s, chain, fmt.Errorf("multiple include statements: '%s'", s))
 	}
 
 	if len(includeMatches) == 1 {
@@ -231,11 +367,15 @@ func MaybeIncludeFile(s string, baseDir string, packRoot string) (string, error)
 
 		// Throw an error if the entire string wasn't matched
 		if fullMatch != s {
-			return "", fmt.Errorf("entire string must be include statement: '%s'", s)
+			return "", includeError(s, chain, fmt.Errorf("entire string must be include statement: '%s'", s))
 		}
 
-		// Use shared LoadFileText for actual file loading
-		return LoadFileText(subMatch, baseDir, packRoot)
+		// Use shared loadFileText for actual file loading
+		text, err := loadFileText(subMatch, baseDir, open)
+		if err != nil {
+			return "", includeError(subMatch, chain, err)
+		}
+		return text, nil
 	}
 
 	return s, nil
@@ -249,6 +389,14 @@ func MaybeIncludeFile(s string, baseDir string, packRoot string) (string, error)
 //
 // Based on CircleCI CLI: https://github.com/CircleCI-Public/circleci-cli
 func InlineIncludes(node *yaml.Node, baseDir string, packRoot string) error {
+	return inlineIncludes(node, baseDir, rootOpener(packRoot))
+}
+
+func inlineIncludes(node *yaml.Node, baseDir string, open opener) error {
+	return inlineIncludesChain(node, baseDir, open, nil)
+}
+
+func inlineIncludesChain(node *yaml.Node, baseDir string, open opener, chain []string) error {
 	if node == nil {
 		return nil
 	}
@@ -256,14 +404,14 @@ func InlineIncludes(node *yaml.Node, baseDir string, packRoot string) error {
 	// If we're dealing with a ScalarNode, we can replace the contents.
 	// Otherwise, we recurse into the children of the Node.
 	if node.Kind == yaml.ScalarNode && node.Value != "" {
-		v, err := MaybeIncludeFile(node.Value, baseDir, packRoot)
+		v, err := maybeIncludeFileChain(node.Value, baseDir, open, chain)
 		if err != nil {
 			return err
 		}
 		node.Value = v
 	} else {
 		for _, child := range node.Content {
-			err := InlineIncludes(child, baseDir, packRoot)
+			err := inlineIncludesChain(child, baseDir, open, chain)
 			if err != nil {
 				return err
 			}
@@ -279,24 +427,66 @@ func InlineIncludes(node *yaml.Node, baseDir string, packRoot string) error {
 //  2. !include-text tags (text content)
 //  3. <<include()>> directives (backward-compatible alias for !include-text)
 func ProcessIncludes(node *yaml.Node, baseDir string, packRoot string) error {
+	return ProcessIncludesRecorded(node, baseDir, packRoot, nil)
+}
+
+// ProcessIncludesRecorded is like ProcessIncludes, and records the files it
+// reads and the nodes replaced by !include tags in rec.
+func ProcessIncludesRecorded(node *yaml.Node, baseDir string, packRoot string, rec *Record) error {
+	return processIncludesChain(node, baseDir, rec.opener(rootOpener(packRoot)), nil, rec.origins())
+}
+
+// ProcessIncludesFS is like ProcessIncludes, but resolves include paths within
+// fsys instead of the OS filesystem. The root of fsys is the pack root, and
+// baseDir is the slash-separated directory of the including file within fsys.
+// Absolute include paths are rejected.
+func ProcessIncludesFS(node *yaml.Node, fsys fs.FS, baseDir string) error {
+	return ProcessIncludesFSRecorded(node, fsys, baseDir, nil)
+}
+
+// ProcessIncludesFSRecorded is like ProcessIncludesFS, and records the files
+// it reads and the nodes replaced by !include tags in rec.
+func ProcessIncludesFSRecorded(node *yaml.Node, fsys fs.FS, baseDir string, rec *Record) error {
+	return processIncludesChain(node, baseDir, rec.opener(fsOpener(fsys)), nil, rec.origins())
+}
+
+// processIncludesChain processes all includes in node, which was reached by
+// following the include paths in chain, recording the nodes replaced by
+// !include tags in origins if it is not nil.
+func processIncludesChain(node *yaml.Node, baseDir string, open opener, chain []string, origins Origins) error {
 	if node == nil {
 		return nil
 	}
 
 	// 1. Process !include tags (YAML structures)
-	if err := ProcessIncludeTag(node, baseDir, packRoot); err != nil {
+	if err := processIncludeTagChain(node, baseDir, open, chain, origins); err != nil {
 		return err
 	}
 
 	// 2. Process !include-text tags (text content)
-	if err := ProcessIncludeTextTag(node, baseDir, packRoot); err != nil {
+	if err := processIncludeTextTagChain(node, baseDir, open, chain); err != nil {
 		return err
 	}
 
 	// 3. Process <<include()>> directives (backward compat)
-	if err := InlineIncludes(node, baseDir, packRoot); err != nil {
+	if err := inlineIncludesChain(node, baseDir, open, chain); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// includeError wraps err as a *packerr.IncludeError for target, unless it
+// already is one from a nested include.
+func includeError(target string, chain []string, err error) error {
+	var includeErr *packerr.IncludeError
+	if errors.As(err, &includeErr) {
+		return err
+	}
+	return &packerr.IncludeError{Target: target, Chain: chain, Err: err}
+}
+
+// appendChain returns a new chain with target added.
+func appendChain(chain []string, target string) []string {
+	return append(append(make([]string, 0, len(chain)+1), chain...), target)
+}
@@ -1,13 +1,18 @@
 package include
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"go.yaml.in/yaml/v4"
+
+	"github.com/jksmth/fyaml/internal/packerr"
 )
 
 func TestMaybeIncludeFile_NoInclude(t *testing.T) {
@@ -1048,3 +1053,162 @@ func TestProcessIncludeTag_JSONFileWithTag(t *testing.T) {
 		t.Errorf("ProcessIncludeTag() did not include JSON content. Got retries: %v", config["retries"])
 	}
 }
+
+func TestProcessIncludesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shared/defaults.yml": {Data: []byte("timeout: 30")},
+		"shared/script.sh":    {Data: []byte("echo hi")},
+	}
+
+	var node yaml.Node
+	input := `config: !include ../shared/defaults.yml
+script: !include-text ../shared/script.sh
+legacy: <<include(../shared/script.sh)>>`
+	if err := yaml.Unmarshal([]byte(input), &node); err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+
+	if err := ProcessIncludesFS(&node, fsys, "entities"); err != nil {
+		t.Fatalf("ProcessIncludesFS() error = %v", err)
+	}
+
+	var result map[string]interface{}
+	if err := node.Decode(&result); err != nil {
+		t.Fatalf("Failed to decode node: %v", err)
+	}
+	config, ok := result["config"].(map[string]interface{})
+	if !ok || config["timeout"] != 30 {
+		t.Errorf("config = %v, want map with timeout: 30", result["config"])
+	}
+	if result["script"] != "echo hi" {
+		t.Errorf("script = %v, want 'echo hi'", result["script"])
+	}
+	if result["legacy"] != "echo hi" {
+		t.Errorf("legacy = %v, want 'echo hi'", result["legacy"])
+	}
+}
+
+func TestProcessIncludesFSRecorded(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shared/defaults.yml": {Data: []byte("timeout: 30")},
+		"shared/alias.yml":    {Data: []byte("!include ../shared/defaults.yml")},
+		"shared/script.sh":    {Data: []byte("echo hi")},
+		"shared/banner.txt":   {Data: []byte("hello")},
+	}
+
+	var node yaml.Node
+	input := `config: !include ../shared/defaults.yml
+aliased: !include ../shared/alias.yml
+script: !include-text ../shared/script.sh
+banner: <<include(../shared/banner.txt)>>`
+	if err := yaml.Unmarshal([]byte(input), &node); err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+
+	rec := &Record{Origins: Origins{}}
+	if err := ProcessIncludesFSRecorded(&node, fsys, "entities", rec); err != nil {
+		t.Fatalf("ProcessIncludesFSRecorded() error = %v", err)
+	}
+	origins := rec.Origins
+
+	// Every kind of include is listed once, in read order
+	files := []string{"shared/defaults.yml", "shared/alias.yml", "shared/script.sh", "shared/banner.txt"}
+	if !reflect.DeepEqual(rec.Files, files) {
+		t.Errorf("Files = %v, want %v", rec.Files, files)
+	}
+
+	root := node.Content[0]
+	if got := origins[root.Content[1]]; got != "shared/defaults.yml" {
+		t.Errorf("origin of config = %q, want shared/defaults.yml", got)
+	}
+	// A fragment that is itself an include is located in the file it read
+	if got := origins[root.Content[3]]; got != "shared/defaults.yml" {
+		t.Errorf("origin of aliased = %q, want shared/defaults.yml", got)
+	}
+	// Text includes keep the position of the including file
+	if got, ok := origins[root.Content[5]]; ok {
+		t.Errorf("origin of script = %q, want none", got)
+	}
+}
+
+func TestProcessIncludesFS_Errors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pack/file.yml": {Data: []byte("key: value")},
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		baseDir string
+		wantErr string
+	}{
+		{"escapes root", "key: !include ../../secret.yml", "pack", "escapes pack root"},
+		{"absolute path", "key: !include /etc/passwd", "pack", "must be relative"},
+		{"missing file", "key: !include-text missing.txt", "pack", "could not open missing.txt for inclusion"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.input), &node); err != nil {
+				t.Fatalf("Failed to parse YAML: %v", err)
+			}
+
+			err := ProcessIncludesFS(&node, fsys, tt.baseDir)
+			if err == nil {
+				t.Fatalf("ProcessIncludesFS() expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ProcessIncludesFS() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessIncludesFS_IncludeErrorChain(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pack/level1.yml": {Data: []byte("nested: !include level2.yml")},
+		"pack/level2.yml": {Data: []byte("script: <<include(missing.sh)>>")},
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("root: !include level1.yml"), &node); err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+
+	err := ProcessIncludesFS(&node, fsys, "pack")
+	var includeErr *packerr.IncludeError
+	if !errors.As(err, &includeErr) {
+		t.Fatalf("ProcessIncludesFS() error = %v, want *packerr.IncludeError", err)
+	}
+	if includeErr.Target != "missing.sh" {
+		t.Errorf("Target = %q, want %q", includeErr.Target, "missing.sh")
+	}
+	if want := []string{"level1.yml", "level2.yml"}; !reflect.DeepEqual(includeErr.Chain, want) {
+		t.Errorf("Chain = %v, want %v", includeErr.Chain, want)
+	}
+	if !strings.Contains(err.Error(), "(included via level1.yml -> level2.yml)") {
+		t.Errorf("ProcessIncludesFS() error = %v, want the include chain", err)
+	}
+}
+
+func TestProcessIncludesFS_IncludeCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pack/a.yml": {Data: []byte("b: !include b.yml")},
+		"pack/b.yml": {Data: []byte("a: !include ./a.yml")},
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("root: !include a.yml"), &node); err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+
+	err := ProcessIncludesFS(&node, fsys, "pack")
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("ProcessIncludesFS() error = %v, want include cycle", err)
+	}
+	var includeErr *packerr.IncludeError
+	if !errors.As(err, &includeErr) || !reflect.DeepEqual(includeErr.Chain, []string{"a.yml", "b.yml"}) {
+		t.Errorf("ProcessIncludesFS() error = %#v, want chain [a.yml b.yml]", err)
+	}
+}
@@ -0,0 +1,621 @@
+// Package json5 reads JSON5 documents, and with them JSONC, into yaml.Node
+// trees for FYAML packing.
+//
+// JSON5 extends JSON with comments, trailing commas, single-quoted strings,
+// unquoted keys and more number forms. JSONC, JSON with comments and
+// trailing commas, is a subset of it, so both are read by the same parser.
+package json5
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// SyntaxError is invalid JSON5 in a source file.
+type SyntaxError struct {
+	Line   int    // 1-based line
+	Column int    // 1-based column
+	Msg    string // Description of the problem
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+var (
+	// jsonIntRe and jsonFloatRe match numbers written as plain JSON, which
+	// keep their text; other JSON5 forms are normalized.
+	jsonIntRe   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	jsonFloatRe = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+	decIntRe    = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+	hexIntRe    = regexp.MustCompile(`^[+-]?0[xX][0-9A-Fa-f]+$`)
+	floatRe     = regexp.MustCompile(`^[+-]?((0|[1-9][0-9]*)(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+)
+
+// Decode parses the JSON5 document src into the root node of a YAML
+// document with the same content, or nil if src holds no value. Nodes carry
+// the line and column of their source, and keys keep their order.
+//
+// Comments on the lines before a member or array item are kept as its head
+// comment, and a comment after it on the same line as its line comment;
+// comments before a root object go to its first member. Other comments are
+// dropped. Objects and arrays written on one line use the flow style, and
+// keys and strings keep their quotes. Decode fails with a *SyntaxError,
+// including for a key defined twice in an object.
+func Decode(src []byte) (*yaml.Node, error) {
+	if !utf8.Valid(src) {
+		return nil, &SyntaxError{Line: 1, Column: 1, Msg: "document is not valid UTF-8"}
+	}
+	p := &parser{src: src, line: 1}
+	if err := p.skipBlank(); err != nil {
+		return nil, err
+	}
+	if p.eof() {
+		return nil, nil
+	}
+	// Comments before an array or scalar root stay on the root itself
+	var comments []string
+	if p.peek() != '{' {
+		comments, p.comments = p.comments, nil
+	}
+	n, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) > 0 {
+		n.HeadComment = strings.Join(comments, "\n")
+	}
+	if comment, err := p.lineComment(); err != nil {
+		return nil, err
+	} else if comment != "" && n.LineComment == "" {
+		n.LineComment = comment
+	}
+	if err := p.skipBlank(); err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("expected the end of the document")
+	}
+	return n, nil
+}
+
+type parser struct {
+	src       []byte
+	pos       int
+	line      int      // Line of pos, 1-based
+	lineStart int      // Offset of the start of the line
+	comments  []string // Comment lines waiting for the next member or item
+}
+
+// value parses a value.
+func (p *parser) value() (*yaml.Node, error) {
+	line, col := p.line, p.column()
+	scalar := func(tag, value string, style yaml.Style) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Style: style, Line: line, Column: col}
+	}
+
+	switch c := p.peek(); {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"' || c == '\'':
+		s, style, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return scalar("!!str", s, style), nil
+	}
+
+	start := p.pos
+	for isValueChar(p.peek()) {
+		p.advance(1)
+	}
+	tok := string(p.src[start:p.pos])
+	invalid := func(msg string) error {
+		return &SyntaxError{Line: line, Column: col, Msg: msg}
+	}
+
+	switch {
+	case tok == "":
+		return nil, invalid("expected a value")
+	case tok == "true", tok == "false":
+		return scalar("!!bool", tok, 0), nil
+	case tok == "null":
+		return scalar("!!null", tok, 0), nil
+	case strings.TrimLeft(tok, "+-") == "Infinity" && len(tok) <= len("Infinity")+1:
+		return scalar("!!float", strings.TrimPrefix(strings.Replace(tok, "Infinity", ".inf", 1), "+"), 0), nil
+	case strings.TrimLeft(tok, "+-") == "NaN" && len(tok) <= len("NaN")+1:
+		return scalar("!!float", ".nan", 0), nil
+
+	case jsonIntRe.MatchString(tok):
+		if _, err := strconv.ParseInt(tok, 10, 64); err != nil {
+			// Too large for an integer, so read as a float, as in JavaScript
+			f, _ := strconv.ParseFloat(tok, 64)
+			return scalar("!!float", strconv.FormatFloat(f, 'g', -1, 64), 0), nil
+		}
+		return scalar("!!int", tok, 0), nil
+	case jsonFloatRe.MatchString(tok):
+		if _, err := strconv.ParseFloat(tok, 64); err != nil {
+			return nil, invalid(fmt.Sprintf("number %s is out of range", tok))
+		}
+		return scalar("!!float", tok, 0), nil
+
+	case decIntRe.MatchString(tok), hexIntRe.MatchString(tok):
+		i, err := strconv.ParseInt(tok, 0, 64)
+		if err != nil {
+			return nil, invalid(fmt.Sprintf("integer %s is out of range", tok))
+		}
+		return scalar("!!int", strconv.FormatInt(i, 10), 0), nil
+	case floatRe.MatchString(tok):
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil || math.IsInf(f, 0) {
+			return nil, invalid(fmt.Sprintf("number %s is out of range", tok))
+		}
+		value := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(value, ".e") {
+			value += ".0"
+		}
+		return scalar("!!float", value, 0), nil
+
+	default:
+		return nil, invalid(fmt.Sprintf("invalid value %s", tok))
+	}
+}
+
+// object parses an object. The waiting comments, and those inside it, go to
+// its members.
+func (p *parser) object() (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: p.line, Column: p.column()}
+	keys := map[string]bool{}
+	p.advance(1)
+	for {
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '}' {
+			break
+		}
+
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if keys[key.Value] {
+			return nil, &SyntaxError{Line: key.Line, Column: key.Column, Msg: fmt.Sprintf("key %q is already defined", key.Value)}
+		}
+		keys[key.Value] = true
+		p.headComment(key)
+
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if p.peek() != ':' {
+			return nil, p.errorf("expected : after the key")
+		}
+		p.advance(1)
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		// Comments between the colon and the value are dropped
+		p.comments = nil
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, key, value)
+
+		more, comment, err := p.next('}', "expected , or } in the object")
+		if err != nil {
+			return nil, err
+		}
+		if comment != "" {
+			if value.Kind == yaml.ScalarNode || value.Style == yaml.FlowStyle {
+				value.LineComment = comment
+			} else {
+				key.LineComment = comment
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	p.close(n)
+	return n, nil
+}
+
+// array parses an array. The waiting comments, and those inside it, go to
+// its items.
+func (p *parser) array() (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: p.line, Column: p.column()}
+	p.advance(1)
+	for {
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if p.peek() == ']' {
+			break
+		}
+
+		// Comments above an object or array item stay on the item
+		comments := p.comments
+		p.comments = nil
+		elem, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if len(comments) > 0 && elem.HeadComment == "" {
+			elem.HeadComment = strings.Join(comments, "\n")
+		}
+		n.Content = append(n.Content, elem)
+
+		more, comment, err := p.next(']', "expected , or ] in the array")
+		if err != nil {
+			return nil, err
+		}
+		if comment != "" && elem.LineComment == "" {
+			elem.LineComment = comment
+		}
+		if !more {
+			break
+		}
+	}
+	p.close(n)
+	return n, nil
+}
+
+// close consumes the delimiter closing the object or array n, dropping the
+// comments before it. An object or array written on one line uses the flow
+// style, which has no room for comments inside it.
+func (p *parser) close(n *yaml.Node) {
+	p.comments = nil
+	p.advance(1)
+	if n.Line == p.line {
+		n.Style = yaml.FlowStyle
+		dropComments(n)
+	}
+}
+
+// next consumes the comma after a member or item, if any, and the comment
+// after them on the same line. It reports whether another member or item
+// may follow; if not, the closing delimiter is next.
+func (p *parser) next(closing byte, msg string) (bool, string, error) {
+	comment, err := p.lineComment()
+	if err != nil {
+		return false, "", err
+	}
+	if err := p.skipBlank(); err != nil {
+		return false, "", err
+	}
+	switch p.peek() {
+	case ',':
+		p.advance(1)
+		if comment == "" {
+			if comment, err = p.lineComment(); err != nil {
+				return false, "", err
+			}
+		}
+		return true, comment, nil
+	case closing:
+		return false, comment, nil
+	default:
+		return false, "", p.errorf("%s", msg)
+	}
+}
+
+// key parses an object key: a string or an identifier.
+func (p *parser) key() (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Line: p.line, Column: p.column()}
+	if c := p.peek(); c == '"' || c == '\'' {
+		s, style, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		n.Value, n.Style = s, style
+		return n, nil
+	}
+
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRune(p.src[p.pos:])
+		if !isIdentifierRune(r, p.pos == start) {
+			break
+		}
+		p.advance(size)
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a key")
+	}
+	n.Value = string(p.src[start:p.pos])
+	return n, nil
+}
+
+// str parses a single- or double-quoted string, and returns it with the
+// style that keeps its quotes.
+func (p *parser) str() (string, yaml.Style, error) {
+	quote := p.peek()
+	style := yaml.DoubleQuotedStyle
+	if quote == '\'' {
+		style = yaml.SingleQuotedStyle
+	}
+	p.advance(1)
+	var b strings.Builder
+	for {
+		switch c := p.peek(); {
+		case p.eof(), c == '\n', c == '\r':
+			return "", 0, p.errorf("unterminated string")
+		case c == quote:
+			p.advance(1)
+			return b.String(), style, nil
+		case c == '\\':
+			if err := p.escape(&b); err != nil {
+				return "", 0, err
+			}
+		default:
+			r, size := utf8.DecodeRune(p.src[p.pos:])
+			if r < 0x20 {
+				return "", 0, p.errorf("control character %U in string", r)
+			}
+			b.WriteRune(r)
+			p.advance(size)
+		}
+	}
+}
+
+// escape parses an escape sequence in a string and writes its character to
+// b. A backslash before a line ending continues the string on the next line.
+func (p *parser) escape(b *strings.Builder) error {
+	line, col := p.line, p.column()
+	p.advance(1)
+	if p.newline() {
+		return nil
+	}
+	r, size := utf8.DecodeRune(p.src[p.pos:])
+	simple := map[rune]rune{'b': '\b', 't': '\t', 'n': '\n', 'v': '\v', 'f': '\f', 'r': '\r'}
+	switch {
+	case p.eof():
+		return p.errorf("unterminated string")
+	case simple[r] != 0:
+		b.WriteRune(simple[r])
+		p.advance(1)
+		return nil
+	case r == '0' && !isDigit(p.at(1)):
+		b.WriteByte(0)
+		p.advance(1)
+		return nil
+	case r == '\u2028' || r == '\u2029':
+		p.advance(size)
+		return nil
+	case r == 'x' || r == 'u':
+		code, err := p.hexEscape(map[rune]int{'x': 2, 'u': 4}[r])
+		if err != nil {
+			return &SyntaxError{Line: line, Column: col, Msg: "invalid escape sequence"}
+		}
+		// A surrogate pair is written as two \u escapes
+		if utf16High(code) && p.hasPrefix(`\u`) {
+			p.advance(1)
+			low, err := p.hexEscape(4)
+			if err != nil || low < 0xDC00 || low > 0xDFFF {
+				return &SyntaxError{Line: line, Column: col, Msg: "invalid escape sequence"}
+			}
+			code = 0x10000 + (code-0xD800)<<10 + (low - 0xDC00)
+		}
+		if !utf8.ValidRune(code) {
+			return &SyntaxError{Line: line, Column: col, Msg: "invalid escape sequence"}
+		}
+		b.WriteRune(code)
+		return nil
+	case '0' <= r && r <= '9':
+		return &SyntaxError{Line: line, Column: col, Msg: "invalid escape sequence"}
+	default:
+		// Any other character stands for itself
+		b.WriteRune(r)
+		p.advance(size)
+		return nil
+	}
+}
+
+// hexEscape parses the letter of a \x or \u escape and the given number of
+// hex digits after it.
+func (p *parser) hexEscape(digits int) (rune, error) {
+	if p.pos+1+digits > len(p.src) {
+		return 0, strconv.ErrSyntax
+	}
+	code, err := strconv.ParseUint(string(p.src[p.pos+1:p.pos+1+digits]), 16, 32)
+	if err != nil {
+		return 0, err
+	}
+	p.advance(1 + digits)
+	return rune(code), nil
+}
+
+// lineComment consumes a comment after a value on the same line, and
+// returns it.
+func (p *parser) lineComment() (string, error) {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.advance(1)
+	}
+	if !p.hasPrefix("//") && !p.hasPrefix("/*") {
+		return "", nil
+	}
+	lines, err := p.comment()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// skipBlank skips whitespace and comments, keeping the comments for the next
+// member or item.
+func (p *parser) skipBlank() error {
+	for !p.eof() {
+		if p.hasPrefix("//") || p.hasPrefix("/*") {
+			lines, err := p.comment()
+			if err != nil {
+				return err
+			}
+			p.comments = append(p.comments, lines...)
+			continue
+		}
+		r, size := utf8.DecodeRune(p.src[p.pos:])
+		if !unicode.IsSpace(r) && r != '\uFEFF' {
+			return nil
+		}
+		p.advance(size)
+	}
+	return nil
+}
+
+// comment consumes a // or /* */ comment and returns its lines as YAML
+// comment lines. The leading * of the lines of a block comment is dropped.
+func (p *parser) comment() ([]string, error) {
+	line, col := p.line, p.column()
+	var text string
+	if p.hasPrefix("//") {
+		start := p.pos + 2
+		for !p.eof() && p.peek() != '\n' && p.peek() != '\r' {
+			p.advance(1)
+		}
+		text = string(p.src[start:p.pos])
+	} else {
+		end := strings.Index(string(p.src[p.pos+2:]), "*/")
+		if end < 0 {
+			return nil, &SyntaxError{Line: line, Column: col, Msg: "unterminated comment"}
+		}
+		text = string(p.src[p.pos+2 : p.pos+2+end])
+		p.advance(end + 4)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		if i > 0 || strings.HasPrefix(text, "*") {
+			l = strings.TrimPrefix(strings.TrimLeft(l, " \t"), "*")
+		}
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	// Drop the blank lines of a comment such as /**\n * text\n */
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for len(lines) > 1 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for i, l := range lines {
+		switch {
+		case l == "":
+			lines[i] = "#"
+		case strings.HasPrefix(l, " "):
+			lines[i] = "#" + l
+		default:
+			lines[i] = "# " + l
+		}
+	}
+	return lines, nil
+}
+
+// headComment attaches the waiting comment lines to n.
+func (p *parser) headComment(n *yaml.Node) {
+	if len(p.comments) > 0 && n.HeadComment == "" {
+		n.HeadComment = strings.Join(p.comments, "\n")
+	}
+	p.comments = nil
+}
+
+// newline consumes a line ending, and reports whether there was one.
+func (p *parser) newline() bool {
+	switch {
+	case p.peek() == '\n':
+		p.advance(1)
+	case p.hasPrefix("\r\n"):
+		p.advance(2)
+	case p.peek() == '\r':
+		p.advance(1)
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+// peek returns the byte at the current position, or 0 at the end.
+func (p *parser) peek() byte {
+	return p.at(0)
+}
+
+// at returns the byte i bytes after the current position, or 0 past the end.
+func (p *parser) at(i int) byte {
+	if p.pos+i >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+i]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.src[p.pos:], []byte(s))
+}
+
+// advance moves n bytes ahead, keeping track of lines.
+func (p *parser) advance(n int) {
+	for ; n > 0 && !p.eof(); n-- {
+		if p.src[p.pos] == '\n' {
+			p.line++
+			p.lineStart = p.pos + 1
+		}
+		p.pos++
+	}
+}
+
+// column returns the 1-based column of the current position, in characters.
+func (p *parser) column() int {
+	return utf8.RuneCount(p.src[p.lineStart:p.pos]) + 1
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.line, Column: p.column(), Msg: fmt.Sprintf(format, args...)}
+}
+
+// isIdentifierRune reports whether r can be part of an unquoted key, or
+// start one if first is set.
+func isIdentifierRune(r rune, first bool) bool {
+	switch {
+	case r == '$', r == '_', unicode.IsLetter(r), unicode.Is(unicode.Nl, r):
+		return true
+	case first:
+		return false
+	default:
+		return unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Pc) || r == '\u200C' || r == '\u200D'
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isValueChar reports whether c can be part of a literal or number.
+func isValueChar(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || isDigit(c) || c == '+' || c == '-' || c == '.'
+}
+
+// dropComments removes the comments of the nodes inside n.
+func dropComments(n *yaml.Node) {
+	for _, c := range n.Content {
+		c.HeadComment, c.LineComment, c.FootComment = "", "", ""
+		dropComments(c)
+	}
+}
+
+// utf16High reports whether r is the first half of a UTF-16 surrogate pair.
+func utf16High(r rune) bool {
+	return 0xD800 <= r && r < 0xDC00
+}
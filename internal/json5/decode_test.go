@@ -0,0 +1,154 @@
+package json5
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// decodeYAML decodes src and returns it written as YAML.
+func decodeYAML(t *testing.T, src string) string {
+	t.Helper()
+	n, err := Decode([]byte(src))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	out, err := yaml.Marshal(n)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	return string(out)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "plain JSON",
+			src:  "{\n  \"s\": \"a\\tb\\u00e9\",\n  \"i\": -12,\n  \"f\": 1.50,\n  \"b\": true,\n  \"n\": null\n}\n",
+			want: "\"s\": \"a\\tbé\"\n\"i\": -12\n\"f\": 1.50\n\"b\": true\n\"n\": null\n",
+		},
+		{
+			name: "trailing commas",
+			src:  "{\n  \"a\": [1, 2,],\n  \"b\": {\"c\": 1,},\n}\n",
+			want: "\"a\": [1, 2]\n\"b\": {\"c\": 1}\n",
+		},
+		{
+			name: "JSON5 keys and strings",
+			src:  "{\n  plain: 'it\\'s',\n  $id: \"multi\\\n line\",\n  'quoted key': '\\x41\\ud83d\\ude00',\n}\n",
+			want: "plain: 'it''s'\n$id: \"multi line\"\n'quoted key': \"A\\U0001F600\"\n",
+		},
+		{
+			name: "JSON5 numbers",
+			src:  "{\n  hex: 0xFF,\n  neg: -0x10,\n  pos: +1,\n  lead: .5,\n  trail: 5.,\n  inf: -Infinity,\n  nan: NaN,\n  big: 12345678901234567890,\n}\n",
+			want: "hex: 255\nneg: -16\npos: 1\nlead: 0.5\ntrail: 5.0\ninf: -.inf\nnan: .nan\nbig: 1.2345678901234567e+19\n",
+		},
+		{
+			name: "strings that look like other types",
+			src:  "{a: \"true\", b: '1', c: ''}\n",
+			want: "{a: \"true\", b: '1', c: ''}\n",
+		},
+		{
+			name: "comments",
+			src:  "// Service settings\n{\n  /* Listen port */\n  port: 80, // http\n  tls: {\n    enabled: true,\n  }, // optional\n  hosts: [\n    // primary\n    \"a\",\n    \"b\", /* backup */\n  ],\n  // dropped\n}\n",
+			want: "# Service settings\n# Listen port\nport: 80 # http\ntls: # optional\n    enabled: true\nhosts:\n    # primary\n    - \"a\"\n    - \"b\" # backup\n",
+		},
+		{
+			name: "block comment lines",
+			src:  "{\n  /**\n   * Line one\n   *\n   * Line two\n   */\n  a: 1\n}\n",
+			want: "# Line one\n#\n# Line two\na: 1\n",
+		},
+		{
+			name: "comments inside flow collections are dropped",
+			src:  "{a: [1, /* one */ 2], b: {c: 1 /* c */}}\n",
+			want: "{a: [1, 2], b: {c: 1}}\n",
+		},
+		{
+			name: "scalar and array roots",
+			src:  "// Hosts\n[\"a\", 'b']\n",
+			want: "# Hosts\n[\"a\", 'b']\n",
+		},
+		{
+			name: "windows line endings and BOM",
+			src:  "\uFEFF{\r\n  a: 1, // one\r\n  b: 'x',\r\n}\r\n",
+			want: "a: 1 # one\nb: 'x'\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeYAML(t, tt.src); got != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_Empty(t *testing.T) {
+	for _, src := range []string{"", "  \n", "// nothing here\n/* at all */\n"} {
+		n, err := Decode([]byte(src))
+		if err != nil || n != nil {
+			t.Errorf("Decode(%q) = %v, %v, want nil, nil", src, n, err)
+		}
+	}
+}
+
+func TestDecode_Positions(t *testing.T) {
+	n, err := Decode([]byte("{\n  a: 1,\n  \"é\": \"x\",\n}\n"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	key, value := n.Content[2], n.Content[3]
+	if key.Line != 3 || key.Column != 3 || value.Line != 3 || value.Column != 8 {
+		t.Errorf("positions = %d:%d and %d:%d, want 3:3 and 3:8", key.Line, key.Column, value.Line, value.Column)
+	}
+	if n.Line != 1 || n.Column != 1 {
+		t.Errorf("object position = %d:%d, want 1:1", n.Line, n.Column)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+		col  int
+		want string
+	}{
+		{"duplicate key", "{\n  a: 1,\n  \"a\": 2\n}\n", 3, 3, `key "a" is already defined`},
+		{"missing colon", "{a 1}\n", 1, 4, "expected : after the key"},
+		{"missing value", "{a: }\n", 1, 5, "expected a value"},
+		{"missing comma", "{a: 1\n b: 2}\n", 2, 2, "expected , or } in the object"},
+		{"unclosed array", "[1, 2\n", 2, 1, "expected , or ] in the array"},
+		{"two commas", "[1,,2]\n", 1, 4, "expected a value"},
+		{"invalid key", "{1a: 1}\n", 1, 2, "expected a key"},
+		{"invalid value", "{a: yes}\n", 1, 5, "invalid value yes"},
+		{"leading zero", "[01]\n", 1, 2, "invalid value 01"},
+		{"unterminated string", "{a: \"x\n", 1, 7, "unterminated string"},
+		{"invalid escape", "['\\x4']\n", 1, 3, "invalid escape sequence"},
+		{"unterminated comment", "{a: 1 /* x\n}\n", 1, 7, "unterminated comment"},
+		{"trailing content", "{} {}\n", 1, 4, "expected the end of the document"},
+		{"integer range", "[0x8000000000000000]\n", 1, 2, "out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.src))
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Decode() error = %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.col {
+				t.Errorf("position = %d:%d, want %d:%d", syntaxErr.Line, syntaxErr.Column, tt.line, tt.col)
+			}
+			if !strings.Contains(syntaxErr.Msg, tt.want) {
+				t.Errorf("Msg = %q, want it to contain %q", syntaxErr.Msg, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Package packerr defines the typed errors reported while packing.
+//
+// Package fyaml re-exports these types so callers can retrieve them with
+// errors.As; they live here so the internal packages can return them.
+package packerr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+
+	"github.com/jksmth/fyaml/internal/json5"
+	"github.com/jksmth/fyaml/internal/toml"
+)
+
+// ParseError is a YAML/JSON, TOML or JSON5 syntax or type error in a source file.
+type ParseError struct {
+	File     string // Path of the file, as shown in messages
+	Line     int    // 1-based line, or 0 if unknown
+	Column   int    // 1-based column, or 0 if unknown
+	Msg      string // Description of the problem
+	Err      error  // Underlying parser error
+	Language string // "TOML", "JSON5", "JSONC" or "JSON", or "" for YAML/JSON
+}
+
+func (e *ParseError) Error() string {
+	lang := e.Language
+	if lang == "" {
+		lang = "YAML/JSON"
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s syntax error in %s:%d:%d: %s", lang, e.File, e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("failed to parse %s in %s: %s", lang, e.File, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// typeErrors reports all values of a file that could not be decoded. It
+// unwraps to one *ParseError per value.
+type typeErrors struct {
+	file string
+	errs []*ParseError
+}
+
+func (e *typeErrors) Error() string {
+	var lines []string
+	for _, pe := range e.errs {
+		if pe.Line > 0 && pe.Column > 0 {
+			lines = append(lines, fmt.Sprintf("  line %d:%d: %s", pe.Line, pe.Column, pe.Msg))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s", pe.Msg))
+		}
+	}
+	return fmt.Sprintf("YAML/JSON type errors in %s:\n%s", e.file, strings.Join(lines, "\n"))
+}
+
+func (e *typeErrors) Unwrap() []error {
+	errs := make([]error, len(e.errs))
+	for i, pe := range e.errs {
+		errs[i] = pe
+	}
+	return errs
+}
+
+// FromYAML converts an error from parsing or decoding file into a *ParseError,
+// or into an error wrapping one *ParseError per value for type errors.
+func FromYAML(err error, file string) error {
+	if err == nil {
+		return nil
+	}
+
+	// Check for ParserError (syntax errors)
+	var parserErr *yaml.ParserError
+	if errors.As(err, &parserErr) {
+		return &ParseError{File: file, Line: parserErr.Line, Column: parserErr.Column, Msg: parserErr.Message, Err: err}
+	}
+
+	// Check for TypeError (type conversion errors)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		te := &typeErrors{file: file}
+		for _, e := range typeErr.Errors {
+			te.errs = append(te.errs, &ParseError{File: file, Line: e.Line, Column: e.Column, Msg: e.Err.Error(), Err: e})
+		}
+		return te
+	}
+
+	// Fallback to generic error with file path
+	return &ParseError{File: file, Msg: err.Error(), Err: err}
+}
+
+// FromTOML converts a TOML parser error into a *ParseError for file.
+func FromTOML(err error, file string) error {
+	if err == nil {
+		return nil
+	}
+	var syntaxErr *toml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &ParseError{File: file, Line: syntaxErr.Line, Column: syntaxErr.Column, Msg: syntaxErr.Msg, Err: err, Language: "TOML"}
+	}
+	return &ParseError{File: file, Msg: err.Error(), Err: err, Language: "TOML"}
+}
+
+// FromJSON5 converts a JSON5 parser error into a *ParseError for file, read
+// as language: "JSON5", "JSONC", or "JSON" for relaxed .json files.
+func FromJSON5(err error, file, language string) error {
+	if err == nil {
+		return nil
+	}
+	var syntaxErr *json5.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &ParseError{File: file, Line: syntaxErr.Line, Column: syntaxErr.Column, Msg: syntaxErr.Msg, Err: err, Language: language}
+	}
+	return &ParseError{File: file, Msg: err.Error(), Err: err, Language: language}
+}
+
+// IncludeError is an include directive that could not be processed.
+type IncludeError struct {
+	File   string   // Pack file whose includes were being processed
+	Target string   // Include path that failed, as written
+	Chain  []string // Include paths followed from File to reach Target, outermost first
+	Err    error    // What went wrong
+}
+
+func (e *IncludeError) Error() string {
+	if len(e.Chain) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (included via %s)", e.Err, strings.Join(e.Chain, " -> "))
+}
+
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// StructureError is a file or directory whose content cannot be placed in the
+// document, such as a sequence where a map is required.
+type StructureError struct {
+	File    string   // Path of the file or directory, as shown in messages
+	KeyPath []string // Key path the content would be merged into
+	GotKind string   // Kind of the content: "sequence" or "scalar"
+
+	// MergesIntoParent is set for root files and @ files and directories,
+	// whose content is merged into their parent's map.
+	MergesIntoParent bool
+}
+
+func (e *StructureError) Error() string {
+	if e.MergesIntoParent {
+		return fmt.Sprintf("expected a map, got a `%s` in \"%s\", which merges into its parent map; only files named by their key can hold a %s", e.GotKind, e.File, e.GotKind)
+	}
+	return fmt.Sprintf("expected a map, got a `%s` which is not supported at this time for \"%s\"", e.GotKind, e.File)
+}
+
+// MultiDocumentError is a file holding more than one YAML document that the
+// multi-document policy in effect cannot pack.
+type MultiDocumentError struct {
+	File      string // Path of the file, as shown in messages
+	Line      int    // 1-based line of the document that could not be packed
+	Documents int    // Number of non-empty documents in the file
+	Reason    string // Why the documents cannot be packed
+}
+
+func (e *MultiDocumentError) Error() string {
+	return fmt.Sprintf("cannot pack the %d YAML documents in %s:%d: %s", e.Documents, e.File, e.Line, e.Reason)
+}
+
+// ConflictError is a key defined by two files under the strict merge strategy.
+type ConflictError struct {
+	KeyPath []string // Key path defined twice
+	First   string   // Location of the first definition, as "file" or "file:line:column"
+	Second  string   // Location of the conflicting definition
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting values for key %s in %s and %s", strings.Join(e.KeyPath, "."), e.First, e.Second)
+}
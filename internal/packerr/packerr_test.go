@@ -0,0 +1,138 @@
+package packerr
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+
+	"github.com/jksmth/fyaml/internal/json5"
+	"github.com/jksmth/fyaml/internal/toml"
+)
+
+func TestFromYAML_ParserError(t *testing.T) {
+	var v interface{}
+	err := FromYAML(yaml.Unmarshal([]byte("key: [unclosed"), &v), "config.yml")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("FromYAML() = %T, want *ParseError", err)
+	}
+	if parseErr.File != "config.yml" || parseErr.Line != 1 || parseErr.Column == 0 || parseErr.Msg == "" {
+		t.Errorf("ParseError = %+v, want file config.yml at line 1 with a column and message", parseErr)
+	}
+	var yamlErr *yaml.ParserError
+	if !errors.As(err, &yamlErr) {
+		t.Error("ParseError should unwrap to the *yaml.ParserError")
+	}
+	if want := "YAML/JSON syntax error in config.yml:1:"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Error() = %q, want prefix %q", err.Error(), want)
+	}
+}
+
+func TestFromTOML(t *testing.T) {
+	_, tomlErr := toml.Decode([]byte("a = 1\na = 2\n"))
+	err := FromTOML(tomlErr, "config.toml")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("FromTOML() = %T, want *ParseError", err)
+	}
+	if parseErr.Line != 2 || parseErr.Column != 1 || parseErr.Language != "TOML" {
+		t.Errorf("ParseError = %+v, want a TOML error at 2:1", parseErr)
+	}
+	if want := "TOML syntax error in config.toml:2:1: key a is already defined"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestFromJSON5(t *testing.T) {
+	_, jsonErr := json5.Decode([]byte("{\n  a: 1\n  b: 2\n}\n"))
+	err := FromJSON5(jsonErr, "config.jsonc", "JSONC")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("FromJSON5() = %T, want *ParseError", err)
+	}
+	if parseErr.Line != 3 || parseErr.Column != 3 || parseErr.Language != "JSONC" {
+		t.Errorf("ParseError = %+v, want a JSONC error at 3:3", parseErr)
+	}
+	if want := "JSONC syntax error in config.jsonc:3:3: expected , or } in the object"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestFromYAML_TypeError(t *testing.T) {
+	var v struct {
+		A int `yaml:"a"`
+		B int `yaml:"b"`
+	}
+	err := FromYAML(yaml.Unmarshal([]byte("a: one\nb: two\n"), &v), "config.yml")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("FromYAML() = %T, want to unwrap to *ParseError", err)
+	}
+	if parseErr.Line != 1 || parseErr.Column != 4 {
+		t.Errorf("first ParseError at %d:%d, want 1:4", parseErr.Line, parseErr.Column)
+	}
+
+	var all interface{ Unwrap() []error }
+	if !errors.As(err, &all) || len(all.Unwrap()) != 2 {
+		t.Errorf("FromYAML() should report one ParseError per value, got %v", err)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if lines[0] != "YAML/JSON type errors in config.yml:" || !strings.HasPrefix(lines[2], "  line 2:4: ") {
+		t.Errorf("Error() = %q, want one indented line per value", err.Error())
+	}
+}
+
+func TestFromYAML_Nil(t *testing.T) {
+	if err := FromYAML(nil, "config.yml"); err != nil {
+		t.Errorf("FromYAML(nil) = %v, want nil", err)
+	}
+}
+
+func TestIncludeError(t *testing.T) {
+	cause := errors.New("could not open missing.yml for inclusion")
+
+	err := &IncludeError{Target: "missing.yml", Err: cause}
+	if err.Error() != cause.Error() {
+		t.Errorf("Error() = %q, want %q", err.Error(), cause.Error())
+	}
+
+	err.Chain = []string{"a.yml", "b.yml"}
+	if want := cause.Error() + " (included via a.yml -> b.yml)"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("IncludeError should unwrap to its cause")
+	}
+}
+
+func TestStructureError(t *testing.T) {
+	err := &StructureError{File: "/pack/jobs/list.yml", KeyPath: []string{"jobs", "list"}, GotKind: "sequence"}
+	want := "expected a map, got a `sequence` which is not supported at this time for \"/pack/jobs/list.yml\""
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !reflect.DeepEqual(err.KeyPath, []string{"jobs", "list"}) {
+		t.Errorf("KeyPath = %v", err.KeyPath)
+	}
+
+	err = &StructureError{File: "/pack/jobs/@list.yml", KeyPath: []string{"jobs"}, GotKind: "scalar", MergesIntoParent: true}
+	want = "expected a map, got a `scalar` in \"/pack/jobs/@list.yml\", which merges into its parent map; only files named by their key can hold a scalar"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestMultiDocumentError(t *testing.T) {
+	err := &MultiDocumentError{File: "/pack/jobs/build.yml", Line: 4, Documents: 2, Reason: "document 2 is a scalar, and only maps can be merged"}
+	want := "cannot pack the 2 YAML documents in /pack/jobs/build.yml:4: document 2 is a scalar, and only maps can be merged"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,752 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// decode.go contains the TOML 1.0 parser for .toml source files.
+
+// SyntaxError is invalid TOML in a source file.
+type SyntaxError struct {
+	Line   int    // 1-based line
+	Column int    // 1-based column
+	Msg    string // Description of the problem
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+var (
+	decIntRe      = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	prefixedIntRe = regexp.MustCompile(`^(0x[0-9A-Fa-f](_?[0-9A-Fa-f])*|0o[0-7](_?[0-7])*|0b[01](_?[01])*)$`)
+	floatRe       = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+	specialRe     = regexp.MustCompile(`^[+-]?(inf|nan)$`)
+	dateTimeRe    = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2})[Tt ]([0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?)([Zz]|[+-][0-9]{2}:[0-9]{2})?$`)
+	dateRe        = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`)
+	timeRe        = regexp.MustCompile(`^[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?$`)
+)
+
+// Decode parses the TOML document src into a mapping node, the root of a
+// YAML document with the same content. Nodes carry the line and column of
+// their TOML source, keys keep the order in which they first appear, and
+// comments before a key or table header, or after it on the same line, are
+// kept on its nodes. Other comments are dropped.
+//
+// TOML types map to YAML tags: offset and local date-times and local dates
+// become !!timestamp, and local times, which YAML has no type for, !!str.
+// Strings spanning lines use the literal style, and arrays and inline tables
+// written on one line the flow style. Decode fails with a *SyntaxError.
+func Decode(src []byte) (*yaml.Node, error) {
+	if !utf8.Valid(src) {
+		return nil, &SyntaxError{Line: 1, Column: 1, Msg: "document is not valid UTF-8"}
+	}
+	p := &parser{src: src, line: 1}
+	if bytes.HasPrefix(src, []byte("\uFEFF")) {
+		p.pos, p.lineStart = 3, 3
+	}
+	p.root = newTable(nil, 1, 1)
+	p.current = p.root
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.root.node, nil
+}
+
+// table is a TOML table being parsed.
+type table struct {
+	node     *yaml.Node // Mapping node holding the table's keys
+	path     []string   // Key path from the root, for messages
+	children map[string]*child
+	header   bool // Defined by its own [header]
+	dotted   bool // Defined by dotted keys, such as a in a.b = 1
+}
+
+// child is a key of a table.
+type child struct {
+	key    *yaml.Node
+	table  *table     // Subtable, or the last table of an array of tables
+	tables *yaml.Node // Sequence node of an array of tables
+}
+
+func newTable(path []string, line, col int) *table {
+	return &table{
+		node:     &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: col},
+		path:     path,
+		children: map[string]*child{},
+	}
+}
+
+// add appends the key k with value to t.
+func (t *table) add(k keyPart, value *yaml.Node, c *child) {
+	c.key = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k.name, Line: k.line, Column: k.col}
+	t.node.Content = append(t.node.Content, c.key, value)
+	t.children[k.name] = c
+}
+
+// keyPart is one part of a possibly dotted key, with its position.
+type keyPart struct {
+	name      string
+	line, col int
+}
+
+type parser struct {
+	src       []byte
+	pos       int
+	line      int // Line of pos, 1-based
+	lineStart int // Offset of the start of the line
+	root      *table
+	current   *table   // Table that key/value pairs are added to
+	comments  []string // Comment lines waiting for the next key or header
+}
+
+func (p *parser) parse() error {
+	for {
+		p.skipSpace()
+		switch {
+		case p.eof():
+			return nil
+		case p.newline():
+		case p.peek() == '#':
+			comment, err := p.comment()
+			if err != nil {
+				return err
+			}
+			p.comments = append(p.comments, comment)
+		case p.peek() == '[':
+			if err := p.header(); err != nil {
+				return err
+			}
+		default:
+			key, value, err := p.keyValue(p.current)
+			if err != nil {
+				return err
+			}
+			comment, err := p.endOfLine()
+			if err != nil {
+				return err
+			}
+			p.headComment(key)
+			if comment != "" {
+				if value.Kind == yaml.ScalarNode || value.Style == yaml.FlowStyle {
+					value.LineComment = comment
+				} else {
+					key.LineComment = comment
+				}
+			}
+		}
+	}
+}
+
+// headComment attaches the waiting comment lines to n.
+func (p *parser) headComment(n *yaml.Node) {
+	if len(p.comments) > 0 && n.HeadComment == "" {
+		n.HeadComment = strings.Join(p.comments, "\n")
+	}
+	p.comments = nil
+}
+
+// header parses a [table] or [[array of tables]] header, and makes its table
+// the current one.
+func (p *parser) header() error {
+	line, col := p.line, p.column()
+	array := p.hasPrefix("[[")
+	if array {
+		p.advance(2)
+	} else {
+		p.advance(1)
+	}
+	p.skipSpace()
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if array {
+		if !p.hasPrefix("]]") {
+			return p.errorf("expected ]] after the table name")
+		}
+		p.advance(2)
+	} else {
+		if p.peek() != ']' {
+			return p.errorf("expected ] after the table name")
+		}
+		p.advance(1)
+	}
+	comment, err := p.endOfLine()
+	if err != nil {
+		return err
+	}
+
+	t := p.root
+	for _, k := range keys[:len(keys)-1] {
+		c := t.children[k.name]
+		switch {
+		case c == nil:
+			sub := newTable(appendPath(t.path, k.name), k.line, k.col)
+			t.add(k, sub.node, &child{table: sub})
+			t = sub
+		case c.table != nil:
+			t = c.table
+		default:
+			return keyError(k, "key %s is already defined as a value", appendPath(t.path, k.name))
+		}
+	}
+
+	last := keys[len(keys)-1]
+	path := appendPath(t.path, last.name)
+	c := t.children[last.name]
+	if array {
+		if c == nil {
+			c = &child{tables: &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line, Column: col}}
+			t.add(last, c.tables, c)
+		} else if c.tables == nil {
+			return keyError(last, "key %s is already defined", path)
+		}
+		elem := newTable(path, line, col)
+		elem.header = true
+		if len(c.tables.Content) > 0 {
+			// Later tables of the array keep their comments on the table itself
+			p.headComment(elem.node)
+		}
+		c.tables.Content = append(c.tables.Content, elem.node)
+		c.table = elem
+	} else {
+		if c == nil {
+			c = &child{table: newTable(path, line, col)}
+			t.add(last, c.table.node, c)
+		} else if c.table == nil || c.tables != nil || c.table.header || c.table.dotted {
+			return keyError(last, "table %s is already defined", path)
+		}
+		c.table.header = true
+	}
+
+	p.headComment(c.key)
+	if comment != "" && c.key.LineComment == "" {
+		c.key.LineComment = comment
+	}
+	p.current = c.table
+	return nil
+}
+
+// keyValue parses a key/value pair and adds it to t, creating the tables
+// named by a dotted key. It returns the nodes of the last key and the value.
+func (p *parser) keyValue(t *table) (*yaml.Node, *yaml.Node, error) {
+	keys, err := p.key()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.peek() != '=' {
+		return nil, nil, p.errorf("expected = after the key")
+	}
+	p.advance(1)
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, k := range keys[:len(keys)-1] {
+		c := t.children[k.name]
+		if c == nil {
+			sub := newTable(appendPath(t.path, k.name), k.line, k.col)
+			sub.dotted = true
+			t.add(k, sub.node, &child{table: sub})
+			t = sub
+			continue
+		}
+		if c.table == nil || c.tables != nil || !c.table.dotted {
+			return nil, nil, keyError(k, "key %s is already defined", appendPath(t.path, k.name))
+		}
+		t = c.table
+	}
+
+	last := keys[len(keys)-1]
+	if t.children[last.name] != nil {
+		return nil, nil, keyError(last, "key %s is already defined", appendPath(t.path, last.name))
+	}
+	c := &child{}
+	t.add(last, value, c)
+	return c.key, value, nil
+}
+
+// key parses a possibly dotted key and the space after it.
+func (p *parser) key() ([]keyPart, error) {
+	var keys []keyPart
+	for {
+		k := keyPart{line: p.line, col: p.column()}
+		switch c := p.peek(); {
+		case p.hasPrefix(`"""`), p.hasPrefix("'''"):
+			return nil, p.errorf("a key cannot be a multi-line string")
+		case c == '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			k.name = s
+		case c == '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			k.name = s
+		case isBare(c):
+			start := p.pos
+			for isBare(p.peek()) {
+				p.advance(1)
+			}
+			k.name = string(p.src[start:p.pos])
+		default:
+			return nil, p.errorf("expected a key")
+		}
+		keys = append(keys, k)
+
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.advance(1)
+		p.skipSpace()
+	}
+}
+
+// value parses a value.
+func (p *parser) value() (*yaml.Node, error) {
+	line, col := p.line, p.column()
+	scalar := func(tag, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: line, Column: col}
+	}
+
+	var s string
+	var err error
+	switch c := p.peek(); {
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	case p.hasPrefix(`"""`):
+		s, err = p.multilineString(`"""`)
+	case c == '"':
+		s, err = p.basicString()
+	case p.hasPrefix("'''"):
+		s, err = p.multilineString("'''")
+	case c == '\'':
+		s, err = p.literalString()
+	default:
+		return p.bareValue(scalar)
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := scalar("!!str", s)
+	if strings.Contains(s, "\n") {
+		n.Style = yaml.LiteralStyle
+	}
+	return n, nil
+}
+
+// bareValue parses a boolean, number or date-time.
+func (p *parser) bareValue(scalar func(tag, value string) *yaml.Node) (*yaml.Node, error) {
+	start, line, col := p.pos, p.line, p.column()
+	for isValueChar(p.peek()) {
+		p.advance(1)
+	}
+	// A date and a time may be separated by a space
+	if dateRe.Match(p.src[start:p.pos]) && p.pos+3 < len(p.src) && p.src[p.pos] == ' ' &&
+		isDigit(p.src[p.pos+1]) && isDigit(p.src[p.pos+2]) && p.src[p.pos+3] == ':' {
+		p.advance(1)
+		for isValueChar(p.peek()) {
+			p.advance(1)
+		}
+	}
+	tok := string(p.src[start:p.pos])
+	invalid := func(msg string) error {
+		return &SyntaxError{Line: line, Column: col, Msg: msg}
+	}
+
+	switch {
+	case tok == "":
+		return nil, invalid("expected a value")
+	case tok == "true", tok == "false":
+		return scalar("!!bool", tok), nil
+
+	case decIntRe.MatchString(tok), prefixedIntRe.MatchString(tok):
+		i, err := strconv.ParseInt(strings.ReplaceAll(tok, "_", ""), 0, 64)
+		if err != nil {
+			return nil, invalid(fmt.Sprintf("integer %s is out of range", tok))
+		}
+		return scalar("!!int", strconv.FormatInt(i, 10)), nil
+
+	case specialRe.MatchString(tok):
+		value := ".nan"
+		if strings.HasSuffix(tok, "inf") {
+			value = strings.TrimPrefix(strings.Replace(tok, "inf", ".inf", 1), "+")
+		}
+		return scalar("!!float", value), nil
+
+	case floatRe.MatchString(tok):
+		f, err := strconv.ParseFloat(strings.ReplaceAll(tok, "_", ""), 64)
+		if err != nil {
+			return nil, invalid(fmt.Sprintf("float %s is out of range", tok))
+		}
+		value := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(value, ".e") {
+			value += ".0"
+		}
+		return scalar("!!float", value), nil
+
+	case dateTimeRe.MatchString(tok):
+		m := dateTimeRe.FindStringSubmatch(tok)
+		if m[4] == "" {
+			if _, err := time.Parse("2006-01-02T15:04:05.999999999", m[1]+"T"+m[2]); err != nil {
+				return nil, invalid(fmt.Sprintf("invalid date-time %s", tok))
+			}
+			return scalar("!!timestamp", m[1]+" "+m[2]), nil
+		}
+		value := m[1] + "T" + m[2] + strings.ToUpper(m[4])
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			return nil, invalid(fmt.Sprintf("invalid date-time %s", tok))
+		}
+		return scalar("!!timestamp", value), nil
+
+	case dateRe.MatchString(tok):
+		if _, err := time.Parse(time.DateOnly, tok); err != nil {
+			return nil, invalid(fmt.Sprintf("invalid date %s", tok))
+		}
+		return scalar("!!timestamp", tok), nil
+
+	case timeRe.MatchString(tok):
+		if _, err := time.Parse("15:04:05.999999999", tok); err != nil {
+			return nil, invalid(fmt.Sprintf("invalid time %s", tok))
+		}
+		return scalar("!!str", tok), nil
+
+	default:
+		return nil, invalid(fmt.Sprintf("invalid value %s", tok))
+	}
+}
+
+// array parses an array, which may span lines and hold comments.
+func (p *parser) array() (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: p.line, Column: p.column()}
+	p.advance(1)
+	for {
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if p.peek() == ']' {
+			break
+		}
+		elem, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, elem)
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if p.peek() == ',' {
+			p.advance(1)
+			continue
+		}
+		if p.peek() != ']' {
+			return nil, p.errorf("expected , or ] in the array")
+		}
+		break
+	}
+	p.advance(1)
+	if n.Line == p.line {
+		n.Style = yaml.FlowStyle
+	}
+	return n, nil
+}
+
+// inlineTable parses an inline table, which must fit on one line.
+func (p *parser) inlineTable() (*yaml.Node, error) {
+	t := newTable(nil, p.line, p.column())
+	t.node.Style = yaml.FlowStyle
+	p.advance(1)
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.advance(1)
+		return t.node, nil
+	}
+	for {
+		p.skipSpace()
+		if _, _, err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.advance(1)
+		case '}':
+			p.advance(1)
+			return t.node, nil
+		default:
+			return nil, p.errorf("expected , or } in the inline table")
+		}
+	}
+}
+
+// basicString parses a "basic string".
+func (p *parser) basicString() (string, error) {
+	p.advance(1)
+	var b strings.Builder
+	for {
+		switch c := p.peek(); {
+		case p.eof(), c == '\n', c == '\r':
+			return "", p.errorf("unterminated string")
+		case c == '"':
+			p.advance(1)
+			return b.String(), nil
+		case c == '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			if err := p.char(&b); err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// literalString parses a 'literal string'.
+func (p *parser) literalString() (string, error) {
+	p.advance(1)
+	var b strings.Builder
+	for {
+		switch c := p.peek(); {
+		case p.eof(), c == '\n', c == '\r':
+			return "", p.errorf("unterminated string")
+		case c == '\'':
+			p.advance(1)
+			return b.String(), nil
+		default:
+			if err := p.char(&b); err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// multilineString parses a multi-line basic or literal string, delimited by
+// delim. Escapes are only processed in basic strings.
+func (p *parser) multilineString(delim string) (string, error) {
+	p.advance(3)
+	// A newline right after the opening delimiter is not part of the string
+	p.newline()
+	var b strings.Builder
+	for {
+		switch c := p.peek(); {
+		case p.eof():
+			return "", p.errorf("unterminated string")
+		case p.hasPrefix(delim):
+			// Up to two quotes may end the string right before the delimiter
+			n := 3
+			for n < 6 && p.pos+n < len(p.src) && p.src[p.pos+n] == delim[0] {
+				n++
+			}
+			if n > 5 {
+				return "", p.errorf("too many quotes at the end of the string")
+			}
+			b.WriteString(strings.Repeat(delim[:1], n-3))
+			p.advance(n)
+			return b.String(), nil
+		case p.newline():
+			b.WriteByte('\n')
+		case c == '\\' && delim == `"""`:
+			if p.lineEndingBackslash() {
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			if err := p.char(&b); err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// lineEndingBackslash consumes a backslash that ends a line in a multi-line
+// basic string, with all the whitespace and newlines after it.
+func (p *parser) lineEndingBackslash() bool {
+	i := p.pos + 1
+	for i < len(p.src) && (p.src[i] == ' ' || p.src[i] == '\t') {
+		i++
+	}
+	if !bytes.HasPrefix(p.src[i:], []byte("\n")) && !bytes.HasPrefix(p.src[i:], []byte("\r\n")) {
+		return false
+	}
+	p.advance(i - p.pos)
+	for p.peek() == ' ' || p.peek() == '\t' || p.newline() {
+		p.skipSpace()
+	}
+	return true
+}
+
+// escape parses an escape sequence in a basic string and writes its character to b.
+func (p *parser) escape(b *strings.Builder) error {
+	line, col := p.line, p.column()
+	p.advance(1)
+	c := p.peek()
+	simple := map[byte]byte{'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', '"': '"', '\\': '\\'}
+	if r, ok := simple[c]; ok {
+		b.WriteByte(r)
+		p.advance(1)
+		return nil
+	}
+
+	digits := map[byte]int{'u': 4, 'U': 8}[c]
+	if digits == 0 || p.pos+1+digits > len(p.src) {
+		return &SyntaxError{Line: line, Column: col, Msg: "invalid escape sequence"}
+	}
+	hex := string(p.src[p.pos+1 : p.pos+1+digits])
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return &SyntaxError{Line: line, Column: col, Msg: fmt.Sprintf("invalid escape sequence \\%c%s", c, hex)}
+	}
+	b.WriteRune(rune(code))
+	p.advance(1 + digits)
+	return nil
+}
+
+// char writes the character at the current position to b, rejecting
+// control characters other than tab.
+func (p *parser) char(b *strings.Builder) error {
+	r, size := utf8.DecodeRune(p.src[p.pos:])
+	if (r < 0x20 && r != '\t') || r == 0x7f {
+		return p.errorf("control character %U in string", r)
+	}
+	b.WriteRune(r)
+	p.advance(size)
+	return nil
+}
+
+// comment consumes a comment up to the end of the line and returns it.
+func (p *parser) comment() (string, error) {
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' && !p.hasPrefix("\r\n") {
+		if c := p.peek(); (c < 0x20 && c != '\t') || c == 0x7f {
+			return "", p.errorf("control character %U in comment", rune(c))
+		}
+		p.advance(1)
+	}
+	return string(p.src[start:p.pos]), nil
+}
+
+// endOfLine consumes the rest of a line holding a key/value pair or header,
+// and returns its comment, if any.
+func (p *parser) endOfLine() (string, error) {
+	p.skipSpace()
+	var comment string
+	if p.peek() == '#' {
+		var err error
+		if comment, err = p.comment(); err != nil {
+			return "", err
+		}
+	}
+	if !p.eof() && !p.newline() {
+		return "", p.errorf("expected the end of the line")
+	}
+	return comment, nil
+}
+
+// skipBlank skips whitespace, newlines and comments inside an array.
+func (p *parser) skipBlank() error {
+	for {
+		p.skipSpace()
+		switch {
+		case p.newline():
+		case p.peek() == '#':
+			if _, err := p.comment(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *parser) skipSpace() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.advance(1)
+	}
+}
+
+// newline consumes a line ending, and reports whether there was one.
+func (p *parser) newline() bool {
+	switch {
+	case p.peek() == '\n':
+		p.advance(1)
+	case p.hasPrefix("\r\n"):
+		p.advance(2)
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+// peek returns the byte at the current position, or 0 at the end.
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.src[p.pos:], []byte(s))
+}
+
+// advance moves n bytes ahead, keeping track of lines.
+func (p *parser) advance(n int) {
+	for ; n > 0 && !p.eof(); n-- {
+		if p.src[p.pos] == '\n' {
+			p.line++
+			p.lineStart = p.pos + 1
+		}
+		p.pos++
+	}
+}
+
+// column returns the 1-based column of the current position, in characters.
+func (p *parser) column() int {
+	return utf8.RuneCount(p.src[p.lineStart:p.pos]) + 1
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: p.line, Column: p.column(), Msg: fmt.Sprintf(format, args...)}
+}
+
+// keyError returns a *SyntaxError at the key k about the key path.
+func keyError(k keyPart, format string, path []string) error {
+	return &SyntaxError{Line: k.line, Column: k.col, Msg: fmt.Sprintf(format, strings.Join(path, "."))}
+}
+
+func isBare(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || isDigit(c) || c == '_' || c == '-'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isValueChar reports whether c can be part of a boolean, number or date-time.
+func isValueChar(c byte) bool {
+	return isBare(c) || c == '+' || c == '.' || c == ':'
+}
@@ -0,0 +1,180 @@
+package toml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// decodeYAML decodes src and returns it written as YAML.
+func decodeYAML(t *testing.T, src string) string {
+	t.Helper()
+	n, err := Decode([]byte(src))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	out, err := yaml.Marshal(n)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	return string(out)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "scalars",
+			src:  "s = \"a\\tb\\u00e9\"\nl = 'C:\\path'\ni = 1_000\nh = 0xff\no = 0o17\nb = 0b101\nf = 6.02e23\ng = 3_1.5\nw = 1e2\nn = -inf\nt = true\n",
+			want: "s: \"a\\tbé\"\nl: C:\\path\ni: 1000\nh: 255\no: 15\nb: 5\nf: 6.02e+23\ng: 31.5\nw: 100.0\nn: -.inf\nt: true\n",
+		},
+		{
+			name: "strings that look like other types",
+			src:  "a = \"true\"\nb = \"1\"\nc = \"\"\n",
+			want: "a: \"true\"\nb: \"1\"\nc: \"\"\n",
+		},
+		{
+			name: "date-times",
+			src:  "odt = 1979-05-27T07:32:00-08:00\nutc = 1979-05-27 07:32:00z\nldt = 1979-05-27T07:32:00.5\nld = 1979-05-27\nlt = 07:32:00\n",
+			want: "odt: 1979-05-27T07:32:00-08:00\nutc: 1979-05-27T07:32:00Z\nldt: 1979-05-27 07:32:00.5\nld: 1979-05-27\nlt: 07:32:00\n",
+		},
+		{
+			name: "multi-line strings",
+			src:  "a = \"\"\"\nline1\\\n   still1\nline2\"\"\"\"\nb = '''\nraw \\n\n'''\n",
+			want: "a: |-\n    line1still1\n    line2\"\nb: |\n    raw \\n\n",
+		},
+		{
+			name: "tables keep their order",
+			src:  "title = \"x\"\n[servers.beta]\nip = \"b\"\n[servers.alpha]\nip = \"a\"\n[db]\nport = 1\n",
+			want: "title: x\nservers:\n    beta:\n        ip: b\n    alpha:\n        ip: a\ndb:\n    port: 1\n",
+		},
+		{
+			name: "dotted keys",
+			src:  "a.b = 1\na . \"c.d\" = 2\n[x]\ny.z = 3\n[a.e]\nf = 4\n",
+			want: "a:\n    b: 1\n    c.d: 2\n    e:\n        f: 4\nx:\n    y:\n        z: 3\n",
+		},
+		{
+			name: "implicit table defined later",
+			src:  "[a.b]\nc = 1\n[a]\nd = 2\n",
+			want: "a:\n    b:\n        c: 1\n    d: 2\n",
+		},
+		{
+			name: "arrays",
+			src:  "a = [1, 2]\nb = [\n  \"x\", # first\n  \"y\",\n]\nc = [[1], [\"z\"]]\nd = []\n",
+			want: "a: [1, 2]\nb:\n    - x\n    - y\nc: [[1], [z]]\nd: []\n",
+		},
+		{
+			name: "inline tables",
+			src:  "p = { x = 1, y.z = 2 }\ne = {}\n",
+			want: "p: {x: 1, y: {z: 2}}\ne: {}\n",
+		},
+		{
+			name: "arrays of tables",
+			src:  "[[fruit]]\nname = \"apple\"\n[fruit.physical]\ncolor = \"red\"\n[[fruit.variety]]\nname = \"fuji\"\n[[fruit]]\nname = \"banana\"\n",
+			want: "fruit:\n    - name: apple\n      physical:\n        color: red\n      variety:\n        - name: fuji\n    - name: banana\n",
+		},
+		{
+			name: "comments",
+			src:  "# Service settings\n[service] # main\n# Listen port\nport = 80 # http\n",
+			want: "# Service settings\nservice: # main\n    # Listen port\n    port: 80 # http\n",
+		},
+		{
+			name: "empty",
+			src:  "# nothing here\n",
+			want: "{}\n",
+		},
+		{
+			name: "windows line endings and BOM",
+			src:  "\uFEFFa = 1\r\n[b]\r\nc = \"\"\"\r\nx\r\n\"\"\"\r\n",
+			want: "a: 1\nb:\n    c: |\n        x\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeYAML(t, tt.src); got != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_Positions(t *testing.T) {
+	n, err := Decode([]byte("a = 1\n[t]\n  \"é\" = \"x\"\n"))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	tbl := n.Content[3]
+	key, value := tbl.Content[0], tbl.Content[1]
+	if key.Line != 3 || key.Column != 3 || value.Line != 3 || value.Column != 9 {
+		t.Errorf("positions = %d:%d and %d:%d, want 3:3 and 3:9", key.Line, key.Column, value.Line, value.Column)
+	}
+	if tbl.Line != 2 || tbl.Column != 1 {
+		t.Errorf("table position = %d:%d, want 2:1", tbl.Line, tbl.Column)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+		col  int
+		want string
+	}{
+		{"duplicate key", "a = 1\na = 2\n", 2, 1, "key a is already defined"},
+		{"duplicate table", "[a]\n[a]\n", 2, 2, "table a is already defined"},
+		{"table over dotted keys", "a.b = 1\n[a]\n", 2, 2, "table a is already defined"},
+		{"extend inline table", "a = {b = 1}\n[a.c]\n", 2, 2, "key a is already defined as a value"},
+		{"array of tables over array", "a = [1]\n[[a]]\n", 2, 3, "key a is already defined"},
+		{"dotted key over value", "[t]\na = 1\na.b = 2\n", 3, 1, "key t.a is already defined"},
+		{"missing value", "a =\n", 1, 4, "expected a value"},
+		{"missing equals", "a 1\n", 1, 3, "expected = after the key"},
+		{"invalid value", "a = yes\n", 1, 5, "invalid value yes"},
+		{"leading zero", "a = 01\n", 1, 5, "invalid value 01"},
+		{"invalid date", "a = 2024-02-30\n", 1, 5, "invalid date 2024-02-30"},
+		{"unterminated string", "a = \"x\n", 1, 7, "unterminated string"},
+		{"invalid escape", "a = \"\\x\"\n", 1, 6, "invalid escape sequence"},
+		{"two values on a line", "a = 1 b = 2\n", 1, 7, "expected the end of the line"},
+		{"unclosed array", "a = [1\n", 2, 1, "expected , or ] in the array"},
+		{"newline in inline table", "a = {b = 1,\nc = 2}\n", 1, 12, "expected a key"},
+		{"unclosed header", "[a\n", 1, 3, "expected ] after the table name"},
+		{"integer range", "a = 9223372036854775808\n", 1, 5, "out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.src))
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Decode() error = %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.col {
+				t.Errorf("position = %d:%d, want %d:%d", syntaxErr.Line, syntaxErr.Column, tt.line, tt.col)
+			}
+			if !strings.Contains(syntaxErr.Msg, tt.want) {
+				t.Errorf("Msg = %q, want it to contain %q", syntaxErr.Msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode_RoundTrip(t *testing.T) {
+	src := "name = \"web\"\nports = [80, 443]\n\n[tls]\nenabled = true\n\n[[routes]]\npath = \"/\"\n\n[[routes]]\npath = \"/api\"\n"
+	n, err := Decode([]byte(src))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	got, err := Encode(n)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if string(got) != src {
+		t.Errorf("Encode(Decode()) = %q, want %q", got, src)
+	}
+}
@@ -0,0 +1,426 @@
+// Package toml converts between TOML documents and yaml.Node trees for FYAML
+// packing.
+//
+// Only what packing needs is implemented: Decode reads .toml source files into
+// the node model YAML files are read into, and Encode writes a packed
+// document as TOML output. Key order is taken from the mapping nodes, so
+// callers decide whether it is sorted or authored.
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Error is content that cannot be written as TOML.
+type Error struct {
+	Path []string // Key path of the value, with sequence indexes; empty for the root
+	Msg  string   // Description of the problem
+}
+
+func (e *Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s at %s", e.Msg, strings.Join(e.Path, "."))
+}
+
+// bareKeyRe matches the keys TOML allows without quotes.
+var bareKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Encode writes the document rooted at n as TOML. Within each table, the
+// key/value pairs come first and the subtables after them, as TOML requires;
+// each group keeps the order of n. A mapping holding only maps has no header
+// of its own. A nil or empty document encodes as nothing.
+//
+// Encode fails with an *Error for content TOML cannot hold: null values,
+// arrays mixing value types, and a root that is not a map.
+func Encode(n *yaml.Node) ([]byte, error) {
+	n = resolve(n)
+	if n != nil && n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		n = resolve(n.Content[0])
+	}
+	if n == nil {
+		return nil, nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil, &Error{Msg: fmt.Sprintf("the root is a %s, and a TOML document must be a table", kindName(n))}
+	}
+
+	e := &encoder{}
+	if err := e.table(nil, n, false); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+// entry is a key and its value in a table.
+type entry struct {
+	key   string
+	value *yaml.Node
+}
+
+// table writes the table at path: a header, unless path is the root, then its
+// key/value pairs, then its subtables. item marks an element of an array of
+// tables, which always has a header.
+func (e *encoder) table(path []string, n *yaml.Node, item bool) error {
+	entries, err := tableEntries(path, n)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	var tables []entry
+	for _, en := range entries {
+		if en.value.Kind == yaml.MappingNode || arrayOfTables(en.value) {
+			tables = append(tables, en)
+			continue
+		}
+		text, _, err := inline(appendPath(path, en.key), en.value)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, quoteKey(en.key)+" = "+text)
+	}
+
+	if len(path) > 0 && (item || len(lines) > 0 || len(tables) == 0) {
+		if e.buf.Len() > 0 {
+			e.buf.WriteByte('\n')
+		}
+		header := make([]string, len(path))
+		for i, key := range path {
+			header[i] = quoteKey(key)
+		}
+		if item {
+			fmt.Fprintf(&e.buf, "[[%s]]\n", strings.Join(header, "."))
+		} else {
+			fmt.Fprintf(&e.buf, "[%s]\n", strings.Join(header, "."))
+		}
+	}
+	for _, line := range lines {
+		e.buf.WriteString(line)
+		e.buf.WriteByte('\n')
+	}
+
+	for _, en := range tables {
+		p := appendPath(path, en.key)
+		if en.value.Kind == yaml.MappingNode {
+			if err := e.table(p, en.value, false); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, elem := range en.value.Content {
+			if err := e.table(p, resolve(elem), true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tableEntries returns the entries of the mapping n in order, with aliases
+// resolved and merge keys (<<) replaced by the entries they merge.
+func tableEntries(path []string, n *yaml.Node) ([]entry, error) {
+	explicit := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !isMergeKey(n.Content[i]) {
+			explicit[n.Content[i].Value] = true
+		}
+	}
+
+	var entries []entry
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], resolve(n.Content[i+1])
+		if !isMergeKey(k) {
+			if k.Kind != yaml.ScalarNode {
+				return nil, &Error{Path: path, Msg: fmt.Sprintf("a %s key cannot be a TOML key", kindName(k))}
+			}
+			entries = append(entries, entry{k.Value, v})
+			seen[k.Value] = true
+			continue
+		}
+
+		// Earlier maps in a merge sequence take precedence, and explicit keys over all
+		sources := []*yaml.Node{v}
+		if v.Kind == yaml.SequenceNode {
+			sources = v.Content
+		}
+		for _, src := range sources {
+			src = resolve(src)
+			if src.Kind != yaml.MappingNode {
+				return nil, &Error{Path: path, Msg: fmt.Sprintf("a merge key holds a %s, not a map", kindName(src))}
+			}
+			merged, err := tableEntries(path, src)
+			if err != nil {
+				return nil, err
+			}
+			for _, en := range merged {
+				if !explicit[en.key] && !seen[en.key] {
+					entries = append(entries, en)
+					seen[en.key] = true
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+// inline returns the TOML text of n as an inline value, and its TOML type.
+func inline(path []string, n *yaml.Node) (string, string, error) {
+	n = resolve(n)
+	switch n.Kind {
+	case yaml.MappingNode:
+		entries, err := tableEntries(path, n)
+		if err != nil {
+			return "", "", err
+		}
+		if len(entries) == 0 {
+			return "{}", "table", nil
+		}
+		parts := make([]string, len(entries))
+		for i, en := range entries {
+			text, _, err := inline(appendPath(path, en.key), en.value)
+			if err != nil {
+				return "", "", err
+			}
+			parts[i] = quoteKey(en.key) + " = " + text
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", "table", nil
+
+	case yaml.SequenceNode:
+		parts := make([]string, len(n.Content))
+		kinds := make([]string, len(n.Content))
+		for i, elem := range n.Content {
+			text, kind, err := inline(appendPath(path, strconv.Itoa(i)), elem)
+			if err != nil {
+				return "", "", err
+			}
+			parts[i], kinds[i] = text, kind
+		}
+		if err := sameKind(path, kinds); err != nil {
+			return "", "", err
+		}
+		return "[" + strings.Join(parts, ", ") + "]", "array", nil
+
+	default:
+		return scalar(path, n)
+	}
+}
+
+// sameKind checks that the array items of the given kinds all have the same
+// TOML type. Integers and floats are different types, so 1 is not widened to
+// 1.0 to join floats.
+func sameKind(path []string, kinds []string) error {
+	for _, kind := range kinds {
+		if kind != kinds[0] {
+			return &Error{Path: path, Msg: fmt.Sprintf("array mixes %s and %s values", kinds[0], kind)}
+		}
+	}
+	return nil
+}
+
+// scalar returns the TOML text of the scalar n, and its TOML type.
+func scalar(path []string, n *yaml.Node) (string, string, error) {
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return "", "", &Error{Path: path, Msg: err.Error()}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return "", "", &Error{Path: path, Msg: "null value"}
+	case bool:
+		return strconv.FormatBool(v), "boolean", nil
+	case int:
+		return strconv.Itoa(v), "integer", nil
+	case int64:
+		return strconv.FormatInt(v, 10), "integer", nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return "", "", &Error{Path: path, Msg: fmt.Sprintf("integer %d is larger than TOML allows", v)}
+		}
+		return strconv.FormatUint(v, 10), "integer", nil
+	case float64:
+		return formatFloat(v), "float", nil
+	case string:
+		return quote(v, true), "string", nil
+	case time.Time:
+		switch {
+		case !strings.ContainsAny(n.Value, "tT "):
+			return v.Format(time.DateOnly), "datetime", nil
+		case !hasZone(n.Value):
+			return v.Format(localDateTime), "datetime", nil
+		}
+		return v.Format(time.RFC3339Nano), "datetime", nil
+	default:
+		return "", "", &Error{Path: path, Msg: fmt.Sprintf("unsupported %s value", n.ShortTag())}
+	}
+}
+
+// localDateTime is the layout of a TOML local date-time.
+const localDateTime = "2006-01-02T15:04:05.999999999"
+
+// LocalDateTime and LocalDate mark times decoded from YAML timestamps without
+// a zone, and from dates. Decoding reads both as UTC, which the marks keep,
+// so marked times format as before; TOML output writes them without an
+// offset.
+var (
+	LocalDateTime = time.FixedZone("UTC", 0)
+	LocalDate     = time.FixedZone("UTC", 0)
+)
+
+// Local returns t, decoded from the YAML timestamp value, marked with
+// LocalDate or LocalDateTime if value has no zone.
+func Local(t time.Time, value string) time.Time {
+	switch {
+	case !strings.ContainsAny(value, "tT "):
+		return t.In(LocalDate)
+	case !hasZone(value):
+		return t.In(LocalDateTime)
+	}
+	return t
+}
+
+// Timestamp returns the YAML timestamp for t that Encode writes the way t
+// was marked by Local.
+func Timestamp(t time.Time) string {
+	switch t.Location() {
+	case LocalDate:
+		return t.Format(time.DateOnly)
+	case LocalDateTime:
+		return t.Format("2006-01-02 15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// hasZone reports whether the YAML timestamp value ends with Z or an offset.
+// The time part holds only digits, colons and a fraction.
+func hasZone(value string) bool {
+	i := strings.IndexAny(value, "tT ")
+	return i >= 0 && strings.ContainsAny(value[i+1:], "Zz+-")
+}
+
+// formatFloat returns f as a TOML float, which always has a fraction or an
+// exponent.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// quoteKey returns key bare if TOML allows it, and quoted otherwise.
+func quoteKey(key string) string {
+	if bareKeyRe.MatchString(key) {
+		return key
+	}
+	return quote(key, false)
+}
+
+// quote returns s as a TOML basic string. With multiline, a string holding a
+// newline is written as a multi-line basic string, so text stays readable.
+func quote(s string, multiline bool) string {
+	multiline = multiline && strings.Contains(s, "\n")
+	var b strings.Builder
+	if multiline {
+		// A newline right after the opening delimiter is not part of the string
+		b.WriteString("\"\"\"\n")
+	} else {
+		b.WriteByte('"')
+	}
+	for _, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n' && multiline:
+			b.WriteByte('\n')
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if multiline {
+		b.WriteString(`"""`)
+	} else {
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// arrayOfTables reports whether n is a non-empty sequence of maps, written as
+// an array of tables.
+func arrayOfTables(n *yaml.Node) bool {
+	if n.Kind != yaml.SequenceNode || len(n.Content) == 0 {
+		return false
+	}
+	for _, elem := range n.Content {
+		if resolve(elem).Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+// isMergeKey reports whether k is the YAML merge key <<.
+func isMergeKey(k *yaml.Node) bool {
+	return k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge"
+}
+
+// resolve follows alias nodes to the node they refer to.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// appendPath returns a new key path with key added to path.
+func appendPath(path []string, key string) []string {
+	return append(append(make([]string, 0, len(path)+1), path...), key)
+}
+
+// kindName names the kind of n in messages.
+func kindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "map"
+	case yaml.SequenceNode:
+		return "sequence"
+	default:
+		return "scalar"
+	}
+}
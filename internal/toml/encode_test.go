@@ -0,0 +1,162 @@
+package toml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// parse returns the document node of src.
+func parse(t *testing.T, src string) *yaml.Node {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	return &doc
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "scalars",
+			src:  "name: web\nport: 8080\nratio: 1.0\nbig: 1e300\non: true\nday: 2024-01-02\nat: 2024-01-02T03:04:05Z\n",
+			want: "name = \"web\"\nport = 8080\nratio = 1.0\nbig = 1e+300\non = true\nday = 2024-01-02\nat = 2024-01-02T03:04:05Z\n",
+		},
+		{
+			name: "date-times",
+			src:  "local: 2024-01-02 03:04:05.5\nshort: 2024-1-2 3:04:05\nutc: 2024-01-02t03:04:05Z\noffset: 2024-01-02T03:04:05-07:00\n",
+			want: "local = 2024-01-02T03:04:05.5\nshort = 2024-01-02T03:04:05\nutc = 2024-01-02T03:04:05Z\noffset = 2024-01-02T03:04:05-07:00\n",
+		},
+		{
+			name: "special floats",
+			src:  "a: .nan\nb: .inf\nc: -.inf\n",
+			want: "a = nan\nb = inf\nc = -inf\n",
+		},
+		{
+			name: "strings and keys",
+			src:  "\"my key\": \"say \\\"hi\\\"\\t\\\\\"\nscript: |\n  set -e\n  make\n\"\": x\n",
+			want: "\"my key\" = \"say \\\"hi\\\"\\t\\\\\"\nscript = \"\"\"\nset -e\nmake\n\"\"\"\n\"\" = \"x\"\n",
+		},
+		{
+			name: "values before tables",
+			src:  "server:\n  tls:\n    enabled: true\n  host: a\nname: b\n",
+			want: "name = \"b\"\n\n[server]\nhost = \"a\"\n\n[server.tls]\nenabled = true\n",
+		},
+		{
+			name: "table of tables has no header",
+			src:  "a:\n  b:\n    c: 1\n  \"d.e\":\n    f: 2\n",
+			want: "[a.b]\nc = 1\n\n[a.\"d.e\"]\nf = 2\n",
+		},
+		{
+			name: "empty table",
+			src:  "a: {}\n",
+			want: "[a]\n",
+		},
+		{
+			name: "array of tables",
+			src:  "servers:\n  - host: a\n    tags: {zone: eu}\n  - host: b\n",
+			want: "[[servers]]\nhost = \"a\"\n\n[servers.tags]\nzone = \"eu\"\n\n[[servers]]\nhost = \"b\"\n",
+		},
+		{
+			name: "inline arrays",
+			src:  "ports: [80, 443]\nnested: [[1, 2], [a]]\ntables: [[{a: 1}], []]\nweights: [1.0, 2.5]\nempty: []\n",
+			want: "ports = [80, 443]\nnested = [[1, 2], [\"a\"]]\ntables = [[{ a = 1 }], []]\nweights = [1.0, 2.5]\nempty = []\n",
+		},
+		{
+			name: "aliases and merge keys",
+			src:  "base: &base\n  x: 1\n  y: 2\nsite:\n  y: 3\n  <<: *base\n  z: *base\n",
+			want: "[base]\nx = 1\ny = 2\n\n[site]\ny = 3\nx = 1\n\n[site.z]\nx = 1\ny = 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(parse(t, tt.src))
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocal(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"2024-01-02", "2024-01-02"},
+		{"2024-01-02 03:04:05.5", "2024-01-02 03:04:05.5"},
+		{"2024-01-02T03:04:05Z", "2024-01-02T03:04:05Z"},
+		{"2024-01-02T03:04:05+02:00", "2024-01-02T03:04:05+02:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var v time.Time
+			if err := parse(t, tt.value).Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			got := Local(v, tt.value)
+			if !got.Equal(v) {
+				t.Errorf("Local() = %v, want the same time as %v", got, v)
+			}
+			if s := Timestamp(got); s != tt.want {
+				t.Errorf("Timestamp() = %q, want %q", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode_Empty(t *testing.T) {
+	for _, n := range []*yaml.Node{nil, {Kind: yaml.DocumentNode}, parse(t, "{}")} {
+		got, err := Encode(n)
+		if err != nil || len(got) != 0 {
+			t.Errorf("Encode() = %q, %v, want no output", got, err)
+		}
+	}
+}
+
+func TestEncode_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		wantPath string
+		want     string
+	}{
+		{"null", "a:\n  b: null\n", "a.b", "null value at a.b"},
+		{"null in array", "a: [1, ~]\n", "a.1", "null value at a.1"},
+		{"mixed array", "a: [1, x]\n", "a", "array mixes integer and string values at a"},
+		{"tables and values", "a: [{b: 1}, 2]\n", "a", "array mixes table and integer values at a"},
+		{"integers and floats", "a: [1, 2.5]\n", "a", "array mixes integer and float values at a"},
+		{"sequence root", "- 1\n", "", "the root is a sequence, and a TOML document must be a table"},
+		{"scalar root", "1\n", "", "the root is a scalar, and a TOML document must be a table"},
+		{"integer range", "a: 18446744073709551615\n", "a", "larger than TOML allows"},
+		{"complex key", "? [a]\n: 1\n", "", "a sequence key cannot be a TOML key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Encode(parse(t, tt.src))
+			var tomlErr *Error
+			if !errors.As(err, &tomlErr) {
+				t.Fatalf("Encode() error = %v, want an *Error", err)
+			}
+			if got := strings.Join(tomlErr.Path, "."); got != tt.wantPath {
+				t.Errorf("Path = %q, want %q", got, tt.wantPath)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Encode() error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
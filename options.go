@@ -1,6 +1,9 @@
 package fyaml
 
-import "fmt"
+import (
+	"fmt"
+	"io/fs"
+)
 
 // Format specifies the output format for the packed document.
 type Format string
@@ -10,6 +13,23 @@ const (
 	FormatYAML Format = "yaml"
 	// FormatJSON outputs JSON format.
 	FormatJSON Format = "json"
+	// FormatTOML outputs TOML format. Documents TOML cannot hold, such as
+	// one with null values, fail with ErrUnrepresentable.
+	FormatTOML Format = "toml"
+	// FormatProperties outputs a Java .properties file with one line per
+	// value, keyed by its dotted key path, with sequence items indexed as in
+	// servers[0].host. Documents it cannot hold, such as one with null values
+	// or empty maps, fail with ErrUnrepresentable.
+	FormatProperties Format = "properties"
+	// FormatDotenv outputs a dotenv file with one line per value, keyed by its
+	// key path joined with underscores and uppercased, as in SERVERS_0_HOST.
+	// It fails with ErrUnrepresentable where FormatProperties does, and for
+	// keys that are not valid variable names.
+	FormatDotenv Format = "dotenv"
+	// FormatEnvFile outputs an environment file keyed like FormatDotenv, with
+	// values written literally for docker --env-file. Values that FormatDotenv
+	// would quote, such as ones with spaces or $, fail with ErrUnrepresentable.
+	FormatEnvFile Format = "env-file"
 )
 
 // Mode controls the output behavior of the packed document.
@@ -30,13 +50,115 @@ const (
 	MergeShallow MergeStrategy = "shallow"
 	// MergeDeep recursively merges nested maps, only replacing values at the leaf level.
 	MergeDeep MergeStrategy = "deep"
+	// MergeStrict recursively merges nested maps like MergeDeep, but fails with a
+	// *ConflictError when two files define the same key with a non-map value.
+	MergeStrict MergeStrategy = "strict"
+)
+
+// SequenceMerge controls how sequences are merged when multiple files set the same key to one.
+type SequenceMerge string
+
+const (
+	// SequenceReplace lets the later sequence replace the earlier one (default).
+	SequenceReplace SequenceMerge = "replace"
+	// SequenceAppend concatenates sequences in file order.
+	SequenceAppend SequenceMerge = "append"
+	// SequenceAppendUnique concatenates sequences in file order, leaving out
+	// items equal to one already in the sequence.
+	SequenceAppendUnique SequenceMerge = "append-unique"
+)
+
+// MultiDocument controls how source files holding more than one YAML document are packed.
+type MultiDocument string
+
+const (
+	// MultiDocumentFail fails with a *MultiDocumentError (default).
+	MultiDocumentFail MultiDocument = "error"
+	// MultiDocumentMerge merges the documents of a file in order, as if each
+	// were a later file.
+	MultiDocumentMerge MultiDocument = "merge"
+	// MultiDocumentSequence packs the documents of a file as the items of a
+	// sequence under the key named by the file.
+	MultiDocumentSequence MultiDocument = "sequence"
+)
+
+// SymlinkPolicy controls how followed symlinks that point outside the pack root are handled.
+type SymlinkPolicy string
+
+const (
+	// SymlinkError fails packing (default).
+	SymlinkError SymlinkPolicy = "error"
+	// SymlinkSkip leaves the link out of the pack.
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkAllow packs the target like any other file or directory.
+	SymlinkAllow SymlinkPolicy = "allow"
 )
 
 // PackOptions configures how a directory is packed into a single document.
 type PackOptions struct {
-	// Dir is the directory to pack (required).
+	// Dir is the directory to pack (required unless FS is set).
+	// When FS is set, Dir is a slash-separated path within FS and defaults to its root.
+	// It is cleaned first, so "./config" and "config/" name the same directory.
 	Dir string
 
+	// FS is an optional filesystem to pack from instead of the OS filesystem,
+	// such as an embed.FS or fstest.MapFS. Includes are confined to Dir within FS.
+	FS fs.FS
+
+	// Include, if non-empty, limits the pack to the files matched by one of
+	// these doublestar patterns, such as "services/**". Patterns are matched
+	// against slash-separated paths relative to the pack root; "*" matches
+	// within a path segment and "**" across segments. A file inside a matched
+	// directory is matched too.
+	Include []string
+
+	// Exclude leaves out the files and directories matched by one of these
+	// doublestar patterns, such as "experimental/**". It takes precedence over
+	// Include.
+	Exclude []string
+
+	// OrderPrefixes strips numeric ordering prefixes such as "010-" from the
+	// keys named by files and directories, so 010-build.yml produces the key
+	// "build". Prefixed siblings are read first, in order of their prefix
+	// value, which sets their key order in ModePreserve and their merge order.
+	// Siblings whose keys are equal only once their prefixes are stripped,
+	// such as 010-build.yml and build.yml, fail the pack.
+	// It also enables .order files, which list a directory's children in the
+	// order they should be read; without it they are ignored like other
+	// dotfiles.
+	OrderPrefixes bool
+
+	// FollowSymlinks walks symlinked directories as if they were in place.
+	// Without it, symlinked files are read through the link but symlinked
+	// directories are left out. Links to a directory that contains them are
+	// skipped with a warning. This works on FS too when it implements
+	// fs.ReadLinkFS, as fstest.MapFS does.
+	FollowSymlinks bool
+
+	// SymlinksOutsideRoot decides what happens to followed symlinks whose
+	// target is outside the pack root. Defaults to SymlinkError if empty.
+	SymlinksOutsideRoot SymlinkPolicy
+
+	// TextExtensions packs files with one of these extensions, such as ".sh",
+	// ".sql" or "md" (the dot is optional, and case is ignored), instead of
+	// skipping them. The raw content of each file becomes a string value
+	// under the key named by the file; in ModePreserve it is written as a
+	// literal block scalar. Includes and boolean conversion do not apply.
+	TextExtensions []string
+
+	// Documents writes a stream of documents instead of one: each value of
+	// the root map, in output key order, becomes a YAML document after "---",
+	// or a line of JSON Lines with FormatJSON. Indent does not apply to JSON
+	// Lines, and FormatTOML and the flat formats, which have no
+	// document streams, fail with ErrInvalidFormat.
+	Documents bool
+
+	// DocumentsPath is a dot-separated key path, such as "items", whose map
+	// values or sequence items become the documents instead of the root's.
+	// Setting it implies Documents. A path that does not lead to a map or
+	// sequence fails with ErrDocumentsPath.
+	DocumentsPath string
+
 	// Format specifies the output format. Defaults to FormatYAML if empty.
 	Format Format
 
@@ -46,15 +168,97 @@ type PackOptions struct {
 	// MergeStrategy controls merge behavior. Defaults to MergeShallow if empty.
 	MergeStrategy MergeStrategy
 
+	// SequenceMerge controls how two sequences under the same key are merged.
+	// Defaults to SequenceReplace if empty. It applies with every MergeStrategy
+	// wherever two files set the same key, including nested keys with MergeDeep
+	// and MergeStrict; appended sequences are not overrides or conflicts.
+	SequenceMerge SequenceMerge
+
+	// ListMergeKeys enables keyed list merging with MergeDeep or MergeStrict,
+	// for Kubernetes-style lists such as containers or env. When two files set
+	// the same key to sequences whose items are all maps with one of these
+	// identity keys (e.g. "name"), items with equal identities are merged and
+	// the others appended. Keys are tried in order for each item. Other
+	// sequences are merged as SequenceMerge says.
+	ListMergeKeys []string
+
+	// ListMergeKeysByPath sets the identity keys of the sequences at
+	// dot-separated key paths such as "spec.containers", taking precedence
+	// over ListMergeKeys. A "*" segment matches any single key, and items of
+	// keyed lists are addressed by their identity value, so
+	// "spec.containers.*.ports" matches the ports of every container. An empty
+	// list turns keyed merging off at that path.
+	ListMergeKeysByPath map[string][]string
+
+	// AllowIdenticalDuplicates lets MergeStrict accept a key defined by more than
+	// one file when every definition has the same value. It has no effect with
+	// other merge strategies.
+	AllowIdenticalDuplicates bool
+
+	// AllowNonMapFiles lets a file named by its key, such as timeout.yml, hold a
+	// scalar or sequence, which becomes the value of the key. Root files and @
+	// files and directories merge into their parent map, so a scalar or
+	// sequence in one is still a *StructureError.
+	AllowNonMapFiles bool
+
+	// MultiDocument decides how a file with more than one YAML document,
+	// separated by "---", is packed. Defaults to MultiDocumentFail if empty.
+	// MultiDocumentMerge merges the documents in order with MergeStrategy and
+	// SequenceMerge, so every document must hold a map. MultiDocumentSequence
+	// sets the key named by the file to the sequence of its documents, which
+	// root files and @ files cannot do. Files with one document are unaffected.
+	MultiDocument MultiDocument
+
 	// EnableIncludes processes !include, !include-text, and <<include()>> directives.
 	EnableIncludes bool
 
 	// ConvertBooleans converts unquoted YAML 1.1 booleans (on/off, yes/no) to YAML 1.2 (true/false).
 	ConvertBooleans bool
 
+	// RelaxedJSON reads .json files with the JSON5 parser used for .jsonc and
+	// .json5 files, so they may hold comments and trailing commas. By default
+	// .json files are read as YAML.
+	RelaxedJSON bool
+
 	// Indent is the number of spaces for indentation. Defaults to 2 if zero.
 	Indent int
 
+	// CollectErrors keeps packing after a file fails to parse, include or fit the
+	// tree, and returns every such error joined with errors.Join instead of only
+	// the first. Packing still fails if any error occurred.
+	CollectErrors bool
+
+	// SourceMap, if non-nil, is filled with the source file, line and column
+	// of every key in the packed document, including the files it overrode.
+	SourceMap *SourceMap
+
+	// Logger is an optional logger for verbose output. If nil, no logging is performed.
+	Logger Logger
+}
+
+// UnpackOptions configures how a document is split into a directory tree.
+type UnpackOptions struct {
+	// Dir is the directory to write the tree to (required). It must not exist or be empty.
+	Dir string
+
+	// Mode controls output behavior. Defaults to ModeCanonical if empty.
+	// ModePreserve keeps comments and key order, splitting only where packing
+	// the tree in preserve mode reproduces them. Key order is kept in .order
+	// files, which packing applies with PackOptions.OrderPrefixes.
+	Mode Mode
+
+	// Depth is the number of key levels split into separate entries. At depth 1,
+	// each top-level key becomes a file; each further level turns the maps above
+	// it into directories. Defaults to 1 if zero.
+	Depth int
+
+	// SplitPaths lists dot-separated key paths (e.g. "jobs" or "components.schemas")
+	// whose maps are split into directories regardless of Depth.
+	SplitPaths []string
+
+	// Indent is the number of spaces for indentation in written files. Defaults to 2 if zero.
+	Indent int
+
 	// Logger is an optional logger for verbose output. If nil, no logging is performed.
 	Logger Logger
 }
@@ -67,8 +271,16 @@ func ParseFormat(s string) (Format, error) {
 		return FormatYAML, nil
 	case "json":
 		return FormatJSON, nil
+	case "toml":
+		return FormatTOML, nil
+	case "properties":
+		return FormatProperties, nil
+	case "dotenv":
+		return FormatDotenv, nil
+	case "env-file":
+		return FormatEnvFile, nil
 	default:
-		return "", fmt.Errorf("%w: %s (must be 'yaml' or 'json')", ErrInvalidFormat, s)
+		return "", fmt.Errorf("%w: %s (must be 'yaml', 'json', 'toml', 'properties', 'dotenv' or 'env-file')", ErrInvalidFormat, s)
 	}
 }
 
@@ -93,8 +305,55 @@ func ParseMergeStrategy(s string) (MergeStrategy, error) {
 		return MergeShallow, nil
 	case "deep":
 		return MergeDeep, nil
+	case "strict":
+		return MergeStrict, nil
+	default:
+		return "", fmt.Errorf("%w: %s (must be 'shallow', 'deep' or 'strict')", ErrInvalidMergeStrategy, s)
+	}
+}
+
+// ParseSequenceMerge parses a sequence merge string and returns the corresponding SequenceMerge.
+// Returns an error if the value is invalid.
+func ParseSequenceMerge(s string) (SequenceMerge, error) {
+	switch s {
+	case "replace":
+		return SequenceReplace, nil
+	case "append":
+		return SequenceAppend, nil
+	case "append-unique":
+		return SequenceAppendUnique, nil
+	default:
+		return "", fmt.Errorf("%w: %s (must be 'replace', 'append' or 'append-unique')", ErrInvalidSequenceMerge, s)
+	}
+}
+
+// ParseMultiDocument parses a multi-document policy string and returns the corresponding MultiDocument.
+// Returns an error if the policy is invalid.
+func ParseMultiDocument(s string) (MultiDocument, error) {
+	switch s {
+	case "error":
+		return MultiDocumentFail, nil
+	case "merge":
+		return MultiDocumentMerge, nil
+	case "sequence":
+		return MultiDocumentSequence, nil
+	default:
+		return "", fmt.Errorf("%w: %s (must be 'error', 'merge' or 'sequence')", ErrInvalidMultiDocument, s)
+	}
+}
+
+// ParseSymlinkPolicy parses a symlink policy string and returns the corresponding SymlinkPolicy.
+// Returns an error if the policy is invalid.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch s {
+	case "error":
+		return SymlinkError, nil
+	case "skip":
+		return SymlinkSkip, nil
+	case "allow":
+		return SymlinkAllow, nil
 	default:
-		return "", fmt.Errorf("%w: %s (must be 'shallow' or 'deep')", ErrInvalidMergeStrategy, s)
+		return "", fmt.Errorf("%w: %s (must be 'error', 'skip' or 'allow')", ErrInvalidSymlinkPolicy, s)
 	}
 }
 
@@ -0,0 +1,139 @@
+package fyaml
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/jksmth/fyaml/internal/filetree"
+)
+
+// PackResult describes a packed document: the files it was built from, the
+// files left out, and any warnings raised along the way.
+type PackResult struct {
+	// Files lists the files whose content was read, in merge order, once
+	// each. Files read by !include, !include-text and <<include()>> follow
+	// the file that includes them. Paths are slash-separated and relative to
+	// the pack root.
+	Files []string `json:"files"`
+
+	// Skipped lists the paths left out of the document and why, sorted by path.
+	Skipped []SkippedFile `json:"skipped"`
+
+	// Warnings lists conditions worth attention that did not stop packing.
+	Warnings []Warning `json:"warnings"`
+
+	// Digest is the SHA-256 digest of the output, as "sha256:<hex>".
+	Digest string `json:"digest"`
+}
+
+// SkipReason explains why a path was left out of the packed document.
+type SkipReason string
+
+const (
+	// SkipHidden marks dotfiles and dotfolders.
+	SkipHidden SkipReason = "hidden"
+	// SkipUnsupported marks files that are not .yml, .yaml, .json, .jsonc,
+	// .json5 or .toml.
+	SkipUnsupported SkipReason = "unsupported"
+	// SkipEmpty marks files without any content.
+	SkipEmpty SkipReason = "empty"
+	// SkipIgnored marks paths matched by a .fyamlignore file.
+	SkipIgnored SkipReason = "ignored"
+	// SkipExcluded marks paths left out by PackOptions.Include or Exclude.
+	SkipExcluded SkipReason = "excluded"
+	// SkipSymlinkCycle marks followed symlinks to a directory that contains them.
+	SkipSymlinkCycle SkipReason = "symlink-cycle"
+	// SkipSymlinkOutside marks followed symlinks that point outside the pack
+	// root, with SymlinkSkip.
+	SkipSymlinkOutside SkipReason = "symlink-outside-root"
+)
+
+// SkippedFile is a path left out of the packed document.
+type SkippedFile struct {
+	// Path is slash-separated and relative to the pack root.
+	Path   string     `json:"path"`
+	Reason SkipReason `json:"reason"`
+}
+
+// WarningKind identifies the kind of a Warning.
+type WarningKind string
+
+const (
+	// WarningEmptyOutput reports that no content was found to pack.
+	WarningEmptyOutput WarningKind = "empty-output"
+	// WarningOverride reports a key whose value was replaced by a later file.
+	WarningOverride WarningKind = "override"
+	// WarningOrderEntry reports a .order file entry that matches no packed
+	// file or directory. Its source is the .order file.
+	WarningOrderEntry WarningKind = "order-entry"
+	// WarningSymlinkCycle reports a followed symlink to a directory that
+	// contains it, which is left out. Its source is the link.
+	WarningSymlinkCycle WarningKind = "symlink-cycle"
+)
+
+// Warning is a condition worth attention that did not stop packing.
+type Warning struct {
+	Kind WarningKind `json:"kind"`
+
+	// Message describes the warning in the same words a Logger would see.
+	Message string `json:"message"`
+
+	// Path is the key path the warning is about, if any.
+	Path []string `json:"path,omitempty"`
+
+	// Sources lists the locations involved, if any. For WarningOverride it
+	// holds the overridden location followed by the one that won.
+	Sources []SourceLocation `json:"sources,omitempty"`
+}
+
+// newPackResult builds the result of packing from the tree and marshal report.
+func newPackResult(tree *filetree.Node, report *filetree.Report) *PackResult {
+	result := &PackResult{}
+	if report != nil {
+		result.Files = report.Files
+	}
+
+	var skipped []filetree.Skipped
+	if tree != nil {
+		skipped = append(skipped, tree.Skipped...)
+	}
+	if report != nil {
+		skipped = append(skipped, report.Skipped...)
+	}
+	for _, s := range skipped {
+		result.Skipped = append(result.Skipped, SkippedFile{Path: s.Path, Reason: SkipReason(s.Reason)})
+	}
+	sort.SliceStable(result.Skipped, func(i, j int) bool {
+		return result.Skipped[i].Path < result.Skipped[j].Path
+	})
+
+	if tree != nil {
+		for _, w := range tree.Warnings {
+			result.Warnings = append(result.Warnings, Warning{
+				Kind:    WarningKind(w.Kind),
+				Message: w.Message,
+				Sources: []SourceLocation{{File: w.File}},
+			})
+		}
+	}
+	if report != nil {
+		for _, o := range report.Overrides {
+			lost, won := newSourceLocation(o.Lost), newSourceLocation(o.Won)
+			result.Warnings = append(result.Warnings, Warning{
+				Kind:    WarningOverride,
+				Message: o.Message(),
+				Path:    o.Path,
+				Sources: []SourceLocation{lost, won},
+			})
+		}
+	}
+
+	return result
+}
+
+// setDigest records the digest of the output.
+func (r *PackResult) setDigest(output []byte) {
+	sum := sha256.Sum256(output)
+	r.Digest = "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package fyaml
+
+import (
+	"fmt"
+
+	"github.com/jksmth/fyaml/internal/filetree"
+)
+
+// SourceMap records where each key of a packed document came from.
+// Pass a non-nil SourceMap in PackOptions to have Pack fill it.
+type SourceMap struct {
+	// Entries lists every key path of the document, sorted by path.
+	// Keys inside sequences are not tracked.
+	Entries []SourceMapEntry `json:"entries"`
+}
+
+// SourceMapEntry describes the provenance of one key path.
+type SourceMapEntry struct {
+	// Path is the key path from the document root, e.g. ["jobs", "build", "steps"].
+	// Non-string keys use the same string form as JSON output.
+	Path []string `json:"path"`
+
+	// Sources lists every location that set the key, in merge order. The last
+	// source won; earlier ones were overridden or, for maps merged with
+	// MergeDeep, contributed keys of their own.
+	Sources []SourceLocation `json:"sources"`
+}
+
+// SourceLocation is a position in the packed directory.
+type SourceLocation struct {
+	// File is the slash-separated path of the file or directory, relative to the pack root.
+	File string `json:"file"`
+
+	// Line and Column locate the key within File, starting at 1. Both are zero
+	// for keys named by a file or directory rather than written in one.
+	// Keys brought in by !include keep their position in the included file.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// newSourceMapEntries converts the internal source map entries.
+func newSourceMapEntries(m *filetree.SourceMap) []SourceMapEntry {
+	if m == nil || len(m.Entries) == 0 {
+		return nil
+	}
+	entries := make([]SourceMapEntry, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		sources := make([]SourceLocation, 0, len(e.Sources))
+		for _, s := range e.Sources {
+			sources = append(sources, newSourceLocation(s))
+		}
+		entries = append(entries, SourceMapEntry{Path: e.Path, Sources: sources})
+	}
+	return entries
+}
+
+// newSourceLocation converts an internal source location.
+func newSourceLocation(s filetree.Source) SourceLocation {
+	return SourceLocation{File: s.File, Line: s.Line, Column: s.Column}
+}
+
+// String returns the location as "file:line:column", or just the file for
+// keys named by files and directories.
+func (l SourceLocation) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
@@ -0,0 +1,121 @@
+package fyaml
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.yaml.in/yaml/v4"
+
+	"github.com/jksmth/fyaml/internal/filetree"
+	"github.com/jksmth/fyaml/internal/logger"
+)
+
+// Unpack splits a single YAML/JSON document into an FYAML directory tree,
+// as the inverse of Pack.
+//
+// Map values become directories or files named after their keys, following the
+// same rules Pack applies. Values that cannot be written as their own file
+// (scalars, lists, empty maps, and keys that are not strings) are kept together
+// in an @ file that merges into their parent. Keys with characters that cannot
+// appear in file names are percent-encoded, such as %2F for "/". Packing the
+// resulting directory with the same Mode yields the same output as packing the
+// document. In ModePreserve, key order is kept in .order files, so the
+// directory must be packed with OrderPrefixes; a warning is logged when one is
+// written.
+//
+// UnpackOptions.Dir is required and must not exist or be empty. All other
+// options have sensible defaults:
+//   - Mode defaults to ModeCanonical
+//   - Depth defaults to 1
+//   - Indent defaults to 2
+//   - Logger defaults to a no-op logger if nil
+func Unpack(ctx context.Context, data []byte, opts UnpackOptions) error {
+	// Check for context cancellation
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context canceled: %w", err)
+	}
+
+	if opts.Dir == "" {
+		return fmt.Errorf("%w", ErrDirectoryRequired)
+	}
+
+	// Apply defaults
+	if opts.Mode == "" {
+		opts.Mode = ModeCanonical
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 1
+	}
+	if opts.Indent == 0 {
+		opts.Indent = 2
+	}
+
+	if opts.Mode != ModeCanonical && opts.Mode != ModePreserve {
+		return fmt.Errorf("%w: %s (must be 'canonical' or 'preserve')", ErrInvalidMode, opts.Mode)
+	}
+	if opts.Depth < 1 {
+		return fmt.Errorf("%w: %d (must be positive)", ErrInvalidDepth, opts.Depth)
+	}
+	if opts.Indent < 1 {
+		return fmt.Errorf("%w: %d (must be positive)", ErrInvalidIndent, opts.Indent)
+	}
+
+	log := opts.Logger
+	if log == nil {
+		log = logger.Nop()
+	}
+
+	doc, err := parseSingleDocument(data)
+	if err != nil {
+		return err
+	}
+
+	mode := filetree.ModeCanonical
+	if opts.Mode == ModePreserve {
+		mode = filetree.ModePreserve
+	}
+
+	// Check for context cancellation before I/O operations
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("context canceled: %w", err)
+	}
+
+	err = filetree.Unpack(doc, opts.Dir, &filetree.UnpackOptions{
+		Mode:       mode,
+		Depth:      opts.Depth,
+		SplitPaths: opts.SplitPaths,
+		Indent:     opts.Indent,
+		Logger:     log,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unpack document: %w", err)
+	}
+	return nil
+}
+
+// parseSingleDocument parses data as exactly one YAML/JSON document.
+// Empty input yields an empty document node.
+func parseSingleDocument(data []byte) (*yaml.Node, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+
+	var doc yaml.Node
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return &yaml.Node{Kind: yaml.DocumentNode}, nil
+		}
+		return nil, fmt.Errorf("failed to parse YAML/JSON input: %w", err)
+	}
+
+	var extra yaml.Node
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML/JSON input: %w", err)
+		}
+		return nil, fmt.Errorf("input contains multiple documents, which is not supported")
+	}
+
+	return &doc, nil
+}